@@ -0,0 +1,360 @@
+package dockercluster
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/internal/queryhits"
+	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/hashicorp/memberlist"
+)
+
+// RecordView is one node's entry for a hostname, as the admin API shows it.
+type RecordView struct {
+	Hostname string `json:"hostname"`
+	RecordMeta
+	Source    string         `json:"source"` // "local", "remote" or "manual"
+	IP        string         `json:"ip,omitempty"`
+	IPv6      string         `json:"ipv6,omitempty"`
+	Addrs     []string       `json:"addrs,omitempty"`
+	CNAME     string         `json:"cname,omitempty"`
+	TTL       uint32         `json:"ttl"` // TTL the record is answered with
+	SRV       []string       `json:"srv,omitempty"`
+	Container *ContainerInfo `json:"container,omitempty"`
+	Restored  bool           `json:"restored,omitempty"` // Loaded from the snapshot, not yet confirmed
+}
+
+// MemberView is a cluster member, as the admin API shows it.
+type MemberView struct {
+	Name  string `json:"name"`
+	Addr  string `json:"addr"`
+	State string `json:"state"` // alive, suspect, dead or left
+	Meta  string `json:"meta,omitempty"`
+	Local bool   `json:"local"`
+}
+
+// DaemonStatus describes a watched Docker daemon.
+type DaemonStatus struct {
+	Endpoint   string     `json:"endpoint"`
+	Connected  bool       `json:"connected"`
+	LastSync   *time.Time `json:"last_sync,omitempty"` // Last full container sync
+	Containers int        `json:"containers"`          // Containers tracked
+	Services   int        `json:"services"`            // Swarm services with registered records
+}
+
+// recordViews returns the entries of every hostname, sorted by hostname and node.
+func (dc *DockerCluster) recordViews() []RecordView {
+	all := dc.Records.GetAllWithMeta()
+	hostnames := make([]string, 0, len(all))
+	for hostname := range all {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	views := []RecordView{}
+	for _, hostname := range hostnames {
+		views = append(views, dc.hostnameViews(hostname, all[hostname])...)
+	}
+	return views
+}
+
+// hostnameViews returns the views of a hostname's entries.
+func (dc *DockerCluster) hostnameViews(hostname string, entries []RecordEntry) []RecordView {
+	views := make([]RecordView, 0, len(entries))
+	for _, e := range entries {
+		source := "remote"
+		switch {
+		case e.Manual:
+			source = "manual"
+		case e.NodeID == dc.Records.localNode:
+			source = "local"
+		}
+		var srv []string
+		for _, p := range e.SRV {
+			srv = append(srv, p.Service+"."+p.Proto+":"+strconv.Itoa(int(p.Port)))
+		}
+		views = append(views, RecordView{
+			Hostname:   hostname,
+			RecordMeta: RecordMeta{Timestamp: e.Timestamp, NodeID: e.NodeID},
+			Source:     source,
+			IP:         e.IP,
+			IPv6:       e.IPv6,
+			Addrs:      e.Addrs,
+			CNAME:      e.CNAME,
+			TTL:        dc.recordTTL(e),
+			SRV:        srv,
+			Container:  e.Container,
+			Restored:   e.restored,
+		})
+	}
+	return views
+}
+
+// manualResponse is a manual record, as POST /records returns it: with the
+// node that holds it, which alone can replace or delete it.
+type manualResponse struct {
+	ManualRecord
+	NodeID string `json:"node"`
+}
+
+// manualRequest is the body of POST /records: a manual record, which may
+// give its expiry relative to now.
+type manualRequest struct {
+	ManualRecord
+	ExpiresIn string `json:"expires_in,omitempty"` // Go duration, e.g. "1h"
+}
+
+// recordsHandler handles GET /records requests: every record, and
+// authenticated POST /records requests: create or replace a manual record.
+func (dc *DockerCluster) recordsHandler(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet:
+		writeJSON(w, "records", dc.recordViews())
+	case r.Method == http.MethodPost && dc.Manual != nil:
+		if dc.authorized(w, r) {
+			dc.createManualRecord(w, r)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// recordHandler handles GET /records/{hostname} requests: the entries of
+// one hostname, and authenticated DELETE /records/{hostname} requests:
+// delete its manual record. Wildcard records are only matched by name.
+func (dc *DockerCluster) recordHandler(w http.ResponseWriter, r *http.Request) {
+	hostname := strings.TrimSuffix(strings.ToLower(r.PathValue("hostname")), ".")
+	switch {
+	case r.Method == http.MethodGet:
+	case r.Method == http.MethodDelete && dc.Manual != nil:
+		if dc.authorized(w, r) {
+			dc.deleteManualRecord(w, hostname)
+		}
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	entries := sortedEntries(dc.Records.load()[hostname])
+	if len(entries) == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, "record", dc.hostnameViews(hostname, entries))
+}
+
+// createManualRecord creates the manual record of the request body.
+func (dc *DockerCluster) createManualRecord(w http.ResponseWriter, r *http.Request) {
+	var req manualRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid record: %v", err), http.StatusBadRequest)
+		return
+	}
+	rec := req.ManualRecord
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 || rec.Expires != nil {
+			http.Error(w, fmt.Sprintf("Invalid record: invalid expires_in %q", req.ExpiresIn), http.StatusBadRequest)
+			return
+		}
+		expires := time.Now().Add(d).UTC()
+		rec.Expires = &expires
+	}
+	if err := rec.validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid record: %v", err), http.StatusBadRequest)
+		return
+	}
+	if rec.expired(time.Now()) {
+		http.Error(w, "Invalid record: expires in the past", http.StatusBadRequest)
+		return
+	}
+	if dc.otherManualOwner(w, rec.Hostname) {
+		return
+	}
+
+	rec, err := dc.Manual.Set(rec)
+	if err != nil {
+		log.Errorf("docker-cluster: failed to create manual record %s: %v", rec.Hostname, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	log.Infof("docker-cluster: manual record %s created (ip=%s ipv6=%s)", rec.Hostname, rec.IP, rec.IPv6)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, "manual record", manualResponse{ManualRecord: rec, NodeID: dc.Records.localNode})
+}
+
+// deleteManualRecord deletes the manual record of hostname.
+func (dc *DockerCluster) deleteManualRecord(w http.ResponseWriter, hostname string) {
+	found, err := dc.Manual.Delete(hostname)
+	switch {
+	case err != nil:
+		log.Errorf("docker-cluster: failed to delete manual record %s: %v", hostname, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	case !found:
+		if !dc.otherManualOwner(w, hostname) {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	default:
+		log.Infof("docker-cluster: manual record %s deleted", hostname)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// otherManualOwner reports whether another node holds a manual record for
+// hostname, answering 409 with its node ID if so. Manual records are kept by
+// the node that created them, so only that node can replace or delete them.
+func (dc *DockerCluster) otherManualOwner(w http.ResponseWriter, hostname string) bool {
+	for _, e := range sortedEntries(dc.Records.load()[hostname]) {
+		if e.Manual && e.NodeID != dc.Records.localNode {
+			http.Error(w, fmt.Sprintf("Manual record %s is held by node %s; send the request to it", hostname, e.NodeID), http.StatusConflict)
+			return true
+		}
+	}
+	return false
+}
+
+// authorized reports whether the request carries the admin token as a
+// bearer token, answering 401 if it does not.
+func (dc *DockerCluster) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && dc.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(dc.AdminToken)) == 1 {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="docker-cluster"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// restricted wraps the handler of an endpoint that exposes records, containers
+// or daemons, so that with an admin token every request must carry it, reads
+// included.
+func (dc *DockerCluster) restricted(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if dc.AdminToken != "" && !dc.authorized(w, r) {
+			return
+		}
+		h(w, r)
+	}
+}
+
+// membersHandler handles GET /cluster/members requests. Without clustering
+// the list is empty.
+func (dc *DockerCluster) membersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	members := []MemberView{}
+	if dc.ClusterManager != nil {
+		for _, node := range dc.ClusterManager.Members() {
+			members = append(members, MemberView{
+				Name:  node.Name,
+				Addr:  node.Address(),
+				State: nodeState(node.State),
+				Meta:  string(node.Meta),
+				Local: node.Name == dc.ClusterManager.config.NodeName,
+			})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	writeJSON(w, "cluster members", members)
+}
+
+// watcherHandler handles GET /watcher requests: the state of every watched
+// Docker daemon.
+func (dc *DockerCluster) watcherHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := []DaemonStatus{}
+	if dc.Watcher != nil {
+		status = dc.Watcher.Status()
+	}
+	writeJSON(w, "watcher status", status)
+}
+
+// hitsHandler handles GET /hits requests: the query counts of the records of
+// both plugins, sorted by hostname. With ?unqueried=DURATION only the records
+// not queried within it are listed; a zero duration lists those never
+// queried.
+func (dc *DockerCluster) hitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hits := queryhits.All()
+	if param := r.URL.Query().Get("unqueried"); param != "" {
+		window, err := time.ParseDuration(param)
+		if err != nil || window < 0 {
+			http.Error(w, fmt.Sprintf("Invalid unqueried duration %q", param), http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		hits = slices.DeleteFunc(hits, func(h queryhits.Hit) bool { return !h.Unqueried(window, now) })
+	}
+	views := make([]HitView, len(hits))
+	for i, h := range hits {
+		views[i] = hitView(h)
+	}
+	writeJSON(w, "hits", views)
+}
+
+// Status returns the state of the watcher's Docker daemon, followed by
+// those of its further daemons.
+func (dw *DockerWatcher) Status() []DaemonStatus {
+	status := make([]DaemonStatus, 0, 1+len(dw.daemons))
+	for _, w := range append([]*DockerWatcher{dw}, dw.daemons...) {
+		w.mu.RLock()
+		s := DaemonStatus{Endpoint: w.dockerSocket, Connected: w.client != nil}
+		if !w.lastSync.IsZero() {
+			lastSync := w.lastSync
+			s.LastSync = &lastSync
+		}
+		for id := range w.containers {
+			if strings.HasPrefix(id, serviceKeyPrefix) {
+				s.Services++
+			} else {
+				s.Containers++
+			}
+		}
+		w.mu.RUnlock()
+		status = append(status, s)
+	}
+	return status
+}
+
+// nodeState returns the name of a memberlist node state.
+func nodeState(state memberlist.NodeStateType) string {
+	switch state {
+	case memberlist.StateAlive:
+		return "alive"
+	case memberlist.StateSuspect:
+		return "suspect"
+	case memberlist.StateDead:
+		return "dead"
+	case memberlist.StateLeft:
+		return "left"
+	default:
+		return "unknown"
+	}
+}
+
+// writeJSON writes v as the JSON response; what names it in error logs.
+func writeJSON(w http.ResponseWriter, what string, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("docker-cluster: failed to encode %s: %v", what, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,170 @@
+package dockercluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRecordsHandler(t *testing.T) {
+	records := NewRecords()
+	records.SetLocalNode("node1")
+	records.AddEntry("web.example.com", RecordEntry{
+		IP:        "10.0.0.1",
+		TTL:       30,
+		SRV:       []SRVPort{{Service: "_http", Proto: "_tcp", Port: 8080}},
+		Container: &ContainerInfo{ID: "abc", Name: "web", Image: "nginx"},
+		Timestamp: 100,
+	})
+	records.AddEntryWithMeta("app.example.com", RecordEntry{IP: "10.0.0.2", Timestamp: 200, NodeID: "node2"})
+	dc := &DockerCluster{Records: records, TTL: 60}
+
+	rec := httptest.NewRecorder()
+	dc.recordsHandler(rec, httptest.NewRequest(http.MethodGet, "/records", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var views []RecordView
+	if err := json.Unmarshal(rec.Body.Bytes(), &views); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(views) != 2 || views[0].Hostname != "app.example.com" || views[1].Hostname != "web.example.com" {
+		t.Fatalf("expected both records sorted by hostname, got %+v", views)
+	}
+	app, web := views[0], views[1]
+	if app.Source != "remote" || app.NodeID != "node2" || app.Timestamp != 200 || app.TTL != 60 {
+		t.Errorf("unexpected remote record %+v", app)
+	}
+	if web.Source != "local" || web.TTL != 30 || !slices.Equal(web.SRV, []string{"_http._tcp:8080"}) || web.Container == nil || web.Container.Name != "web" {
+		t.Errorf("unexpected local record %+v", web)
+	}
+
+	rec = httptest.NewRecorder()
+	dc.recordsHandler(rec, httptest.NewRequest(http.MethodPost, "/records", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+func TestRecordHandler(t *testing.T) {
+	records := NewRecords()
+	records.Add("app.example.com", "10.0.0.1")
+	records.Add("*.apps.example.com", "10.0.0.2")
+	dc := &DockerCluster{Records: records, TTL: 60}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/records/{hostname}", dc.recordHandler)
+
+	tests := []struct {
+		path string
+		code int
+		ip   string
+	}{
+		{path: "/records/App.example.com.", code: http.StatusOK, ip: "10.0.0.1"},
+		{path: "/records/*.apps.example.com", code: http.StatusOK, ip: "10.0.0.2"},
+		{path: "/records/one.apps.example.com", code: http.StatusNotFound},
+		{path: "/records/unknown.example.com", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.code, rec.Code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var views []RecordView
+		if err := json.Unmarshal(rec.Body.Bytes(), &views); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", tt.path, err)
+		}
+		if len(views) != 1 || views[0].IP != tt.ip {
+			t.Errorf("%s: unexpected record %+v", tt.path, views)
+		}
+	}
+}
+
+func TestMembersHandlerWithoutCluster(t *testing.T) {
+	dc := &DockerCluster{Records: NewRecords()}
+
+	rec := httptest.NewRecorder()
+	dc.membersHandler(rec, httptest.NewRequest(http.MethodGet, "/cluster/members", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Errorf("expected an empty list, got %q", body)
+	}
+}
+
+func TestWatcherHandler(t *testing.T) {
+	dw := NewDockerWatcher("unix:///var/run/docker.sock", "192.168.1.100", nil, NewRecords())
+	nas := dw.AddDaemon(DockerDaemon{Host: "tcp://nas:2376"})
+	dw.updateContainer("app", []string{"app.example.com"}, RecordEntry{IP: "192.168.1.100"})
+	dw.updateContainer(serviceKeyPrefix+"web", []string{"web.example.com"}, RecordEntry{IP: "10.0.0.5"})
+	synced := time.Date(2026, 1, 4, 12, 0, 0, 0, time.UTC)
+	nas.lastSync = synced
+	dc := &DockerCluster{Records: dw.records, Watcher: dw}
+
+	rec := httptest.NewRecorder()
+	dc.watcherHandler(rec, httptest.NewRequest(http.MethodGet, "/watcher", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var status []DaemonStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(status) != 2 {
+		t.Fatalf("expected both daemons, got %+v", status)
+	}
+	local, remote := status[0], status[1]
+	if local.Endpoint != "unix:///var/run/docker.sock" || local.Connected || local.LastSync != nil || local.Containers != 1 || local.Services != 1 {
+		t.Errorf("unexpected local daemon status %+v", local)
+	}
+	if remote.Endpoint != "tcp://nas:2376" || remote.LastSync == nil || !remote.LastSync.Equal(synced) || remote.Containers != 0 {
+		t.Errorf("unexpected remote daemon status %+v", remote)
+	}
+}
+
+func TestAdminReadEndpointsRequireToken(t *testing.T) {
+	records := NewRecords()
+	records.Add("app.example.com", "192.168.1.100")
+	paths := []string{"/records", "/records/app.example.com", "/cluster/members", "/watcher", "/conflicts", "/hits"}
+
+	get := func(dc *DockerCluster, path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		dc.adminHandler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	open := &DockerCluster{Records: records}
+	for _, path := range paths {
+		if code := get(open, path, ""); code != http.StatusOK {
+			t.Errorf("%s without admin token: expected 200, got %d", path, code)
+		}
+	}
+
+	dc := &DockerCluster{Records: records, AdminToken: "s3cret"}
+	for _, path := range paths {
+		for _, token := range []string{"", "wrong"} {
+			if code := get(dc, path, token); code != http.StatusUnauthorized {
+				t.Errorf("%s with token %q: expected 401, got %d", path, token, code)
+			}
+		}
+		if code := get(dc, path, "s3cret"); code != http.StatusOK {
+			t.Errorf("%s with the admin token: expected 200, got %d", path, code)
+		}
+	}
+	if code := get(dc, "/version", ""); code != http.StatusOK {
+		t.Errorf("expected /version to stay open, got %d", code)
+	}
+}
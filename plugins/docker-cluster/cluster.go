@@ -3,6 +3,7 @@ package dockercluster
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/log"
@@ -18,6 +19,7 @@ type ClusterManager struct {
 	delegate   *ClusterDelegate
 	discovery  *PeerDiscovery
 	memberlist *memberlist.Memberlist
+	joined     atomic.Bool // Set once the initial join attempt returned
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -43,6 +45,9 @@ func NewClusterManager(config *ClusterConfig, records *Records) (*ClusterManager
 		records: records,
 	}
 
+	// Records written by the local Docker watcher are owned by this node
+	records.SetLocalNode(config.NodeName)
+
 	// Create delegate with numNodes function that returns current cluster size
 	cm.delegate = NewClusterDelegate(config.NodeName, records, func() int {
 		cm.mu.RLock()
@@ -52,6 +57,7 @@ func NewClusterManager(config *ClusterConfig, records *Records) (*ClusterManager
 		}
 		return cm.memberlist.NumMembers()
 	})
+	cm.delegate.isMember = cm.isMember
 
 	return cm, nil
 }
@@ -72,6 +78,7 @@ func (cm *ClusterManager) Start(ctx context.Context) error {
 	mlConfig.BindPort = cm.config.Port
 	mlConfig.AdvertisePort = cm.config.Port
 	mlConfig.Delegate = cm.delegate
+	mlConfig.Events = cm.delegate
 
 	// Set encryption key if configured
 	if len(cm.config.SecretKey) > 0 {
@@ -164,6 +171,8 @@ func (cm *ClusterManager) Stop() error {
 // Join attempts to join the cluster by contacting seed nodes or discovered peers.
 // If using broadcast discovery, it will retry periodically until peers are found.
 func (cm *ClusterManager) Join() error {
+	defer cm.joined.Store(true)
+
 	cm.mu.RLock()
 	seeds := cm.config.Seeds
 	ml := cm.memberlist
@@ -237,6 +246,13 @@ func (cm *ClusterManager) discoveryJoinLoop() {
 // NotifyRecordAdd broadcasts a record addition to cluster peers.
 // The message is first applied locally, then broadcast to other nodes.
 func (cm *ClusterManager) NotifyRecordAdd(hostname, ip string, timestamp int64) {
+	cm.NotifyRecordEntryAdd(hostname, RecordEntry{IP: ip, Timestamp: timestamp})
+}
+
+// NotifyRecordEntryAdd broadcasts a record addition carrying the addresses and
+// timestamp in entry. The entry's NodeID is replaced with this node's name.
+// The message is first applied locally, then broadcast to other nodes.
+func (cm *ClusterManager) NotifyRecordEntryAdd(hostname string, entry RecordEntry) {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
@@ -244,13 +260,8 @@ func (cm *ClusterManager) NotifyRecordAdd(hostname, ip string, timestamp int64)
 		return
 	}
 
-	msg := &RecordMessage{
-		Hostname:  hostname,
-		IP:        ip,
-		Action:    RecordActionAdd,
-		Timestamp: timestamp,
-		NodeID:    cm.config.NodeName,
-	}
+	entry.NodeID = cm.config.NodeName
+	msg := newAddMessage(hostname, entry)
 
 	// Apply locally first
 	cm.records.ApplyMessage(msg)
@@ -283,6 +294,24 @@ func (cm *ClusterManager) NotifyRecordRemove(hostname string, timestamp int64) {
 	cm.delegate.BroadcastRecord(msg)
 }
 
+// isMember reports whether nodeID is this node or a live cluster member.
+// Before memberlist starts every node is accepted.
+func (cm *ClusterManager) isMember(nodeID string) bool {
+	cm.mu.RLock()
+	ml := cm.memberlist
+	cm.mu.RUnlock()
+
+	if ml == nil || nodeID == cm.config.NodeName {
+		return true
+	}
+	for _, node := range ml.Members() {
+		if node.Name == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
 // Members returns the current list of cluster members.
 // Returns nil if memberlist is not initialized.
 func (cm *ClusterManager) Members() []*memberlist.Node {
@@ -295,6 +324,21 @@ func (cm *ClusterManager) Members() []*memberlist.Node {
 	return cm.memberlist.Members()
 }
 
+// Synced reports whether the node caught up with the cluster: the initial
+// join attempt returned and either a peer's full state was merged or there
+// is no peer to sync with.
+func (cm *ClusterManager) Synced() bool {
+	if !cm.joined.Load() {
+		return false
+	}
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if cm.delegate != nil && cm.delegate.merged.Load() {
+		return true
+	}
+	return cm.memberlist == nil || cm.memberlist.NumMembers() <= 1
+}
+
 // IsHealthy returns true if the cluster is operational.
 // A cluster is considered healthy if it has at least one member (itself).
 func (cm *ClusterManager) IsHealthy() bool {
@@ -324,11 +324,20 @@ func TestClusterManagerJoinNoSeeds(t *testing.T) {
 	}
 	defer cm.Stop()
 
+	if cm.Synced() {
+		t.Error("expected not synced before Join")
+	}
+
 	// Join with no seeds should return nil (standalone operation)
 	err = cm.Join()
 	if err != nil {
 		t.Errorf("expected Join with no seeds to return nil, got %v", err)
 	}
+
+	// Without peers there is nothing to sync with
+	if !cm.Synced() {
+		t.Error("expected a standalone node to be synced after Join")
+	}
 }
 
 func TestClusterManagerDoubleStart(t *testing.T) {
@@ -534,6 +543,9 @@ func TestClusterManagerTwoNodeCluster(t *testing.T) {
 		cm1.Stop()
 		t.Fatalf("Node2 failed to join: %v", err)
 	}
+	if !cm2.Synced() {
+		t.Error("Node2: expected to be synced after the join's push/pull")
+	}
 
 	// Give time for cluster to stabilize
 	time.Sleep(500 * time.Millisecond)
@@ -0,0 +1,133 @@
+package dockercluster
+
+import (
+	"fmt"
+
+	"github.com/coredns/coredns/plugin/internal/netaddr"
+	"github.com/moby/moby/client"
+)
+
+// defaultDockerSocket is the daemon watched when no docker_socket is configured.
+const defaultDockerSocket = "unix:///var/run/docker.sock"
+
+// DockerDaemon is a Docker endpoint to watch: the local socket, or a daemon
+// on another host exposing its API over TCP, usually with TLS.
+type DockerDaemon struct {
+	Host     string // e.g. unix:///var/run/docker.sock or tcp://10.0.0.5:2376
+	HostIP   string // Host-mode address of its containers ("" for the plugin's host_ip)
+	HostIPv6 string
+	TLS      DaemonTLS
+}
+
+// DaemonTLS holds the client certificate files of a TCP endpoint. FromEnv
+// loads ca.pem, cert.pem and key.pem from DOCKER_CERT_PATH instead and
+// verifies the daemon only if DOCKER_TLS_VERIFY is set, like the docker CLI.
+type DaemonTLS struct {
+	Cert    string
+	Key     string
+	CA      string
+	FromEnv bool
+}
+
+// clientOpts returns the Docker client options for the watcher's endpoint.
+func (dw *DockerWatcher) clientOpts() []client.Opt {
+	var opts []client.Opt
+	if dw.dockerSocket != "" {
+		opts = append(opts, client.WithHost(dw.dockerSocket))
+	}
+	switch {
+	case dw.tls.Cert != "" || dw.tls.CA != "":
+		opts = append(opts, client.WithTLSClientConfig(dw.tls.CA, dw.tls.Cert, dw.tls.Key))
+	case dw.tls.FromEnv:
+		opts = append(opts, client.WithTLSClientConfigFromEnv())
+	}
+	return opts
+}
+
+// AddDaemon watches a further Docker daemon with the watcher's settings and
+// returns its watcher. Each daemon has its own connection, backoff and
+// container bookkeeping; all of them write to the same records. It must be
+// called once the watcher is configured and before Start.
+func (dw *DockerWatcher) AddDaemon(d DockerDaemon) *DockerWatcher {
+	hostIP, hostIPv6 := d.HostIP, d.HostIPv6
+	if hostIP == "" && hostIPv6 == "" {
+		hostIP, hostIPv6 = dw.hostIP, dw.hostIPv6
+	}
+	daemon := &DockerWatcher{
+		dockerSocket: d.Host,
+		hostIP:       hostIP,
+		hostIPv6:     hostIPv6,
+		tls:          d.TLS,
+		labels:       dw.labels,
+		records:      dw.records,
+		owners:       dw.hostnameOwners(),
+		callback:     dw.callback,
+		ipMode:       dw.ipMode,
+		network:      dw.network,
+		healthMode:   dw.healthMode,
+		autoRegister: dw.autoRegister,
+		traefik:      dw.traefik,
+		nodeName:     dw.nodeName,
+		templateEnv:  dw.templateEnv,
+		swarmMode:    dw.swarmMode,
+		minTTL:       dw.minTTL,
+		maxTTL:       dw.maxTTL,
+		containers:   make(map[string]containerState),
+		synced:       make(chan struct{}),
+	}
+	dw.daemons = append(dw.daemons, daemon)
+	return daemon
+}
+
+// parseDaemon parses the arguments of docker_socket:
+//
+//	ENDPOINT [host_ip IP [IPv6]] [tls CERT KEY [CA]]
+func parseDaemon(args []string) (DockerDaemon, error) {
+	if len(args) == 0 {
+		return DockerDaemon{}, fmt.Errorf("an endpoint is required")
+	}
+	endpoint, err := client.ParseHostURL(args[0])
+	if err != nil {
+		return DockerDaemon{}, fmt.Errorf("invalid endpoint %q: %v", args[0], err)
+	}
+	d := DockerDaemon{Host: args[0]}
+
+	rest := args[1:]
+	for len(rest) > 0 {
+		option := rest[0]
+		values := rest[1:]
+		// An option's values run up to the next option
+		n := 0
+		for n < len(values) && values[n] != "host_ip" && values[n] != "tls" {
+			n++
+		}
+		values, rest = values[:n], values[n:]
+
+		switch option {
+		case "host_ip":
+			if len(values) == 0 || len(values) > 2 {
+				return DockerDaemon{}, fmt.Errorf("host_ip takes one IPv4 and/or one IPv6 address")
+			}
+			v4, v6, err := netaddr.ParseHostIPs(values)
+			if err != nil {
+				return DockerDaemon{}, fmt.Errorf("invalid host_ip: %v", err)
+			}
+			d.HostIP, d.HostIPv6 = v4, v6
+		case "tls":
+			if len(values) < 2 || len(values) > 3 {
+				return DockerDaemon{}, fmt.Errorf("tls takes CERT KEY [CA]")
+			}
+			d.TLS.Cert, d.TLS.Key = values[0], values[1]
+			if len(values) == 3 {
+				d.TLS.CA = values[2]
+			}
+		default:
+			return DockerDaemon{}, fmt.Errorf("unknown option %q (valid: host_ip, tls)", option)
+		}
+	}
+
+	if d.TLS.Cert != "" && endpoint.Scheme != "tcp" {
+		return DockerDaemon{}, fmt.Errorf("tls requires a tcp:// endpoint, got %s", d.Host)
+	}
+	return d, nil
+}
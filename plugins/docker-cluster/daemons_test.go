@@ -0,0 +1,136 @@
+package dockercluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+func TestParseDaemon(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    DockerDaemon
+		wantErr bool
+	}{
+		{
+			name: "socket",
+			args: []string{"unix:///var/run/docker.sock"},
+			want: DockerDaemon{Host: "unix:///var/run/docker.sock"},
+		},
+		{
+			name: "host_ip and tls",
+			args: []string{"tcp://10.0.0.5:2376", "host_ip", "10.0.0.5", "fd00::5", "tls", "cert.pem", "key.pem", "ca.pem"},
+			want: DockerDaemon{
+				Host:     "tcp://10.0.0.5:2376",
+				HostIP:   "10.0.0.5",
+				HostIPv6: "fd00::5",
+				TLS:      DaemonTLS{Cert: "cert.pem", Key: "key.pem", CA: "ca.pem"},
+			},
+		},
+		{
+			name: "tls without CA",
+			args: []string{"tcp://nas:2376", "tls", "cert.pem", "key.pem", "host_ip", "10.0.0.6"},
+			want: DockerDaemon{Host: "tcp://nas:2376", HostIP: "10.0.0.6", TLS: DaemonTLS{Cert: "cert.pem", Key: "key.pem"}},
+		},
+		{name: "no endpoint", args: nil, wantErr: true},
+		{name: "invalid endpoint", args: []string{"/var/run/docker.sock"}, wantErr: true},
+		{name: "host_ip without address", args: []string{"tcp://nas:2376", "host_ip"}, wantErr: true},
+		{name: "invalid host_ip", args: []string{"tcp://nas:2376", "host_ip", "nas"}, wantErr: true},
+		{name: "tls without key", args: []string{"tcp://nas:2376", "tls", "cert.pem"}, wantErr: true},
+		{name: "tls on a socket", args: []string{"unix:///var/run/docker.sock", "tls", "cert.pem", "key.pem"}, wantErr: true},
+		{name: "unknown option", args: []string{"tcp://nas:2376", "timeout", "5s"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDaemon(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDaemon(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseDaemon(%v) = %+v, want %+v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientOptsTLS(t *testing.T) {
+	dw := &DockerWatcher{
+		dockerSocket: "tcp://10.0.0.5:2376",
+		tls:          DaemonTLS{Cert: "/nonexistent/cert.pem", Key: "/nonexistent/key.pem"},
+	}
+	if _, err := client.NewClientWithOpts(dw.clientOpts()...); err == nil {
+		t.Error("expected error loading missing client certificates")
+	}
+
+	dw.tls = DaemonTLS{}
+	cli, err := client.NewClientWithOpts(dw.clientOpts()...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cli.Close()
+	if cli.DaemonHost() != "tcp://10.0.0.5:2376" {
+		t.Errorf("expected tcp://10.0.0.5:2376, got %s", cli.DaemonHost())
+	}
+}
+
+func TestAddDaemonBookkeeping(t *testing.T) {
+	records := NewRecords()
+	var events []string
+	dw := NewDockerWatcher("unix:///var/run/docker.sock", "192.168.1.100", []string{"coredns.host.name"}, records)
+	dw.healthMode = HealthIgnore
+	remote := dw.AddDaemon(DockerDaemon{Host: "tcp://10.0.0.5:2376", HostIP: "10.0.0.5"})
+	dw.SetCallback(func(hostname string, entry RecordEntry, added bool) {
+		if added {
+			events = append(events, hostname)
+		}
+	})
+
+	if remote.records != records || remote.healthMode != HealthIgnore {
+		t.Error("expected the daemon to share the watcher's records and settings")
+	}
+
+	dw.applyContainerSummary(container.Summary{ID: "same-id", Labels: map[string]string{"coredns.host.name": "local.example.com"}})
+	remote.applyContainerSummary(container.Summary{ID: "same-id", Labels: map[string]string{"coredns.host.name": "remote.example.com"}})
+
+	if ip, _ := records.Lookup("local.example.com"); ip != "192.168.1.100" {
+		t.Errorf("expected local container at the plugin's host_ip, got %q", ip)
+	}
+	if ip, _ := records.Lookup("remote.example.com"); ip != "10.0.0.5" {
+		t.Errorf("expected remote container at its daemon's host_ip, got %q", ip)
+	}
+	if !equalSlice(events, []string{"local.example.com", "remote.example.com"}) {
+		t.Errorf("expected both daemons to report through the callback, got %v", events)
+	}
+
+	// The same container ID on another daemon is a different container
+	remote.withdrawContainer("same-id", "removed")
+	if _, ok := records.Lookup("local.example.com"); !ok {
+		t.Error("expected the local container to keep its records")
+	}
+	if _, ok := records.Lookup("remote.example.com"); ok {
+		t.Error("expected the remote container's records to be removed")
+	}
+}
+
+func TestAddDaemonStartStop(t *testing.T) {
+	dw := NewDockerWatcher("unix:///nonexistent/docker.sock", "192.168.1.100", nil, NewRecords())
+	remote := dw.AddDaemon(DockerDaemon{Host: "unix:///nonexistent/remote.sock"})
+
+	if err := dw.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	remote.mu.RLock()
+	running := remote.running
+	remote.mu.RUnlock()
+	if !running {
+		t.Error("expected Start to start the daemon's watcher")
+	}
+
+	dw.Stop()
+	if remote.running {
+		t.Error("expected Stop to stop the daemon's watcher")
+	}
+}
@@ -3,17 +3,24 @@ package dockercluster
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
+	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/hashicorp/memberlist"
 )
 
-// ClusterDelegate implements the memberlist.Delegate interface for DNS record gossip.
-// It handles broadcasting record changes to cluster peers and merging remote state.
+// ClusterDelegate implements the memberlist.Delegate and memberlist.EventDelegate
+// interfaces for DNS record gossip.
+// It handles broadcasting record changes to cluster peers, merging remote state,
+// and dropping the records of nodes that leave the cluster.
 type ClusterDelegate struct {
 	nodeID     string
 	records    *Records
 	broadcasts *memberlist.TransmitLimitedQueue
+	isMember   func(nodeID string) bool // optional; filters records of departed nodes during merge
+	hits       *HitTracker              // optional; query counts exchanged with the records
 	msgChan    chan *RecordMessage
+	merged     atomic.Bool // Set once a peer's full state was merged
 	ctx        context.Context
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
@@ -56,12 +63,18 @@ func (d *ClusterDelegate) NotifyMsg(data []byte) {
 	if err != nil {
 		return
 	}
+	// This node's records come only from its watcher, manual records and
+	// snapshot, never back from a peer
+	if msg.NodeID == d.nodeID {
+		return
+	}
 
 	// Non-blocking send - drop message if channel is full
 	select {
 	case d.msgChan <- msg:
 	default:
 		// Channel full, drop message (will be recovered via full state sync)
+		gossipDroppedTotal.Inc()
 	}
 }
 
@@ -80,6 +93,9 @@ func (d *ClusterDelegate) LocalState(join bool) []byte {
 		NodeID:  d.nodeID,
 		Records: allRecords,
 	}
+	if d.hits != nil {
+		state.Hits = d.hits.Local()
+	}
 
 	data, err := state.Encode()
 	if err != nil {
@@ -90,7 +106,8 @@ func (d *ClusterDelegate) LocalState(join bool) []byte {
 }
 
 // MergeRemoteState merges state received from another node during TCP push/pull sync.
-// Each record is applied using LWW conflict resolution.
+// Each record is applied using LWW conflict resolution; the sender's query
+// counts replace those it sent before.
 func (d *ClusterDelegate) MergeRemoteState(buf []byte, join bool) {
 	if len(buf) == 0 {
 		return
@@ -101,17 +118,48 @@ func (d *ClusterDelegate) MergeRemoteState(buf []byte, join bool) {
 		return
 	}
 
-	// Apply each record using LWW conflict resolution
-	for hostname, entry := range state.Records {
-		msg := &RecordMessage{
-			Hostname:  hostname,
-			IP:        entry.IP,
-			Action:    RecordActionAdd,
-			Timestamp: entry.Timestamp,
-			NodeID:    entry.NodeID,
+	// Apply each node's record using LWW conflict resolution
+	for hostname, entries := range state.Records {
+		for _, entry := range entries {
+			// Skip this node's own records, which a peer may still hold
+			// from before a restart, and records of nodes that already
+			// left, so a peer that has not yet noticed the departure can't
+			// bring them back
+			if entry.NodeID == d.nodeID || d.isMember != nil && !d.isMember(entry.NodeID) {
+				continue
+			}
+			d.records.ApplyMessage(newAddMessage(hostname, entry))
 		}
-		d.records.ApplyMessage(msg)
 	}
+	if d.hits != nil && state.Hits != nil && state.NodeID != d.nodeID {
+		d.hits.setRemote(state.NodeID, state.Hits)
+	}
+	d.merged.Store(true)
+}
+
+// NotifyJoin is called when a node joins the cluster. Its records arrive
+// through gossip and push/pull sync, so only the member count is updated.
+func (d *ClusterDelegate) NotifyJoin(node *memberlist.Node) {
+	clusterMembers.Inc()
+}
+
+// NotifyLeave is called when a node leaves or is declared dead.
+// Its records are removed so queries only return live owners.
+func (d *ClusterDelegate) NotifyLeave(node *memberlist.Node) {
+	clusterMembers.Dec()
+	if node == nil || node.Name == d.nodeID {
+		return
+	}
+	if n := d.records.RemoveNode(node.Name); n > 0 {
+		log.Infof("docker-cluster: node %s left, removed %d record(s)", node.Name, n)
+	}
+	if d.hits != nil {
+		d.hits.forget(node.Name)
+	}
+}
+
+// NotifyUpdate is called when a node's metadata changes. We don't use node metadata.
+func (d *ClusterDelegate) NotifyUpdate(node *memberlist.Node) {
 }
 
 // BroadcastRecord queues a record message for broadcast to cluster peers.
@@ -122,6 +170,7 @@ func (d *ClusterDelegate) BroadcastRecord(msg *RecordMessage) {
 	}
 
 	d.broadcasts.QueueBroadcast(&broadcast{data: data})
+	gossipSentTotal.Inc()
 }
 
 // Start begins the background goroutine that processes incoming messages.
@@ -150,7 +199,10 @@ func (d *ClusterDelegate) processMessages() {
 			return
 		case msg := <-d.msgChan:
 			if msg != nil {
-				d.records.ApplyMessage(msg)
+				gossipReceivedTotal.Inc()
+				if !d.records.ApplyMessage(msg) {
+					gossipStaleTotal.Inc()
+				}
 			}
 		}
 	}
@@ -5,6 +5,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/hashicorp/memberlist"
 )
 
 func TestNewClusterDelegate(t *testing.T) {
@@ -44,6 +46,37 @@ func TestDelegateNodeMeta(t *testing.T) {
 	}
 }
 
+func TestDelegateIgnoresLocalNodeEntries(t *testing.T) {
+	records := NewRecords()
+	records.SetLocalNode("node1")
+	d := NewClusterDelegate("node1", records, func() int { return 2 })
+
+	// A peer still holds this node's entry from before it restarted
+	remoteState := &FullState{
+		NodeID: "node2",
+		Records: map[string][]RecordEntry{
+			"old.example.com": {{IP: "10.0.0.1", Timestamp: 1000, NodeID: "node1"}},
+			"app.example.com": {{IP: "10.0.0.2", Timestamp: 1000, NodeID: "node2"}},
+		},
+	}
+	data, _ := remoteState.Encode()
+	d.MergeRemoteState(data, false)
+
+	if _, ok := records.Lookup("old.example.com"); ok {
+		t.Error("expected the local node's entry not to be merged back")
+	}
+	if _, ok := records.Lookup("app.example.com"); !ok {
+		t.Error("expected the peer's entry to be merged")
+	}
+
+	msg := &RecordMessage{Hostname: "old.example.com", IP: "10.0.0.1", Action: RecordActionAdd, Timestamp: 2000, NodeID: "node1"}
+	data, _ = msg.Encode()
+	d.NotifyMsg(data)
+	if len(d.msgChan) != 0 {
+		t.Error("expected a message about the local node's record to be ignored")
+	}
+}
+
 func TestDelegateNotifyMsg(t *testing.T) {
 	records := NewRecords()
 	d := NewClusterDelegate("node1", records, func() int { return 1 })
@@ -216,7 +249,7 @@ func TestDelegateLocalState(t *testing.T) {
 		t.Errorf("expected 2 records, got %d", len(state.Records))
 	}
 
-	entryA := state.Records["a.com"]
+	entryA := state.Records["a.com"][0]
 	if entryA.IP != "1.1.1.1" {
 		t.Errorf("expected IP 1.1.1.1 for a.com, got %s", entryA.IP)
 	}
@@ -227,7 +260,7 @@ func TestDelegateLocalState(t *testing.T) {
 		t.Errorf("expected nodeID 'node1' for a.com, got %s", entryA.NodeID)
 	}
 
-	entryB := state.Records["b.com"]
+	entryB := state.Records["b.com"][0]
 	if entryB.IP != "2.2.2.2" {
 		t.Errorf("expected IP 2.2.2.2 for b.com, got %s", entryB.IP)
 	}
@@ -290,8 +323,8 @@ func TestDelegateMergeRemoteState(t *testing.T) {
 	// Create remote state
 	remoteState := &FullState{
 		NodeID: "node2",
-		Records: map[string]RecordEntry{
-			"remote.com": {IP: "10.0.0.1", Timestamp: 1000, NodeID: "node2"},
+		Records: map[string][]RecordEntry{
+			"remote.com": {{IP: "10.0.0.1", Timestamp: 1000, NodeID: "node2"}},
 		},
 	}
 	data, err := remoteState.Encode()
@@ -300,7 +333,13 @@ func TestDelegateMergeRemoteState(t *testing.T) {
 	}
 
 	// Merge remote state
+	if d.merged.Load() {
+		t.Error("expected no merge recorded before MergeRemoteState")
+	}
 	d.MergeRemoteState(data, false)
+	if !d.merged.Load() {
+		t.Error("expected the merge to be recorded")
+	}
 
 	// Verify record was added
 	ip, found := records.Lookup("remote.com")
@@ -330,9 +369,9 @@ func TestDelegateMergeRemoteStateLWW(t *testing.T) {
 	// Create remote state with older timestamp
 	remoteState := &FullState{
 		NodeID: "node2",
-		Records: map[string]RecordEntry{
-			"existing.com": {IP: "2.2.2.2", Timestamp: 1000, NodeID: "node2"},
-			"new.com":      {IP: "3.3.3.3", Timestamp: 3000, NodeID: "node2"},
+		Records: map[string][]RecordEntry{
+			"existing.com": {{IP: "2.2.2.2", Timestamp: 1000, NodeID: "node2"}},
+			"new.com":      {{IP: "3.3.3.3", Timestamp: 3000, NodeID: "node2"}},
 		},
 	}
 	data, err := remoteState.Encode()
@@ -390,8 +429,8 @@ func TestDelegateMergeRemoteStateJoin(t *testing.T) {
 
 	remoteState := &FullState{
 		NodeID: "node2",
-		Records: map[string]RecordEntry{
-			"join.com": {IP: "10.0.0.1", Timestamp: 1000, NodeID: "node2"},
+		Records: map[string][]RecordEntry{
+			"join.com": {{IP: "10.0.0.1", Timestamp: 1000, NodeID: "node2"}},
 		},
 	}
 	data, _ := remoteState.Encode()
@@ -408,6 +447,54 @@ func TestDelegateMergeRemoteStateJoin(t *testing.T) {
 	}
 }
 
+func TestDelegateNotifyLeave(t *testing.T) {
+	records := NewRecords()
+	d := NewClusterDelegate("node1", records, func() int { return 2 })
+
+	records.AddWithMeta("app.com", "10.0.0.1", 1000, "node1")
+	records.AddWithMeta("app.com", "10.0.0.2", 1000, "node2")
+	records.AddWithMeta("only2.com", "10.0.0.2", 1000, "node2")
+
+	d.NotifyLeave(&memberlist.Node{Name: "node2"})
+
+	entries := records.LookupAll("app.com")
+	if len(entries) != 1 || entries[0].NodeID != "node1" {
+		t.Errorf("expected only node1's entry to remain, got %+v", entries)
+	}
+	if _, found := records.Lookup("only2.com"); found {
+		t.Error("expected only2.com to be removed with its owner")
+	}
+
+	// Our own leave notification must not drop local records
+	d.NotifyLeave(&memberlist.Node{Name: "node1"})
+	if _, found := records.Lookup("app.com"); !found {
+		t.Error("expected local records to survive own leave")
+	}
+}
+
+func TestDelegateMergeRemoteStateSkipsDepartedNodes(t *testing.T) {
+	records := NewRecords()
+	d := NewClusterDelegate("node1", records, func() int { return 2 })
+	d.isMember = func(nodeID string) bool { return nodeID != "gone" }
+
+	remoteState := &FullState{
+		NodeID: "node2",
+		Records: map[string][]RecordEntry{
+			"app.com": {
+				{IP: "10.0.0.2", Timestamp: 1000, NodeID: "node2"},
+				{IP: "10.0.0.9", Timestamp: 1000, NodeID: "gone"},
+			},
+		},
+	}
+	data, _ := remoteState.Encode()
+	d.MergeRemoteState(data, false)
+
+	entries := records.LookupAll("app.com")
+	if len(entries) != 1 || entries[0].NodeID != "node2" {
+		t.Errorf("expected only node2's entry to be merged, got %+v", entries)
+	}
+}
+
 func TestDelegateBroadcastRecord(t *testing.T) {
 	records := NewRecords()
 	d := NewClusterDelegate("node1", records, func() int { return 1 })
@@ -585,7 +672,7 @@ func TestDelegateMessageProcessingMultiple(t *testing.T) {
 
 func TestDelegateMessageProcessingRemove(t *testing.T) {
 	records := NewRecords()
-	d := NewClusterDelegate("node1", records, func() int { return 1 })
+	d := NewClusterDelegate("node2", records, func() int { return 2 })
 
 	// Add a record first
 	records.AddWithMeta("toremove.com", "1.1.1.1", 1000, "node1")
@@ -599,7 +686,7 @@ func TestDelegateMessageProcessingRemove(t *testing.T) {
 		Hostname:  "toremove.com",
 		Action:    RecordActionRemove,
 		Timestamp: 2000,
-		NodeID:    "node2",
+		NodeID:    "node1",
 	}
 	data, _ := msg.Encode()
 	d.NotifyMsg(data)
@@ -727,8 +814,8 @@ func TestDelegateConcurrentOperations(t *testing.T) {
 		for i := 0; i < iterations; i++ {
 			state := &FullState{
 				NodeID: "remote",
-				Records: map[string]RecordEntry{
-					"merge.com": {IP: "5.5.5.5", Timestamp: int64(i), NodeID: "remote"},
+				Records: map[string][]RecordEntry{
+					"merge.com": {{IP: "5.5.5.5", Timestamp: int64(i), NodeID: "remote"}},
 				},
 			}
 			data, _ := state.Encode()
@@ -908,16 +995,16 @@ func TestDelegateLargeStateSyncWithLWW(t *testing.T) {
 	// Create remote state with lower timestamps for same hostnames
 	remoteState := &FullState{
 		NodeID:  "remote-node",
-		Records: make(map[string]RecordEntry),
+		Records: make(map[string][]RecordEntry),
 	}
 
 	for i := 0; i < 100; i++ {
 		hostname := "conflict-" + string(rune('a'+i/26)) + string(rune('a'+i%26)) + ".example.com"
-		remoteState.Records[hostname] = RecordEntry{
+		remoteState.Records[hostname] = []RecordEntry{{
 			IP:        "10.0.0." + string(rune('0'+i%10)),
 			Timestamp: int64(1000 + i), // Lower timestamps
 			NodeID:    "remote-node",
-		}
+		}}
 	}
 
 	data, err := remoteState.Encode()
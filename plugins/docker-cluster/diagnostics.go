@@ -0,0 +1,156 @@
+package dockercluster
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// defaultDebugAllow is the source allowlist used when debug_txt names no CIDRs.
+var defaultDebugAllow = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+// DebugConfig enables TXT diagnostics under <Label>.<hostname>.
+type DebugConfig struct {
+	Label string         // Leftmost label that marks a diagnostics query, e.g. "_joyride"
+	Allow []netip.Prefix // Source networks allowed to query diagnostics
+}
+
+// allowed reports whether a query from ip may read diagnostics.
+func (c *DebugConfig) allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range c.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveDiagnostics answers TXT queries for <label>.<hostname> with one record per
+// owning node: node ID, container ID, name, image and the LWW timestamp.
+// Every node holds the replicated metadata, so whichever node is queried answers.
+func (dc *DockerCluster) serveDiagnostics(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request, hostname string) (int, error) {
+	if !dc.Debug.allowed(state.IP()) {
+		log.Debugf("docker-cluster: refusing diagnostics query %s from %s", state.Name(), state.IP())
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		if err := w.WriteMsg(m); err != nil {
+			log.Errorf("docker-cluster: failed to write REFUSED response: %v", err)
+			return dns.RcodeServerFailure, err
+		}
+		return dns.RcodeRefused, nil
+	}
+
+	entries := dc.Records.LookupAll(hostname)
+	if len(entries) == 0 {
+		return dc.handleUnknown(ctx, w, r, state)
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	for _, entry := range entries {
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   state.QName(),
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+				Ttl:    0, // diagnostics must never be cached
+			},
+			Txt: diagnosticsTXT(entry),
+		})
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		log.Errorf("docker-cluster: failed to write TXT response: %v", err)
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// diagnosticsTXT renders an entry as key=value TXT strings.
+func diagnosticsTXT(entry RecordEntry) []string {
+	txt := []string{"node=" + entry.NodeID}
+	for _, ip := range entry.addrs(false) {
+		txt = append(txt, "ip="+ip)
+	}
+	for _, ip := range entry.addrs(true) {
+		txt = append(txt, "ipv6="+ip)
+	}
+	if entry.CNAME != "" {
+		txt = append(txt, "cname="+entry.CNAME)
+	}
+	if entry.TTL != 0 {
+		txt = append(txt, "ttl="+strconv.FormatUint(uint64(entry.TTL), 10))
+	}
+	if c := entry.Container; c != nil {
+		txt = append(txt,
+			"container="+truncateID(c.ID, 12),
+			"name="+c.Name,
+			"image="+c.Image,
+		)
+	}
+	txt = append(txt, "timestamp="+strconv.FormatInt(entry.Timestamp, 10))
+	if entry.Timestamp > 0 {
+		txt = append(txt, "updated="+time.Unix(0, entry.Timestamp).UTC().Format(time.RFC3339))
+	}
+	return txt
+}
+
+// parseDebugConfig parses `debug_txt LABEL [CIDR...]`. Without CIDRs only
+// loopback clients may query diagnostics; a bare IP is treated as a single host.
+func parseDebugConfig(args []string) (*DebugConfig, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("a label is required, e.g. _joyride")
+	}
+	label := strings.ToLower(args[0])
+	if !isValidDebugLabel(label) {
+		return nil, fmt.Errorf("%q is not a single DNS label", args[0])
+	}
+
+	cfg := &DebugConfig{Label: label}
+	for _, arg := range args[1:] {
+		if prefix, err := netip.ParsePrefix(arg); err == nil {
+			cfg.Allow = append(cfg.Allow, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CIDR or IP address", arg)
+		}
+		cfg.Allow = append(cfg.Allow, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	if len(cfg.Allow) == 0 {
+		cfg.Allow = defaultDebugAllow
+	}
+	return cfg, nil
+}
+
+// isValidDebugLabel returns true if s is a single DNS label of letters, digits,
+// hyphens and underscores (e.g. "_joyride").
+func isValidDebugLabel(s string) bool {
+	if len(s) == 0 || len(s) > 63 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
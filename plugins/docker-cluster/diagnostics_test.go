@@ -0,0 +1,91 @@
+package dockercluster
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestServeDiagnostics(t *testing.T) {
+	records := NewRecords()
+	records.AddEntryWithMeta("app.example.com", RecordEntry{
+		IP:        "10.0.0.1",
+		Container: &ContainerInfo{ID: "0123456789abcdef0123", Name: "web", Image: "nginx:latest"},
+		Timestamp: 1700000000000000000,
+		NodeID:    "node1",
+	})
+	records.AddWithMeta("app.example.com", "10.0.0.2", 1700000000000000001, "node2")
+
+	cfg, err := parseDebugConfig([]string{"_joyride", "10.240.0.0/16"})
+	if err != nil {
+		t.Fatalf("parseDebugConfig: %v", err)
+	}
+	dc := &DockerCluster{Records: records, TTL: 60, Debug: cfg}
+
+	query := func(name, remoteIP string) *dns.Msg {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeTXT)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: remoteIP})
+		if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return rec.Msg
+	}
+
+	m := query("_joyride.app.example.com.", "10.240.0.1")
+	if len(m.Answer) != 2 {
+		t.Fatalf("expected one TXT record per owner, got %d", len(m.Answer))
+	}
+	txt := m.Answer[0].(*dns.TXT).Txt
+	for _, want := range []string{"node=node1", "ip=10.0.0.1", "container=0123456789ab", "name=web", "image=nginx:latest", "timestamp=1700000000000000000"} {
+		if !slices.Contains(txt, want) {
+			t.Errorf("expected %q in %v", want, txt)
+		}
+	}
+	if m.Answer[0].Header().Ttl != 0 {
+		t.Errorf("expected TTL 0, got %d", m.Answer[0].Header().Ttl)
+	}
+
+	// Sources outside the allowlist are refused
+	m = query("_joyride.app.example.com.", "192.168.1.1")
+	if m.Rcode != dns.RcodeRefused || len(m.Answer) != 0 {
+		t.Errorf("expected REFUSED, got rcode %d with %d answers", m.Rcode, len(m.Answer))
+	}
+
+	// Unknown hostnames are handled like any unknown name
+	if m := query("_joyride.unknown.example.com.", "10.240.0.1"); m != nil {
+		t.Errorf("expected no response for unknown hostname, got %v", m)
+	}
+}
+
+func TestParseDebugConfig(t *testing.T) {
+	cfg, err := parseDebugConfig([]string{"_Joyride"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Label != "_joyride" {
+		t.Errorf("expected label _joyride, got %s", cfg.Label)
+	}
+	if !cfg.allowed("127.0.0.1") || !cfg.allowed("::1") || cfg.allowed("10.0.0.1") {
+		t.Errorf("expected loopback-only default, got %v", cfg.Allow)
+	}
+
+	cfg, err = parseDebugConfig([]string{"_joyride", "192.168.1.10", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.allowed("192.168.1.10") || cfg.allowed("192.168.1.11") || !cfg.allowed("fd00::1") {
+		t.Errorf("unexpected allowlist %v", cfg.Allow)
+	}
+
+	for _, args := range [][]string{nil, {"_a.b"}, {"_joyride", "not-a-cidr"}} {
+		if _, err := parseDebugConfig(args); err == nil {
+			t.Errorf("parseDebugConfig(%v) expected error", args)
+		}
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/internal/netaddr"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	// Path resolves only at Docker build time, after this directory is copied
@@ -30,6 +33,16 @@ const (
 	ActionNXDomain
 )
 
+// AAAAMode defines how AAAA queries for known hostnames are answered.
+type AAAAMode int
+
+const (
+	// AAAAAnswer - return the hostname's IPv6 address (empty NOERROR if it has none)
+	AAAAAnswer AAAAMode = iota
+	// AAAAEmpty - always return an empty NOERROR so dual-stack clients fall back to IPv4
+	AAAAEmpty
+)
+
 // DockerCluster implements the plugin.Handler interface for Docker container DNS resolution.
 type DockerCluster struct {
 	Records        *Records
@@ -38,8 +51,48 @@ type DockerCluster struct {
 	Fall           fall.F
 	Next           plugin.Handler
 	UnknownAction  UnknownAction
+	AAAAMode       AAAAMode
 	ClusterConfig  *ClusterConfig
 	ClusterManager *ClusterManager
+
+	// Zones the plugin is authoritative for; SOA and NS are synthesized at each
+	// apex. Queries outside them go to the next plugin. Empty means the root zone.
+	Zones []string
+
+	// ReverseZones enables PTR answers for queries inside these zones (nil disables them).
+	ReverseZones []string
+	// ReverseCanonical, if set, is the only name returned for PTR queries of the host IP.
+	ReverseCanonical string
+
+	// Debug enables TXT diagnostics for allowed clients (nil disables them).
+	Debug *DebugConfig
+
+	// Snapshot persists the records across restarts (nil disables it).
+	Snapshot *Snapshot
+
+	// HTTPAddr is the listen address of the version and admin HTTP endpoints.
+	HTTPAddr string
+	// Manual holds the records created through the admin API (nil disables it).
+	Manual *ManualRecords
+	// AdminToken is the bearer token the admin API's endpoints require, all
+	// but /version. Without it only the read endpoints are served, openly.
+	AdminToken string
+	// Hits counts the queries answered from each record (nil counts nothing).
+	Hits *HitTracker
+
+	// backendKey and watcherKey identify the backend and watcher settings
+	// server blocks share (see lifecycle.go); backendSettings are the
+	// backend's other settings, which a shared backend keeps.
+	backendKey      string
+	backendSettings string
+	watcherKey      string
+
+	// admin serves the HTTP endpoints through server, once started.
+	admin  http.Handler
+	server *httpServer
+
+	// rotation advances on every answered query to round-robin multi-owner records.
+	rotation atomic.Uint32
 }
 
 // Name returns the plugin name.
@@ -47,73 +100,406 @@ func (dc *DockerCluster) Name() string {
 	return "docker-cluster"
 }
 
+// Ready implements the ready.Readiness interface: the plugin is ready once
+// every Docker daemon was synced and, with clustering, the first push/pull
+// sync with a peer completed or the join found no peer to sync with.
+func (dc *DockerCluster) Ready() bool {
+	if dc.Watcher == nil || !dc.Watcher.Synced() {
+		return false
+	}
+	return dc.ClusterManager == nil || dc.ClusterManager.Synced()
+}
+
 // ServeDNS implements the plugin.Handler interface.
 func (dc *DockerCluster) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 	state := request.Request{W: w, Req: r}
+	rec := &queryRecorder{ResponseWriter: w}
+	rcode, err := dc.serveDNS(ctx, rec, r)
+	queriesTotal.WithLabelValues(state.Type(), rec.result()).Inc()
+	return rcode, err
+}
+
+// serveDNS answers a query; ServeDNS counts the result.
+func (dc *DockerCluster) serveDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
 
 	// Normalize the query name (lowercase, remove trailing dot)
 	qname := strings.ToLower(state.Name())
 	qname = strings.TrimSuffix(qname, ".")
 
-	// Check if we know this hostname
-	ip, found := dc.Records.Lookup(qname)
+	// Reverse lookups are answered from the same records, in the reverse zones
+	qtype := state.QType()
+	if qtype == dns.TypePTR {
+		return dc.servePTR(ctx, w, r, state)
+	}
 
-	// Handle AAAA queries for known hostnames
-	// IPv6 is dumb - return empty response so dual-stack clients don't wait
-	if state.QType() == dns.TypeAAAA && found {
+	zone := dc.zone(state.Name())
+	if zone == "" {
+		return dc.next(ctx, w, r)
+	}
+
+	// Diagnostics for <debug label>.<hostname>
+	if qtype == dns.TypeTXT && dc.Debug != nil {
+		if hostname, ok := strings.CutPrefix(qname, dc.Debug.Label+"."); ok {
+			return dc.serveDiagnostics(ctx, w, r, state, hostname)
+		}
+	}
+
+	// SOA and NS at the zone apex
+	if answer, extra := dc.zoneRecords(state.QName(), qtype, zone); len(answer) > 0 {
 		m := new(dns.Msg)
 		m.SetReply(r)
+		m.Authoritative = true
+		m.Answer = answer
+		m.Extra = extra
 		if err := w.WriteMsg(m); err != nil {
-			log.Errorf("docker-cluster: failed to write AAAA response: %v", err)
+			log.Errorf("docker-cluster: failed to write %s response: %v", dns.TypeToString[qtype], err)
 			return dns.RcodeServerFailure, err
 		}
 		return dns.RcodeSuccess, nil
 	}
 
-	// Only handle A record queries
-	if state.QType() != dns.TypeA {
+	if qtype == dns.TypeSRV && strings.HasPrefix(qname, "_") {
+		return dc.serveSRV(ctx, w, r, state)
+	}
+
+	// Check if we know this hostname
+	name, entries := dc.Records.LookupMatch(qname)
+	if len(entries) == 0 {
 		return dc.handleUnknown(ctx, w, r, state)
 	}
+	dc.Hits.Record(name, time.Now())
+
+	if alias, ok := cnameEntry(entries); ok {
+		return dc.serveCNAME(w, r, state, alias)
+	}
 
-	if !found {
+	// Known hostnames have no other record types
+	if qtype != dns.TypeA && qtype != dns.TypeAAAA {
+		return dc.writeNoData(w, r)
+	}
+
+	// AAAA queries for known hostnames get an empty response when IPv6
+	// answers are disabled, so dual-stack clients don't wait
+	if qtype == dns.TypeAAAA && dc.AAAAMode == AAAAEmpty {
+		return dc.writeNoData(w, r)
+	}
+
+	answers, hasFamily := dc.addressAnswers(state.QName(), qtype, entries)
+
+	// The hostname exists but has no address of the requested family
+	if !hasFamily {
+		return dc.writeNoData(w, r)
+	}
+
+	if len(answers) == 0 {
 		return dc.handleUnknown(ctx, w, r, state)
 	}
 
-	// Validate the IP address before building response
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil || parsedIP.To4() == nil {
-		log.Warningf("docker-cluster: invalid IPv4 address %q for hostname %s, treating as not found", ip, qname)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.Answer = answers
+
+	if err := w.WriteMsg(m); err != nil {
+		log.Errorf("docker-cluster: failed to write %s response: %v", dns.TypeToString[qtype], err)
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// addressAnswers builds the A or AAAA records for name from every owning
+// node's address, rotating the starting owner on every call (round-robin).
+// hasFamily is false if no owner has an address of that family; invalid
+// addresses are skipped with a warning.
+func (dc *DockerCluster) addressAnswers(name string, qtype uint16, entries []RecordEntry) (answers []dns.RR, hasFamily bool) {
+	// Collect every owning node's address of the requested family
+	ips := make([]string, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		for _, ip := range entry.addrs(qtype == dns.TypeAAAA) {
+			if !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, false
+	}
+
+	ttl := dc.recordTTL(entries...)
+	offset := int(dc.rotation.Add(1) % uint32(len(ips)))
+	for i := range ips {
+		ip := ips[(offset+i)%len(ips)]
+
+		// Validate the IP address before building response
+		rr := addressRecord(name, qtype, ip, ttl)
+		if rr == nil {
+			log.Warningf("docker-cluster: invalid %s address %q for hostname %s, skipping", dns.TypeToString[qtype], ip, strings.TrimSuffix(name, "."))
+			continue
+		}
+		answers = append(answers, rr)
+	}
+	return answers, true
+}
+
+// maxCNAMEChain bounds how many aliases are followed within the plugin.
+const maxCNAMEChain = 8
+
+// serveCNAME answers a query for an alias with its CNAME record. For A/AAAA
+// queries the target is chased while it is a known record, so clients get the
+// addresses in one answer; targets we don't know are left to the resolver.
+func (dc *DockerCluster) serveCNAME(w dns.ResponseWriter, r *dns.Msg, state request.Request, alias RecordEntry) (int, error) {
+	qtype := state.QType()
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	name := state.QName()
+	visited := map[string]bool{strings.ToLower(name): true}
+	for range maxCNAMEChain {
+		m.Answer = append(m.Answer, &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+				Ttl:    dc.recordTTL(alias),
+			},
+			Target: dns.Fqdn(alias.CNAME),
+		})
+		name = dns.Fqdn(alias.CNAME)
+
+		if (qtype != dns.TypeA && qtype != dns.TypeAAAA) || visited[name] {
+			break
+		}
+		visited[name] = true
+
+		entries := dc.Records.LookupAll(alias.CNAME)
+		if len(entries) == 0 {
+			break // external target, resolved by the client's resolver
+		}
+		if next, ok := cnameEntry(entries); ok {
+			alias = next
+			continue
+		}
+		if qtype == dns.TypeAAAA && dc.AAAAMode == AAAAEmpty {
+			break
+		}
+		answers, _ := dc.addressAnswers(name, qtype, entries)
+		m.Answer = append(m.Answer, answers...)
+		break
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		log.Errorf("docker-cluster: failed to write CNAME response: %v", err)
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// cnameEntry returns the entry aliasing a hostname, if any owner registered
+// it as a CNAME. A CNAME can't coexist with other data, so it wins over owners
+// that registered addresses; among several aliases the newest one is used.
+func cnameEntry(entries []RecordEntry) (alias RecordEntry, found bool) {
+	for _, e := range entries {
+		if e.CNAME != "" && (!found || newer(e, alias)) {
+			alias, found = e, true
+		}
+	}
+	return alias, found
+}
+
+// recordTTL returns the TTL to answer entries with: the lowest TTL any of them
+// set via label, so an RRset built from several owners shares one TTL, or the
+// plugin's ttl if none did. Restored records are capped to the snapshot's
+// stale_ttl.
+func (dc *DockerCluster) recordTTL(entries ...RecordEntry) uint32 {
+	ttl := uint32(0)
+	restored := false
+	for _, e := range entries {
+		if e.TTL != 0 && (ttl == 0 || e.TTL < ttl) {
+			ttl = e.TTL
+		}
+		restored = restored || e.restored
+	}
+	if ttl == 0 {
+		ttl = dc.TTL
+	}
+	if restored && dc.Snapshot != nil && dc.Snapshot.StaleTTL != 0 && ttl > dc.Snapshot.StaleTTL {
+		ttl = dc.Snapshot.StaleTTL
+	}
+	return ttl
+}
+
+// servePTR answers a reverse lookup with every hostname registered for the
+// address. Names outside the reverse zones go to the next plugin, like
+// forward names outside the zones.
+func (dc *DockerCluster) servePTR(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request) (int, error) {
+	qname := strings.ToLower(state.Name())
+	if plugin.Zones(dc.ReverseZones).Matches(qname) == "" {
+		return dc.next(ctx, w, r)
+	}
+
+	ip := dnsutil.ExtractAddressFromReverse(qname)
+	names := dc.Records.LookupAddr(ip)
+	if len(names) == 0 {
+		return dc.handleUnknown(ctx, w, r, state)
+	}
+
+	// The host IP is shared by every host-mode container; answer with one name
+	if dc.ReverseCanonical != "" && dc.Watcher != nil && (netaddr.SameAddr(ip, dc.Watcher.hostIP) || netaddr.SameAddr(ip, dc.Watcher.hostIPv6)) {
+		names = []string{dc.ReverseCanonical}
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	for _, name := range names {
+		m.Answer = append(m.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   state.QName(),
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    dc.TTL,
+			},
+			Ptr: dns.Fqdn(name),
+		})
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		log.Errorf("docker-cluster: failed to write PTR response: %v", err)
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// serveSRV answers _service._proto.<hostname> queries from the SRV ports the
+// hostname's owners advertise. Every owner's address is added as glue.
+func (dc *DockerCluster) serveSRV(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request) (int, error) {
+	qname := strings.TrimSuffix(strings.ToLower(state.Name()), ".")
+	service, rest, _ := strings.Cut(qname, ".")
+	proto, hostname, ok := strings.Cut(rest, ".")
+	if !ok || !strings.HasPrefix(service, "_") || !strings.HasPrefix(proto, "_") {
 		return dc.handleUnknown(ctx, w, r, state)
 	}
 
-	// Build the response
-	a := &dns.A{
-		Hdr: dns.RR_Header{
-			Name:   state.QName(),
-			Rrtype: dns.TypeA,
-			Class:  dns.ClassINET,
-			Ttl:    dc.TTL,
-		},
-		A: parsedIP.To4(),
+	name, entries := dc.Records.LookupMatch(hostname)
+	if len(entries) == 0 {
+		return dc.handleUnknown(ctx, w, r, state)
 	}
+	dc.Hits.Record(name, time.Now())
 
+	target := dns.Fqdn(hostname)
+	ttl := dc.recordTTL(entries...)
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Authoritative = true
-	m.Answer = append(m.Answer, a)
 
+	ports := make(map[uint16]bool)
+	for _, entry := range entries {
+		for _, srv := range entry.SRV {
+			if srv.Service != service || srv.Proto != proto || ports[srv.Port] {
+				continue
+			}
+			ports[srv.Port] = true
+			m.Answer = append(m.Answer, &dns.SRV{
+				Hdr: dns.RR_Header{
+					Name:   state.QName(),
+					Rrtype: dns.TypeSRV,
+					Class:  dns.ClassINET,
+					Ttl:    ttl,
+				},
+				Port:   srv.Port,
+				Target: target,
+			})
+		}
+	}
+
+	// The hostname exists but doesn't advertise this service
+	if len(m.Answer) == 0 {
+		return dc.writeNoData(w, r)
+	}
+
+	glue := make(map[string]bool)
+	for _, entry := range entries {
+		for _, ip := range entry.addrs(false) {
+			if rr := addressRecord(target, dns.TypeA, ip, ttl); rr != nil && !glue[ip] {
+				glue[ip] = true
+				m.Extra = append(m.Extra, rr)
+			}
+		}
+		if dc.AAAAMode == AAAAEmpty {
+			continue
+		}
+		for _, ip := range entry.addrs(true) {
+			if rr := addressRecord(target, dns.TypeAAAA, ip, ttl); rr != nil && !glue[ip] {
+				glue[ip] = true
+				m.Extra = append(m.Extra, rr)
+			}
+		}
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		log.Errorf("docker-cluster: failed to write SRV response: %v", err)
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// writeNoData writes an empty authoritative NOERROR response for a known
+// hostname, with the zone's SOA so resolvers can cache the negative answer.
+// The root zone (no zones configured) gets no SOA.
+func (dc *DockerCluster) writeNoData(w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	if zone := dc.zone(r.Question[0].Name); zone != "" && zone != "." {
+		m.Ns = []dns.RR{dc.soa(zone)}
+	}
 	if err := w.WriteMsg(m); err != nil {
-		log.Errorf("docker-cluster: failed to write A response: %v", err)
+		log.Errorf("docker-cluster: failed to write NODATA response: %v", err)
 		return dns.RcodeServerFailure, err
 	}
 	return dns.RcodeSuccess, nil
 }
 
+// addressRecord builds an A or AAAA record for ip, or returns nil if ip is not
+// a valid address of the family qtype asks for.
+func addressRecord(name string, qtype uint16, ip string, ttl uint32) dns.RR {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil
+	}
+	hdr := dns.RR_Header{
+		Name:   name,
+		Rrtype: qtype,
+		Class:  dns.ClassINET,
+		Ttl:    ttl,
+	}
+	if qtype == dns.TypeA {
+		if parsedIP.To4() == nil {
+			return nil
+		}
+		return &dns.A{Hdr: hdr, A: parsedIP.To4()}
+	}
+	if parsedIP.To4() != nil {
+		return nil
+	}
+	return &dns.AAAA{Hdr: hdr, AAAA: parsedIP}
+}
+
 // handleUnknown handles queries for hostnames we don't know about.
 func (dc *DockerCluster) handleUnknown(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request) (int, error) {
 	// Check if fallthrough is enabled for this zone (passes to next plugin in chain)
 	if dc.Fall.Through(state.Name()) {
-		return plugin.NextOrFailure(dc.Name(), dc.Next, ctx, w, r)
+		return dc.next(ctx, w, r)
+	}
+
+	// Names that exist without records of their own get NODATA
+	zone := dc.zone(state.Name())
+	if zone != "" && dc.nameExists(state.Name(), zone) {
+		return dc.writeNoData(w, r)
 	}
 
 	// Handle based on configured action
@@ -121,6 +507,10 @@ func (dc *DockerCluster) handleUnknown(ctx context.Context, w dns.ResponseWriter
 	case ActionNXDomain:
 		m := new(dns.Msg)
 		m.SetRcode(r, dns.RcodeNameError)
+		m.Authoritative = true
+		if zone != "" && zone != "." {
+			m.Ns = []dns.RR{dc.soa(zone)}
+		}
 		if err := w.WriteMsg(m); err != nil {
 			log.Errorf("docker-cluster: failed to write NXDOMAIN response: %v", err)
 			return dns.RcodeServerFailure, err
@@ -136,6 +526,44 @@ func (dc *DockerCluster) handleUnknown(ctx context.Context, w dns.ResponseWriter
 	}
 }
 
+// next passes a query on to the next plugin.
+func (dc *DockerCluster) next(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if rec, ok := w.(*queryRecorder); ok {
+		rec.passed = true
+		w = rec.ResponseWriter
+	}
+	return plugin.NextOrFailure(dc.Name(), dc.Next, ctx, w, r)
+}
+
+// queryRecorder notes how a query was handled, for queriesTotal.
+type queryRecorder struct {
+	dns.ResponseWriter
+	passed  bool // Passed to the next plugin
+	written bool
+	rcode   int
+}
+
+// WriteMsg records the response code and writes m.
+func (q *queryRecorder) WriteMsg(m *dns.Msg) error {
+	q.written = true
+	q.rcode = m.Rcode
+	return q.ResponseWriter.WriteMsg(m)
+}
+
+// result returns the queriesTotal result of the query.
+func (q *queryRecorder) result() string {
+	switch {
+	case q.passed:
+		return "miss"
+	case !q.written:
+		return "drop"
+	case q.rcode == dns.RcodeNameError:
+		return "nxdomain"
+	default:
+		return "hit"
+	}
+}
+
 // versionHandler handles GET /version requests
 func (dc *DockerCluster) versionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -149,25 +577,29 @@ func (dc *DockerCluster) versionHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// ServeVersionHTTP starts the version HTTP endpoint and returns the server for shutdown
-func (dc *DockerCluster) ServeVersionHTTP(addr string) *http.Server {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/version", dc.versionHandler)
-
-	server := &http.Server{
-		Addr:         addr,
-		Handler:      mux,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
+// conflictsHandler handles GET /conflicts requests: hostnames claimed by
+// more than one local container, and which claim is served.
+func (dc *DockerCluster) conflictsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
+	conflicts := []HostnameConflict{}
+	if dc.Watcher != nil {
+		conflicts = dc.Watcher.Conflicts()
+	}
+	writeJSON(w, "conflicts", conflicts)
+}
 
-	go func() {
-		log.Infof("docker-cluster: version endpoint listening on %s", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Errorf("docker-cluster: version endpoint failed: %v", err)
-		}
-	}()
-
-	return server
+// adminHandler returns the handler of the version and admin HTTP endpoints.
+func (dc *DockerCluster) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", dc.versionHandler)
+	mux.HandleFunc("/conflicts", dc.restricted(dc.conflictsHandler))
+	mux.HandleFunc("/records", dc.restricted(dc.recordsHandler))
+	mux.HandleFunc("/records/{hostname}", dc.restricted(dc.recordHandler))
+	mux.HandleFunc("/cluster/members", dc.restricted(dc.membersHandler))
+	mux.HandleFunc("/watcher", dc.restricted(dc.watcherHandler))
+	mux.HandleFunc("/hits", dc.restricted(dc.hitsHandler))
+	return mux
 }
@@ -18,6 +18,34 @@ func TestDockerClusterName(t *testing.T) {
 	}
 }
 
+func TestDockerClusterReady(t *testing.T) {
+	dw := NewDockerWatcher("unix:///var/run/docker.sock", "192.168.1.100", nil, NewRecords())
+	nas := dw.AddDaemon(DockerDaemon{Host: "tcp://nas:2376"})
+	dc := &DockerCluster{Records: dw.records, Watcher: dw}
+
+	if dc.Ready() {
+		t.Error("expected not ready before any sync")
+	}
+	dw.markSynced()
+	if dc.Ready() {
+		t.Error("expected not ready until every daemon was synced")
+	}
+	nas.markSynced()
+	if !dc.Ready() {
+		t.Error("expected ready once every daemon was synced")
+	}
+
+	// With clustering the node must also have caught up with its peers
+	dc.ClusterManager = &ClusterManager{delegate: NewClusterDelegate("node1", dw.records, func() int { return 1 })}
+	if dc.Ready() {
+		t.Error("expected not ready before the cluster join")
+	}
+	dc.ClusterManager.joined.Store(true)
+	if !dc.Ready() {
+		t.Error("expected ready after joining without peers")
+	}
+}
+
 func TestServeDNSFound(t *testing.T) {
 	records := NewRecords()
 	records.Add("test.example.com", "192.168.1.100")
@@ -200,6 +228,464 @@ func TestServeDNSAAAAForUnknownHost(t *testing.T) {
 	}
 }
 
+func TestServeDNSAAAAAnswer(t *testing.T) {
+	records := NewRecords()
+	records.AddEntry("test.example.com", RecordEntry{IP: "192.168.1.100", IPv6: "fd00::100"})
+
+	dc := &DockerCluster{
+		Records: records,
+		TTL:     60,
+		Fall:    fall.F{},
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("test.example.com.", dns.TypeAAAA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	code, err := dc.ServeDNS(context.Background(), rec, req)
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if code != dns.RcodeSuccess {
+		t.Errorf("expected RcodeSuccess, got %d", code)
+	}
+	if rec.Msg == nil || len(rec.Msg.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %v", rec.Msg)
+	}
+	aaaa, ok := rec.Msg.Answer[0].(*dns.AAAA)
+	if !ok {
+		t.Fatal("expected AAAA record")
+	}
+	if !aaaa.AAAA.Equal(net.ParseIP("fd00::100")) {
+		t.Errorf("expected fd00::100, got %s", aaaa.AAAA)
+	}
+	if aaaa.Hdr.Ttl != 60 {
+		t.Errorf("expected TTL 60, got %d", aaaa.Hdr.Ttl)
+	}
+}
+
+func TestServeDNSAAAAEmptyMode(t *testing.T) {
+	records := NewRecords()
+	records.AddEntry("test.example.com", RecordEntry{IP: "192.168.1.100", IPv6: "fd00::100"})
+
+	dc := &DockerCluster{
+		Records:  records,
+		TTL:      60,
+		Fall:     fall.F{},
+		AAAAMode: AAAAEmpty,
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("test.example.com.", dns.TypeAAAA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	code, err := dc.ServeDNS(context.Background(), rec, req)
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if code != dns.RcodeSuccess {
+		t.Errorf("expected RcodeSuccess, got %d", code)
+	}
+	if rec.Msg == nil {
+		t.Fatal("expected response message")
+	}
+	if len(rec.Msg.Answer) != 0 {
+		t.Errorf("expected empty answer in empty AAAA mode, got %d answers", len(rec.Msg.Answer))
+	}
+}
+
+func TestServeDNSAForIPv6OnlyHost(t *testing.T) {
+	// A query for a name with only an IPv6 address is NODATA, not unknown
+	records := NewRecords()
+	records.AddEntry("v6.example.com", RecordEntry{IPv6: "fd00::100"})
+
+	dc := &DockerCluster{
+		Records:       records,
+		TTL:           60,
+		Fall:          fall.F{},
+		UnknownAction: ActionNXDomain,
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("v6.example.com.", dns.TypeA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	code, err := dc.ServeDNS(context.Background(), rec, req)
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if code != dns.RcodeSuccess {
+		t.Errorf("expected RcodeSuccess (NODATA), got %d", code)
+	}
+	if rec.Msg == nil {
+		t.Fatal("expected response message")
+	}
+	if len(rec.Msg.Answer) != 0 {
+		t.Errorf("expected no answers, got %d", len(rec.Msg.Answer))
+	}
+}
+
+func TestServeDNSMultipleOwnersRoundRobin(t *testing.T) {
+	records := NewRecords()
+	records.AddWithMeta("app.example.com", "10.0.0.1", 1000, "node1")
+	records.AddWithMeta("app.example.com", "10.0.0.2", 1000, "node2")
+	records.AddWithMeta("app.example.com", "10.0.0.3", 1000, "node3")
+
+	dc := &DockerCluster{
+		Records: records,
+		TTL:     60,
+	}
+
+	firsts := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("app.example.com.", dns.TypeA)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rec.Msg.Answer) != 3 {
+			t.Fatalf("expected 3 answers, got %d", len(rec.Msg.Answer))
+		}
+		firsts[rec.Msg.Answer[0].(*dns.A).A.String()] = true
+	}
+
+	// Each owner leads the answer once over three queries
+	if len(firsts) != 3 {
+		t.Errorf("expected every owner to be returned first once, got %v", firsts)
+	}
+
+	// Removing one node's entry leaves the other owners
+	records.RemoveWithMeta("app.example.com", 2000, "node2")
+
+	req := new(dns.Msg)
+	req.SetQuestion("app.example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.Msg.Answer) != 2 {
+		t.Fatalf("expected 2 answers after removal, got %d", len(rec.Msg.Answer))
+	}
+	for _, rr := range rec.Msg.Answer {
+		if rr.(*dns.A).A.String() == "10.0.0.2" {
+			t.Error("expected node2's address to be gone")
+		}
+	}
+}
+
+func TestServeDNSWildcard(t *testing.T) {
+	records := NewRecords()
+	records.Add("*.preview.example.com", "192.168.1.50")
+
+	dc := &DockerCluster{
+		Records: records,
+		TTL:     60,
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("feature-x.preview.example.com.", dns.TypeA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.Msg.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %d", len(rec.Msg.Answer))
+	}
+	a := rec.Msg.Answer[0].(*dns.A)
+	if a.Hdr.Name != "feature-x.preview.example.com." {
+		t.Errorf("expected answer for the queried name, got %s", a.Hdr.Name)
+	}
+	if a.A.String() != "192.168.1.50" {
+		t.Errorf("expected 192.168.1.50, got %s", a.A)
+	}
+}
+
+func TestServeDNSPTR(t *testing.T) {
+	records := NewRecords()
+	records.Add("app.example.com", "192.168.1.10")
+	records.Add("api.example.com", "192.168.1.10")
+	records.Add("*.preview.example.com", "192.168.1.10")
+	records.AddEntry("v6.example.com", RecordEntry{IPv6: "2001:db8::10"})
+	records.Add("other.example.com", "192.168.1.20")
+
+	dc := &DockerCluster{
+		Records:      records,
+		Watcher:      &DockerWatcher{hostIP: "192.168.1.10"},
+		TTL:          60,
+		ReverseZones: []string{"in-addr.arpa.", "ip6.arpa."},
+	}
+
+	query := func(name string) *dns.Msg {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypePTR)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return rec.Msg
+	}
+	ptrs := func(m *dns.Msg) []string {
+		var names []string
+		for _, rr := range m.Answer {
+			names = append(names, rr.(*dns.PTR).Ptr)
+		}
+		return names
+	}
+
+	// Every non-wildcard name sharing the IP is returned
+	m := query("10.1.168.192.in-addr.arpa.")
+	if got := ptrs(m); !equalSlice(got, []string{"api.example.com.", "app.example.com."}) {
+		t.Errorf("expected both names, got %v", got)
+	}
+
+	m = query(mustReverse(t, "2001:db8::10"))
+	if got := ptrs(m); !equalSlice(got, []string{"v6.example.com."}) {
+		t.Errorf("expected v6.example.com., got %v", got)
+	}
+
+	// A canonical name replaces the list for the host IP only
+	dc.ReverseCanonical = "docker-host.example.com"
+	if got := ptrs(query("10.1.168.192.in-addr.arpa.")); !equalSlice(got, []string{"docker-host.example.com."}) {
+		t.Errorf("expected canonical name, got %v", got)
+	}
+	if got := ptrs(query("20.1.168.192.in-addr.arpa.")); !equalSlice(got, []string{"other.example.com."}) {
+		t.Errorf("expected other.example.com., got %v", got)
+	}
+
+	// Inside the reverse zones unknown addresses are handled like unknown names
+	if m := query("99.1.168.192.in-addr.arpa."); m != nil {
+		t.Errorf("expected no answer for an unknown address, got %v", m)
+	}
+}
+
+func TestServeDNSPTROutsideReverseZones(t *testing.T) {
+	records := NewRecords()
+	records.Add("app.example.com", "192.168.1.10")
+	nextCalled := false
+	next := test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		nextCalled = true
+		return dns.RcodeSuccess, nil
+	})
+
+	for _, reverse := range [][]string{{"10.in-addr.arpa."}, nil} {
+		nextCalled = false
+		dc := &DockerCluster{Records: records, TTL: 60, ReverseZones: reverse, Next: next}
+		req := new(dns.Msg)
+		req.SetQuestion("10.1.168.192.in-addr.arpa.", dns.TypePTR)
+		if _, err := dc.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !nextCalled {
+			t.Errorf("reverse zones %v: expected the PTR query to reach the next plugin", reverse)
+		}
+	}
+}
+
+func mustReverse(t *testing.T, ip string) string {
+	t.Helper()
+	name, err := dns.ReverseAddr(ip)
+	if err != nil {
+		t.Fatalf("ReverseAddr(%s): %v", ip, err)
+	}
+	return name
+}
+
+func TestServeDNSSRV(t *testing.T) {
+	records := NewRecords()
+	srv := []SRVPort{{Service: "_http", Proto: "_tcp", Port: 8080}, {Service: "_metrics", Proto: "_tcp", Port: 9100}}
+	records.AddEntryWithMeta("app.example.com", RecordEntry{IP: "10.0.0.1", SRV: srv, Timestamp: 1, NodeID: "node1"})
+	records.AddEntryWithMeta("app.example.com", RecordEntry{IP: "10.0.0.2", SRV: srv, Timestamp: 1, NodeID: "node2"})
+
+	dc := &DockerCluster{
+		Records: records,
+		TTL:     60,
+	}
+
+	query := func(name string) *dns.Msg {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeSRV)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return rec.Msg
+	}
+
+	m := query("_http._tcp.app.example.com.")
+	if len(m.Answer) != 1 {
+		t.Fatalf("expected 1 SRV answer, got %d", len(m.Answer))
+	}
+	rr := m.Answer[0].(*dns.SRV)
+	if rr.Port != 8080 || rr.Target != "app.example.com." {
+		t.Errorf("expected app.example.com.:8080, got %s:%d", rr.Target, rr.Port)
+	}
+	if len(m.Extra) != 2 {
+		t.Errorf("expected glue for both owners, got %d extra records", len(m.Extra))
+	}
+
+	// Known hostname without the service: NODATA
+	m = query("_ldap._tcp.app.example.com.")
+	if m == nil || m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 {
+		t.Errorf("expected NODATA, got %v", m)
+	}
+
+	// Unknown hostname is handled like any unknown name
+	if m := query("_http._tcp.unknown.example.com."); m != nil {
+		t.Errorf("expected no response for unknown hostname, got %v", m)
+	}
+}
+
+func TestServeDNSCNAME(t *testing.T) {
+	records := NewRecords()
+	records.AddEntryWithMeta("app.example.com", RecordEntry{IP: "10.0.0.1", IPv6: "fd00::1", Timestamp: 1, NodeID: "node1"})
+	records.AddEntryWithMeta("www.example.com", RecordEntry{CNAME: "app.example.com", Timestamp: 1, NodeID: "node1"})
+	records.AddEntryWithMeta("alias.example.com", RecordEntry{CNAME: "www.example.com", Timestamp: 1, NodeID: "node1"})
+	records.AddEntryWithMeta("ext.example.com", RecordEntry{CNAME: "upstream.example.net", Timestamp: 1, NodeID: "node1"})
+	records.AddEntryWithMeta("loop1.example.com", RecordEntry{CNAME: "loop2.example.com", Timestamp: 1, NodeID: "node1"})
+	records.AddEntryWithMeta("loop2.example.com", RecordEntry{CNAME: "loop1.example.com", Timestamp: 1, NodeID: "node1"})
+
+	dc := &DockerCluster{
+		Records: records,
+		TTL:     60,
+	}
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rec.Msg == nil {
+			t.Fatalf("expected a response for %s", name)
+		}
+		return rec.Msg
+	}
+
+	// Known target is chased in-plugin
+	m := query("www.example.com.", dns.TypeA)
+	if len(m.Answer) != 2 {
+		t.Fatalf("expected CNAME + A, got %v", m.Answer)
+	}
+	if cname, ok := m.Answer[0].(*dns.CNAME); !ok || cname.Target != "app.example.com." {
+		t.Errorf("expected CNAME to app.example.com., got %v", m.Answer[0])
+	}
+	if a, ok := m.Answer[1].(*dns.A); !ok || a.Hdr.Name != "app.example.com." || a.A.String() != "10.0.0.1" {
+		t.Errorf("expected app.example.com. A 10.0.0.1, got %v", m.Answer[1])
+	}
+
+	// Chains are followed and AAAA chases the same way
+	m = query("alias.example.com.", dns.TypeAAAA)
+	if len(m.Answer) != 3 {
+		t.Fatalf("expected two CNAMEs + AAAA, got %v", m.Answer)
+	}
+	if aaaa, ok := m.Answer[2].(*dns.AAAA); !ok || aaaa.AAAA.String() != "fd00::1" {
+		t.Errorf("expected AAAA fd00::1, got %v", m.Answer[2])
+	}
+
+	// Unknown targets are left to the resolver
+	m = query("ext.example.com.", dns.TypeA)
+	if len(m.Answer) != 1 || m.Answer[0].Header().Rrtype != dns.TypeCNAME {
+		t.Errorf("expected only the CNAME, got %v", m.Answer)
+	}
+
+	// Loops terminate
+	m = query("loop1.example.com.", dns.TypeA)
+	if len(m.Answer) != 2 {
+		t.Errorf("expected loop to stop after two CNAMEs, got %v", m.Answer)
+	}
+
+	// CNAME queries get the alias without chasing
+	m = query("www.example.com.", dns.TypeCNAME)
+	if len(m.Answer) != 1 || m.Answer[0].Header().Rrtype != dns.TypeCNAME {
+		t.Errorf("expected only the CNAME, got %v", m.Answer)
+	}
+
+	// CNAME query for an address record: NODATA
+	m = query("app.example.com.", dns.TypeCNAME)
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 {
+		t.Errorf("expected NODATA, got %v", m)
+	}
+}
+
+func TestServeDNSRecordTTL(t *testing.T) {
+	records := NewRecords()
+	records.AddEntryWithMeta("stable.example.com", RecordEntry{IP: "10.0.0.1", TTL: 3600, Timestamp: 1, NodeID: "node1"})
+	records.AddEntryWithMeta("bluegreen.example.com", RecordEntry{IP: "10.0.0.2", TTL: 5, Timestamp: 1, NodeID: "node1"})
+	records.AddEntryWithMeta("bluegreen.example.com", RecordEntry{IP: "10.0.0.3", Timestamp: 1, NodeID: "node2"})
+	records.AddEntryWithMeta("default.example.com", RecordEntry{IP: "10.0.0.4", Timestamp: 1, NodeID: "node1"})
+
+	dc := &DockerCluster{
+		Records: records,
+		TTL:     60,
+	}
+
+	tests := []struct {
+		name string
+		want uint32
+	}{
+		{"stable.example.com.", 3600},
+		{"bluegreen.example.com.", 5}, // owners share the lowest TTL
+		{"default.example.com.", 60},
+	}
+	for _, tt := range tests {
+		req := new(dns.Msg)
+		req.SetQuestion(tt.name, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rec.Msg == nil || len(rec.Msg.Answer) == 0 {
+			t.Fatalf("%s: expected an answer", tt.name)
+		}
+		for _, rr := range rec.Msg.Answer {
+			if rr.Header().Ttl != tt.want {
+				t.Errorf("%s: expected TTL %d, got %d", tt.name, tt.want, rr.Header().Ttl)
+			}
+		}
+	}
+}
+
+func TestServeDNSAdditionalAddrs(t *testing.T) {
+	records := NewRecords()
+	records.AddEntryWithMeta("web.example.com", RecordEntry{
+		IP:        "192.168.1.11",
+		Addrs:     []string{"192.168.1.12", "fd00::12"},
+		Timestamp: 1,
+		NodeID:    "node1",
+	})
+
+	dc := &DockerCluster{
+		Records: records,
+		TTL:     60,
+	}
+
+	for qtype, want := range map[uint16]int{dns.TypeA: 2, dns.TypeAAAA: 1} {
+		req := new(dns.Msg)
+		req.SetQuestion("web.example.com.", qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rec.Msg == nil || len(rec.Msg.Answer) != want {
+			t.Errorf("%s: expected %d answers, got %v", dns.TypeToString[qtype], want, rec.Msg)
+		}
+	}
+
+	if names := records.LookupAddr("192.168.1.12"); len(names) != 1 || names[0] != "web.example.com" {
+		t.Errorf("expected reverse lookup of an additional address, got %v", names)
+	}
+}
+
 func TestServeDNSCaseInsensitive(t *testing.T) {
 	records := NewRecords()
 	records.Add("test.example.com", "192.168.1.100")
@@ -2,37 +2,138 @@ package dockercluster
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/miekg/dns"
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/events"
+	"github.com/moby/moby/api/types/network"
 	"github.com/moby/moby/client"
 )
 
+// IPMode selects which address a container's DNS records resolve to.
+type IPMode int
+
+const (
+	// IPModeHost answers with the configured host_ip (Traefik host) - default
+	IPModeHost IPMode = iota
+	// IPModeContainer answers with the container's own address on a Docker network
+	IPModeContainer
+)
+
+// HealthMode selects how a container's healthcheck status gates its records.
+type HealthMode int
+
+const (
+	// HealthWithdraw withdraws records while the container is unhealthy - default
+	HealthWithdraw HealthMode = iota
+	// HealthRequire registers records only while the container is healthy
+	HealthRequire
+	// HealthIgnore registers records regardless of health
+	HealthIgnore
+)
+
+// Per-container labels that override the plugin-wide address selection.
+const (
+	// ipModeLabel overrides ip_mode for a single container (host|container).
+	ipModeLabel = "coredns.host.ip_mode"
+	// networkLabel selects the Docker network whose address is used in container mode.
+	networkLabel = "coredns.host.network"
+	// healthModeLabel overrides health_mode for a single container (withdraw|require|ignore).
+	healthModeLabel = "coredns.host.health_mode"
+	// cnameLabel makes the container's hostnames aliases (CNAME) for another name.
+	cnameLabel = "coredns.host.cname"
+	// ttlLabel sets the answer TTL (seconds) of the container's records,
+	// clamped to the plugin's min_ttl/max_ttl.
+	ttlLabel = "coredns.host.ttl"
+	// srvLabel lists SRV records for the container's hostnames (_service._proto:port,...).
+	srvLabel = "coredns.srv"
+	// enableLabel set to false keeps a container out of DNS, including auto_register.
+	enableLabel = "coredns.enable"
+)
+
 // RecordChangeCallback is called when DNS records are added or removed.
-// timestamp is Unix nanoseconds, used for cluster LWW conflict resolution.
-type RecordChangeCallback func(hostname, ip string, added bool, timestamp int64)
+// entry carries the record's addresses (empty on removal) and its Timestamp in
+// Unix nanoseconds, used for cluster LWW conflict resolution.
+type RecordChangeCallback func(hostname string, entry RecordEntry, added bool)
 
 // DockerWatcher monitors Docker container events and updates DNS records.
 type DockerWatcher struct {
 	dockerSocket string
+	tls          DaemonTLS
 	hostIP       string
+	hostIPv6     string
 	labels       []string
 	records      *Records
 	callback     RecordChangeCallback
 
+	// daemons are further Docker endpoints, each followed by its own watcher
+	// (see AddDaemon).
+	daemons []*DockerWatcher
+
+	// ipMode and network control container-mode answers; both can be
+	// overridden per container with ipModeLabel and networkLabel.
+	ipMode  IPMode
+	network string
+
+	// healthMode gates records on the container's healthcheck status;
+	// it can be overridden per container with healthModeLabel.
+	healthMode HealthMode
+
+	// autoRegister generates a hostname for containers without hostname
+	// labels (nil: disabled).
+	autoRegister *template.Template
+
+	// traefik reads hostnames from Traefik router rule labels (nil: disabled).
+	traefik *TraefikLabels
+
+	// nodeName and templateEnv are the {{.Node}} and {{env "VAR"}} values
+	// of hostname templates.
+	nodeName    string
+	templateEnv map[string]string
+
+	// swarmMode publishes Swarm services' labels (manager nodes only);
+	// swarmMu serializes service syncs.
+	swarmMode SwarmMode
+	swarmMu   sync.Mutex
+
+	// minTTL and maxTTL bound ttlLabel values (maxTTL 0: no upper bound).
+	minTTL uint32
+	maxTTL uint32
+
 	client     *client.Client
 	ctx        context.Context
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
 	mu         sync.RWMutex
 	running    bool
-	containers map[string][]string // containerID -> hostnames
+	containers map[string]containerState // containerID -> registered records
+
+	// owners tracks the containers claiming each hostname; it is shared with
+	// the watchers of further daemons.
+	owners *owners
+
+	// synced is closed once the containers were synced for the first time;
+	// lastSync is when they were last synced.
+	synced     chan struct{}
+	syncedOnce sync.Once
+	lastSync   time.Time
+}
+
+// containerState tracks the hostnames a container registered and the
+// record (addresses, SRV ports) they currently carry.
+type containerState struct {
+	hostnames []string
+	entry     RecordEntry
 }
 
 // truncateID safely truncates a container ID for logging.
@@ -51,7 +152,9 @@ func NewDockerWatcher(dockerSocket, hostIP string, labels []string, records *Rec
 		hostIP:       hostIP,
 		labels:       labels,
 		records:      records,
-		containers:   make(map[string][]string),
+		containers:   make(map[string]containerState),
+		owners:       newOwners(records, ConflictLastWins),
+		synced:       make(chan struct{}),
 	}
 }
 
@@ -61,6 +164,9 @@ func (dw *DockerWatcher) SetCallback(cb RecordChangeCallback) {
 	dw.mu.Lock()
 	defer dw.mu.Unlock()
 	dw.callback = cb
+	for _, daemon := range dw.daemons {
+		daemon.SetCallback(cb)
+	}
 }
 
 // Start begins watching Docker for container events.
@@ -77,6 +183,17 @@ func (dw *DockerWatcher) Start(ctx context.Context) error {
 	dw.wg.Add(1)
 	go dw.watchLoop()
 
+	if dw.swarmMode == SwarmNodes {
+		dw.wg.Add(1)
+		go dw.refreshServices()
+	}
+
+	for _, daemon := range dw.daemons {
+		if err := daemon.Start(ctx); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -90,17 +207,16 @@ func (dw *DockerWatcher) Stop() {
 	dw.running = false
 	dw.mu.Unlock()
 
+	for _, daemon := range dw.daemons {
+		daemon.Stop()
+	}
+
 	if dw.cancel != nil {
 		dw.cancel()
 	}
 	dw.wg.Wait()
 
-	dw.mu.Lock()
-	if dw.client != nil {
-		dw.client.Close()
-		dw.client = nil
-	}
-	dw.mu.Unlock()
+	dw.closeClient()
 }
 
 // watchLoop handles connection, syncing, and event watching with exponential backoff.
@@ -119,7 +235,7 @@ func (dw *DockerWatcher) watchLoop() {
 
 		// Connect to Docker
 		if err := dw.connect(); err != nil {
-			log.Errorf("docker-cluster: failed to connect to Docker: %v", err)
+			log.Errorf("docker-cluster: failed to connect to Docker at %s: %v", dw.dockerSocket, err)
 			dw.sleep(backoff)
 			backoff = dw.nextBackoff(backoff, maxBackoff)
 			continue
@@ -130,16 +246,17 @@ func (dw *DockerWatcher) watchLoop() {
 
 		// Sync existing containers
 		if err := dw.syncContainers(); err != nil {
-			log.Errorf("docker-cluster: failed to sync containers: %v", err)
+			log.Errorf("docker-cluster: failed to sync containers from %s: %v", dw.dockerSocket, err)
 			dw.closeClient()
 			dw.sleep(backoff)
 			backoff = dw.nextBackoff(backoff, maxBackoff)
 			continue
 		}
+		dw.markSynced()
 
 		// Watch for events
 		if err := dw.watchEvents(); err != nil {
-			log.Errorf("docker-cluster: event stream error: %v", err)
+			log.Errorf("docker-cluster: event stream error from %s: %v", dw.dockerSocket, err)
 			dw.closeClient()
 			dw.sleep(backoff)
 			backoff = dw.nextBackoff(backoff, maxBackoff)
@@ -148,16 +265,50 @@ func (dw *DockerWatcher) watchLoop() {
 	}
 }
 
-// connect establishes a connection to the Docker daemon.
-func (dw *DockerWatcher) connect() error {
-	var opts []client.Opt
+// markSynced records the first successful container sync.
+func (dw *DockerWatcher) markSynced() {
+	if dw.synced != nil {
+		dw.syncedOnce.Do(func() { close(dw.synced) })
+	}
+}
 
-	if dw.dockerSocket != "" {
-		opts = append(opts, client.WithHost(dw.dockerSocket))
+// waitSynced blocks until the watcher and those of its further daemons have
+// each synced their containers once. Returns false if ctx is done first.
+func (dw *DockerWatcher) waitSynced(ctx context.Context) bool {
+	for _, w := range append([]*DockerWatcher{dw}, dw.daemons...) {
+		if w.synced == nil {
+			continue
+		}
+		select {
+		case <-w.synced:
+		case <-ctx.Done():
+			return false
+		}
 	}
+	return true
+}
+
+// Synced reports whether the watcher and those of its further daemons have
+// each synced their containers once.
+func (dw *DockerWatcher) Synced() bool {
+	for _, w := range append([]*DockerWatcher{dw}, dw.daemons...) {
+		if w.synced == nil {
+			continue
+		}
+		select {
+		case <-w.synced:
+		default:
+			return false
+		}
+	}
+	return true
+}
 
-	cli, err := client.NewClientWithOpts(opts...)
+// connect establishes a connection to the Docker daemon.
+func (dw *DockerWatcher) connect() error {
+	cli, err := client.NewClientWithOpts(dw.clientOpts()...)
 	if err != nil {
+		dockerConnected.WithLabelValues(dw.dockerSocket).Set(0)
 		return err
 	}
 
@@ -165,14 +316,17 @@ func (dw *DockerWatcher) connect() error {
 	_, err = cli.Ping(dw.ctx, client.PingOptions{NegotiateAPIVersion: true})
 	if err != nil {
 		cli.Close()
+		dockerConnected.WithLabelValues(dw.dockerSocket).Set(0)
 		return err
 	}
 
 	dw.mu.Lock()
 	dw.client = cli
 	dw.mu.Unlock()
+	dockerConnected.WithLabelValues(dw.dockerSocket).Set(1)
+	dockerBackoff.WithLabelValues(dw.dockerSocket).Set(0)
 
-	log.Info("docker-cluster: connected to Docker daemon")
+	log.Infof("docker-cluster: connected to Docker daemon at %s", dw.dockerSocket)
 	return nil
 }
 
@@ -185,6 +339,7 @@ func (dw *DockerWatcher) closeClient() {
 		dw.client.Close()
 		dw.client = nil
 	}
+	dockerConnected.WithLabelValues(dw.dockerSocket).Set(0)
 }
 
 // syncContainers fetches all running containers and syncs their DNS records.
@@ -196,6 +351,7 @@ func (dw *DockerWatcher) syncContainers() error {
 	if cli == nil {
 		return nil
 	}
+	start := time.Now()
 
 	// Get all running containers
 	containers, err := cli.ContainerList(dw.ctx, client.ContainerListOptions{
@@ -216,37 +372,44 @@ func (dw *DockerWatcher) syncContainers() error {
 	}
 
 	// Remove containers that no longer exist
-	var removedHostnames []string
-	dw.mu.Lock()
-	for id, hostnames := range dw.containers {
-		if !seen[id] {
-			for _, hostname := range hostnames {
-				dw.records.Remove(hostname)
-				removedHostnames = append(removedHostnames, hostname)
-			}
-			delete(dw.containers, id)
+	var gone []string
+	dw.mu.RLock()
+	for id := range dw.containers {
+		if !seen[id] && !strings.HasPrefix(id, serviceKeyPrefix) {
+			gone = append(gone, id)
 		}
 	}
+	dw.mu.RUnlock()
+	for _, id := range gone {
+		dw.removeContainer(id)
+	}
+
+	syncDuration.WithLabelValues(dw.dockerSocket).Observe(time.Since(start).Seconds())
+	dw.mu.Lock()
+	dw.lastSync = time.Now()
 	dw.mu.Unlock()
+	log.Infof("docker-cluster: synced %d containers with DNS records from %s", len(seen), dw.dockerSocket)
 
-	// Invoke callback for removed hostnames outside of lock
-	if len(removedHostnames) > 0 {
-		dw.mu.RLock()
-		cb := dw.callback
-		dw.mu.RUnlock()
-		if cb != nil {
-			ts := time.Now().UnixNano()
-			for _, hostname := range removedHostnames {
-				cb(hostname, "", false, ts)
-			}
+	// A failed service sync (e.g. not a manager) doesn't stop container records
+	if dw.swarmMode != SwarmOff {
+		if err := dw.syncServices(); err != nil {
+			log.Warningf("docker-cluster: failed to sync swarm services: %v", err)
 		}
 	}
-
-	log.Infof("docker-cluster: synced %d containers with DNS records", len(seen))
 	dw.logCurrentState()
 	return nil
 }
 
+// watchedEvents are the actions handled for each Docker event type:
+// container lifecycle, pause, rename and health events; network
+// connect/disconnect, so container-mode records follow the container's
+// address; and, in Swarm mode, service changes, which re-sync the services.
+var watchedEvents = map[events.Type][]string{
+	events.ContainerEventType: {"start", "stop", "die", "kill", "destroy", "pause", "unpause", "rename", string(events.ActionHealthStatus)},
+	events.NetworkEventType:   {"connect", "disconnect"},
+	events.ServiceEventType:   {"create", "update", "remove"},
+}
+
 // watchEvents subscribes to Docker events and processes container start/stop events.
 func (dw *DockerWatcher) watchEvents() error {
 	dw.mu.RLock()
@@ -257,16 +420,19 @@ func (dw *DockerWatcher) watchEvents() error {
 		return nil
 	}
 
-	// Subscribe to container events
-	eventFilter := make(client.Filters).
-		Add("type", "container").
-		Add("event", "start", "stop", "die")
+	eventFilter := make(client.Filters)
+	for eventType, actions := range watchedEvents {
+		if eventType == events.ServiceEventType && dw.swarmMode == SwarmOff {
+			continue
+		}
+		eventFilter.Add("type", string(eventType)).Add("event", actions...)
+	}
 
 	result := cli.Events(dw.ctx, client.EventsListOptions{
 		Filters: eventFilter,
 	})
 
-	log.Info("docker-cluster: watching for container events")
+	log.Infof("docker-cluster: watching for container events from %s", dw.dockerSocket)
 	return consumeEvents(dw.ctx, result.Messages, result.Err, dw.handleEvent)
 }
 
@@ -294,11 +460,45 @@ func consumeEvents(ctx context.Context, messages <-chan events.Message, errs <-c
 
 // handleEvent processes a single Docker event.
 func (dw *DockerWatcher) handleEvent(event events.Message) {
+	// Health events carry the status after a colon; count them as one action
+	action, _, _ := strings.Cut(string(event.Action), ":")
+
+	// Docker ORs the values of a filter key, so the subscription also delivers
+	// other types' actions, such as network destroy or container update
+	if !slices.Contains(watchedEvents[event.Type], action) {
+		return
+	}
+	dockerEventsTotal.WithLabelValues(string(event.Type), action).Inc()
+
+	if event.Type == events.ServiceEventType {
+		if err := dw.syncServices(); err != nil {
+			log.Warningf("docker-cluster: failed to sync swarm services: %v", err)
+		}
+		return
+	}
+
 	switch event.Action {
 	case "start":
 		dw.handleContainerStart(event.Actor.ID)
 	case "stop", "die":
 		dw.handleContainerStop(event.Actor.ID)
+	case "destroy":
+		// Removal guarantees cleanup even if the stop event was missed
+		dw.withdrawContainer(event.Actor.ID, "removed")
+	case "pause":
+		dw.withdrawContainer(event.Actor.ID, "paused")
+	case "unpause", "rename", "kill":
+		// Unpaused containers are registered again, renamed ones re-evaluated;
+		// a kill signal does not necessarily stop the container
+		dw.handleContainerChange(event.Actor.ID)
+	case "connect", "disconnect":
+		// Network events carry the network as the actor; the container is an attribute
+		dw.handleContainerChange(event.Actor.Attributes["container"])
+	default:
+		// Health events carry the new status, e.g. "health_status: unhealthy"
+		if strings.HasPrefix(string(event.Action), string(events.ActionHealthStatus)) {
+			dw.handleContainerChange(event.Actor.ID)
+		}
 	}
 }
 
@@ -326,116 +526,447 @@ func (dw *DockerWatcher) handleContainerStart(containerID string) {
 	}
 }
 
+// handleContainerChange re-evaluates a container's records after it is
+// connected to or disconnected from a network, its health status changes, it
+// is unpaused, renamed or sent a signal. Records of containers that are no
+// longer running, or paused, are withdrawn.
+func (dw *DockerWatcher) handleContainerChange(containerID string) {
+	if containerID == "" {
+		return
+	}
+
+	dw.mu.RLock()
+	cli := dw.client
+	dw.mu.RUnlock()
+
+	if cli == nil {
+		return
+	}
+
+	info, err := cli.ContainerInspect(dw.ctx, containerID, client.ContainerInspectOptions{})
+	if err != nil {
+		// The container may already be gone; its stop/die event handles cleanup
+		log.Debugf("docker-cluster: failed to inspect container %s after change: %v", truncateID(containerID, 12), err)
+		return
+	}
+
+	// Containers are connected to their networks before they start and
+	// disconnected after they die; only running, unpaused containers are registered
+	if reason := inactiveReason(info.Container.State); reason != "" {
+		dw.withdrawContainer(containerID, reason)
+		return
+	}
+
+	dw.applyContainerInspect(containerID, info.Container)
+}
+
 // applyContainerSummary adds records from a container-list summary.
+// Returns false if the container has no records, e.g. because it is unhealthy.
 func (dw *DockerWatcher) applyContainerSummary(summary container.Summary) bool {
-	hostnames := dw.extractHostnames(summary.Labels)
+	var name string
+	if len(summary.Names) > 0 {
+		name = strings.TrimPrefix(summary.Names[0], "/")
+	}
+	hostnames := dw.containerHostnames(name, summary.Labels)
 	if len(hostnames) == 0 {
 		return false
 	}
-	dw.updateContainer(summary.ID, hostnames)
+	if status := summaryHealth(summary); !dw.healthAllows(summary.ID, summary.Labels, status) {
+		log.Debugf("docker-cluster: container %s is %s, not registering hostnames", truncateID(summary.ID, 12), status)
+		return false
+	}
+	var networks map[string]*network.EndpointSettings
+	if summary.NetworkSettings != nil {
+		networks = summary.NetworkSettings.Networks
+	}
+	entry, ok := dw.containerRecord(summary.ID, summary.Labels, networks)
+	if !ok {
+		return false
+	}
+	entry.Container = &ContainerInfo{ID: summary.ID, Name: name, Image: summary.Image}
+	dw.updateContainer(summary.ID, hostnames, entry)
 	return true
 }
 
 // applyContainerInspect adds records from a container-inspect response.
+// A container whose address cannot be resolved or whose health status fails
+// the health mode has its records withdrawn.
 func (dw *DockerWatcher) applyContainerInspect(containerID string, info container.InspectResponse) []string {
 	if info.Config == nil {
 		return nil
 	}
-	hostnames := dw.extractHostnames(info.Config.Labels)
-	if len(hostnames) > 0 {
-		dw.updateContainer(containerID, hostnames)
+	hostnames := dw.containerHostnames(info.Name, info.Config.Labels)
+	if len(hostnames) == 0 {
+		return nil
+	}
+	if status := inspectHealth(info); !dw.healthAllows(containerID, info.Config.Labels, status) {
+		dw.withdrawContainer(containerID, "is "+string(status))
+		return nil
+	}
+	var networks map[string]*network.EndpointSettings
+	if info.NetworkSettings != nil {
+		networks = info.NetworkSettings.Networks
+	}
+	entry, ok := dw.containerRecord(containerID, info.Config.Labels, networks)
+	if !ok {
+		dw.withdrawContainer(containerID, "lost its address")
+		return nil
 	}
+	entry.Container = &ContainerInfo{ID: containerID, Name: strings.TrimPrefix(info.Name, "/"), Image: info.Config.Image}
+	dw.updateContainer(containerID, hostnames, entry)
 	return hostnames
 }
 
-// handleContainerStop processes a container stop or die event.
-func (dw *DockerWatcher) handleContainerStop(containerID string) {
-	dw.mu.Lock()
-	hostnames, exists := dw.containers[containerID]
-	if exists {
-		delete(dw.containers, containerID)
+// containerRecord builds the record a container's hostnames carry from its
+// labels and network endpoints: a CNAME if cnameLabel is set, otherwise its
+// addresses. Returns false if the container has no usable address yet.
+func (dw *DockerWatcher) containerRecord(containerID string, labels map[string]string, networks map[string]*network.EndpointSettings) (RecordEntry, bool) {
+	entry := dw.labelRecord("container "+truncateID(containerID, 12), labels)
+	if entry.CNAME == "" {
+		entry.IP, entry.IPv6 = dw.resolveAddrs(containerID, labels, networks)
+		if entry.IP == "" && entry.IPv6 == "" {
+			return RecordEntry{}, false
+		}
 	}
-	dw.mu.Unlock()
+	return entry, true
+}
 
-	if exists {
-		for _, hostname := range hostnames {
-			dw.records.Remove(hostname)
-		}
-
-		// Invoke callback outside of lock
-		dw.mu.RLock()
-		cb := dw.callback
-		dw.mu.RUnlock()
-		if cb != nil {
-			ts := time.Now().UnixNano()
-			for _, hostname := range hostnames {
-				cb(hostname, "", false, ts)
-			}
+// labelRecord builds the parts of a record that come from labels alone: the
+// CNAME target, TTL and SRV ports. Invalid values are logged and ignored;
+// source names the labeled container or service in log messages.
+func (dw *DockerWatcher) labelRecord(source string, labels map[string]string) RecordEntry {
+	var entry RecordEntry
+	if value := strings.TrimSpace(labels[cnameLabel]); value != "" {
+		target := strings.ToLower(strings.TrimSuffix(value, "."))
+		if isValidHostname(target) {
+			entry.CNAME = target
+		} else {
+			log.Warningf("docker-cluster: ignoring invalid %s label %q on %s", cnameLabel, value, source)
+		}
+	}
+
+	if value, ok := labels[ttlLabel]; ok {
+		ttl, err := dw.parseTTLLabel(value)
+		if err != nil {
+			log.Warningf("docker-cluster: ignoring invalid %s label %q on %s: %v", ttlLabel, value, source, err)
+		} else {
+			entry.TTL = ttl
+		}
+	}
+
+	if value, ok := labels[srvLabel]; ok {
+		srv, err := parseSRVLabel(value)
+		if err != nil {
+			log.Warningf("docker-cluster: ignoring invalid %s label %q on %s: %v", srvLabel, value, source, err)
+		} else {
+			entry.SRV = srv
 		}
+	}
+	return entry
+}
 
-		log.Infof("docker-cluster: container %s stopped, removed hostnames: %v", truncateID(containerID, 12), hostnames)
+// parseTTLLabel parses a ttlLabel value in seconds and clamps it to the
+// configured bounds.
+func (dw *DockerWatcher) parseTTLLabel(value string) (uint32, error) {
+	parsed, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("not a number of seconds")
+	}
+	ttl := uint32(parsed)
+	if ttl == 0 {
+		return 0, fmt.Errorf("must be at least 1 second")
+	}
+	if ttl < dw.minTTL {
+		ttl = dw.minTTL
+	}
+	if dw.maxTTL != 0 && ttl > dw.maxTTL {
+		ttl = dw.maxTTL
+	}
+	return ttl, nil
+}
+
+// resolveAddrs returns the IPv4 and IPv6 addresses a container's records should
+// resolve to. In host mode these are always the configured host IPs. In container
+// mode they are the container's addresses on the selected network, or on the
+// first attached network (by name) when none is selected. Returns empty strings
+// if the container has no usable address yet; a later network connect event
+// re-evaluates it.
+func (dw *DockerWatcher) resolveAddrs(containerID string, labels map[string]string, networks map[string]*network.EndpointSettings) (ip, ipv6 string) {
+	mode := dw.ipMode
+	if value, ok := labels[ipModeLabel]; ok {
+		parsed, err := parseIPMode(value)
+		if err != nil {
+			log.Warningf("docker-cluster: ignoring invalid %s label %q on container %s", ipModeLabel, value, truncateID(containerID, 12))
+		} else {
+			mode = parsed
+		}
+	}
+	if mode == IPModeHost {
+		return dw.hostIP, dw.hostIPv6
+	}
+
+	networkName := dw.network
+	if value := strings.TrimSpace(labels[networkLabel]); value != "" {
+		networkName = value
+	}
+
+	if networkName != "" {
+		if ip, ipv6 = endpointAddrs(networks[networkName]); ip != "" || ipv6 != "" {
+			return ip, ipv6
+		}
+		log.Warningf("docker-cluster: container %s has no address on network %q, not registering", truncateID(containerID, 12), networkName)
+		return "", ""
+	}
+
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip, ipv6 = endpointAddrs(networks[name]); ip != "" || ipv6 != "" {
+			return ip, ipv6
+		}
+	}
+	log.Warningf("docker-cluster: container %s has no network address, not registering", truncateID(containerID, 12))
+	return "", ""
+}
+
+// endpointAddrs returns the IPv4 and global IPv6 addresses of a network endpoint.
+func endpointAddrs(ep *network.EndpointSettings) (ip, ipv6 string) {
+	if ep == nil {
+		return "", ""
+	}
+	if ep.IPAddress.IsValid() {
+		ip = ep.IPAddress.String()
+	}
+	if ep.GlobalIPv6Address.IsValid() {
+		ipv6 = ep.GlobalIPv6Address.String()
+	}
+	return ip, ipv6
+}
+
+// parseSRVLabel parses a comma-separated list of _service._proto:port entries,
+// e.g. "_http._tcp:8080,_metrics._tcp:9100".
+func parseSRVLabel(value string) ([]SRVPort, error) {
+	var ports []SRVPort
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		name, portStr, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q: expected _service._proto:port", part)
+		}
+		service, proto, ok := strings.Cut(name, ".")
+		if !ok || !isValidServiceLabel(service) || (proto != "_tcp" && proto != "_udp") {
+			return nil, fmt.Errorf("%q: expected _service._tcp or _service._udp", part)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("%q: invalid port", part)
+		}
+		ports = append(ports, SRVPort{Service: service, Proto: proto, Port: uint16(port)})
+	}
+	return ports, nil
+}
+
+// isValidServiceLabel returns true if s is an underscore-prefixed service name
+// such as "_http" (RFC 6335: letters, digits and inner hyphens, at most 15 chars).
+func isValidServiceLabel(s string) bool {
+	name, ok := strings.CutPrefix(s, "_")
+	if !ok || len(name) == 0 || len(name) > 15 || name[0] == '-' || name[len(name)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// healthAllows reports whether a container with the given health status may
+// register records under the plugin's health mode or its healthModeLabel.
+// Containers without a healthcheck are always allowed.
+func (dw *DockerWatcher) healthAllows(containerID string, labels map[string]string, status container.HealthStatus) bool {
+	mode := dw.healthMode
+	if value, ok := labels[healthModeLabel]; ok {
+		parsed, err := parseHealthMode(value)
+		if err != nil {
+			log.Warningf("docker-cluster: ignoring invalid %s label %q on container %s", healthModeLabel, value, truncateID(containerID, 12))
+		} else {
+			mode = parsed
+		}
+	}
+
+	switch mode {
+	case HealthIgnore:
+		return true
+	case HealthRequire:
+		return status == "" || status == container.NoHealthcheck || status == container.Healthy
+	default:
+		return status != container.Unhealthy
+	}
+}
+
+// summaryHealth returns the health status of a container-list summary.
+func summaryHealth(summary container.Summary) container.HealthStatus {
+	if summary.Health != nil {
+		return summary.Health.Status
+	}
+	// Older daemons only report health in the status text, e.g. "Up 5 minutes (unhealthy)"
+	switch {
+	case strings.Contains(summary.Status, "(unhealthy)"):
+		return container.Unhealthy
+	case strings.Contains(summary.Status, "(health: starting)"):
+		return container.Starting
+	case strings.Contains(summary.Status, "(healthy)"):
+		return container.Healthy
+	}
+	return ""
+}
+
+// inspectHealth returns the health status of a container-inspect response.
+func inspectHealth(info container.InspectResponse) container.HealthStatus {
+	if info.State == nil || info.State.Health == nil {
+		return ""
+	}
+	return info.State.Health.Status
+}
+
+// parseHealthMode converts a string to HealthMode.
+func parseHealthMode(s string) (HealthMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "withdraw":
+		return HealthWithdraw, nil
+	case "require":
+		return HealthRequire, nil
+	case "ignore":
+		return HealthIgnore, nil
+	default:
+		return HealthWithdraw, fmt.Errorf("unknown health mode: %s", s)
+	}
+}
+
+// parseIPMode converts a string to IPMode.
+func parseIPMode(s string) (IPMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "host":
+		return IPModeHost, nil
+	case "container":
+		return IPModeContainer, nil
+	default:
+		return IPModeHost, fmt.Errorf("unknown ip mode: %s", s)
+	}
+}
+
+// handleContainerStop processes a container stop or die event.
+func (dw *DockerWatcher) handleContainerStop(containerID string) {
+	dw.withdrawContainer(containerID, "stopped")
+}
+
+// inactiveReason returns why a container in state must not have records
+// ("not running" or "paused"), or "" if it may.
+func inactiveReason(state *container.State) string {
+	switch {
+	case state == nil || !state.Running:
+		return "not running"
+	case state.Paused:
+		return "paused"
+	}
+	return ""
+}
+
+// withdrawContainer removes a container's records, logging why.
+func (dw *DockerWatcher) withdrawContainer(containerID, reason string) {
+	if hostnames := dw.removeContainer(containerID); len(hostnames) > 0 {
+		log.Infof("docker-cluster: container %s %s, removed hostnames: %v", truncateID(containerID, 12), reason, hostnames)
 		dw.logCurrentState()
 	}
 }
 
-// updateContainer updates the DNS records for a container.
-func (dw *DockerWatcher) updateContainer(containerID string, newHostnames []string) {
+// removeContainer releases a container's hostnames and stops tracking it.
+// Returns the hostnames whose records were removed, i.e. those no other
+// container claims (nil if it was not tracked).
+func (dw *DockerWatcher) removeContainer(containerID string) []string {
+	owners := dw.hostnameOwners()
+
 	dw.mu.Lock()
-	oldHostnames := dw.containers[containerID]
-	dw.containers[containerID] = newHostnames
+	state, exists := dw.containers[containerID]
+	if exists {
+		delete(dw.containers, containerID)
+	}
 	dw.mu.Unlock()
 
-	// Build sets for comparison
-	oldSet := make(map[string]bool)
-	for _, h := range oldHostnames {
-		oldSet[h] = true
+	if !exists {
+		return nil
 	}
 
-	newSet := make(map[string]bool)
-	for _, h := range newHostnames {
-		newSet[h] = true
-	}
+	changes := owners.update(dw.dockerSocket, containerID, state.hostnames, nil, RecordEntry{})
+	dw.notify(changes)
 
-	// Track removed and added hostnames for callback
 	var removed []string
-	var added []string
-
-	// Remove old hostnames not in new set
-	for _, h := range oldHostnames {
-		if !newSet[h] {
-			dw.records.Remove(h)
-			removed = append(removed, h)
+	for _, change := range changes {
+		if !change.added {
+			removed = append(removed, change.hostname)
 		}
 	}
+	return removed
+}
 
-	// Add new hostnames
-	for _, h := range newHostnames {
-		if !oldSet[h] {
-			dw.records.Add(h, dw.hostIP)
-			added = append(added, h)
-		}
+// updateContainer sets the hostnames a container claims and the record they
+// carry. Which claimant's record a hostname serves is up to the conflict
+// policy (see owners).
+func (dw *DockerWatcher) updateContainer(containerID string, newHostnames []string, entry RecordEntry) {
+	owners := dw.hostnameOwners()
+
+	dw.mu.Lock()
+	old := dw.containers[containerID]
+	dw.containers[containerID] = containerState{hostnames: newHostnames, entry: entry}
+	dw.mu.Unlock()
+
+	dw.notify(owners.update(dw.dockerSocket, containerID, old.hostnames, newHostnames, entry))
+}
+
+// hostnameOwners returns the ownership index, creating one if the watcher
+// was not built by NewDockerWatcher.
+func (dw *DockerWatcher) hostnameOwners() *owners {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.owners == nil {
+		dw.owners = newOwners(dw.records, ConflictLastWins)
 	}
+	return dw.owners
+}
 
-	// Invoke callback outside of lock
+// notify reports record changes to the callback.
+func (dw *DockerWatcher) notify(changes []recordChange) {
 	dw.mu.RLock()
 	cb := dw.callback
 	dw.mu.RUnlock()
-	if cb != nil {
-		ts := time.Now().UnixNano()
-		for _, h := range removed {
-			cb(h, "", false, ts)
-		}
-		for _, h := range added {
-			cb(h, dw.hostIP, true, ts)
-		}
+	if cb == nil {
+		return
 	}
+	for _, change := range changes {
+		cb(change.hostname, change.entry, change.added)
+	}
+}
+
+// Conflicts lists the hostnames claimed by more than one local container.
+func (dw *DockerWatcher) Conflicts() []HostnameConflict {
+	return dw.hostnameOwners().conflicts()
 }
 
-// extractHostnames extracts hostnames from container labels.
+// extractHostnames extracts hostnames from container labels, expanding
+// template placeholders ({{.Name}}, {{env "DOMAIN"}}) with data first.
 // Label values are container-controlled, so each candidate is validated as a
-// DNS name and bounded to RFC 1035's 253-byte limit before being trusted.
+// DNS name (or a "*.suffix" wildcard) and bounded to RFC 1035's 253-byte limit
+// before being trusted.
 // Invalid entries are dropped with a warning rather than served as records.
-func (dw *DockerWatcher) extractHostnames(labels map[string]string) []string {
+func (dw *DockerWatcher) extractHostnames(labels map[string]string, data hostnameData) []string {
 	var hostnames []string
 	seen := make(map[string]bool)
 
@@ -444,12 +975,17 @@ func (dw *DockerWatcher) extractHostnames(labels map[string]string) []string {
 		if !ok {
 			continue
 		}
+		value, err := dw.expandLabel(value, data)
+		if err != nil {
+			log.Warningf("docker-cluster: ignoring label %s of %s: %v", labelName, data.Name, err)
+			continue
+		}
 		for _, part := range strings.Split(value, ",") {
 			hostname := strings.TrimSpace(part)
 			if hostname == "" || seen[hostname] {
 				continue
 			}
-			if !isValidHostname(hostname) {
+			if !isValidHostname(hostname) && !isValidWildcard(hostname) {
 				log.Warningf("docker-cluster: ignoring invalid hostname %q from label %s", hostname, labelName)
 				continue
 			}
@@ -461,6 +997,14 @@ func (dw *DockerWatcher) extractHostnames(labels map[string]string) []string {
 	return hostnames
 }
 
+// isValidWildcard returns true if name is a wildcard ("*.suffix") whose
+// suffix is a valid hostname. The asterisk is only allowed as the whole
+// leftmost label.
+func isValidWildcard(name string) bool {
+	suffix, ok := strings.CutPrefix(name, "*.")
+	return ok && len(name) <= 253 && isValidHostname(suffix)
+}
+
 // isValidHostname returns true if name is a syntactically valid DNS name
 // of acceptable length and contains only RFC 1035 hostname characters
 // (letters, digits, hyphen, dot). miekg/dns.IsDomainName tolerates some
@@ -486,6 +1030,8 @@ func isValidHostname(name string) bool {
 
 // sleep waits for the specified duration or until context is cancelled.
 func (dw *DockerWatcher) sleep(d time.Duration) {
+	dockerBackoff.WithLabelValues(dw.dockerSocket).Set(d.Seconds())
+	dockerReconnectsTotal.WithLabelValues(dw.dockerSocket).Inc()
 	select {
 	case <-time.After(d):
 	case <-dw.ctx.Done():
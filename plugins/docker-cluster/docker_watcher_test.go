@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net/netip"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/events"
+	"github.com/moby/moby/api/types/network"
 )
 
 func TestExtractHostnamesValidation(t *testing.T) {
@@ -64,11 +67,21 @@ func TestExtractHostnamesValidation(t *testing.T) {
 			labels: map[string]string{"coredns.host.name": "good.example.com,bad host"},
 			want:   []string{"good.example.com"},
 		},
+		{
+			name:   "wildcard accepted",
+			labels: map[string]string{"coredns.host.name": "*.preview.example.com"},
+			want:   []string{"*.preview.example.com"},
+		},
+		{
+			name:   "wildcard only as whole leftmost label",
+			labels: map[string]string{"coredns.host.name": "a.*.example.com,*app.example.com,*,*.*.example.com"},
+			want:   nil,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := dw.extractHostnames(tc.labels)
+			got := dw.extractHostnames(tc.labels, hostnameData{})
 			if !equalSlice(got, tc.want) {
 				t.Errorf("extractHostnames(%v) = %v, want %v", tc.labels, got, tc.want)
 			}
@@ -81,7 +94,7 @@ func TestApplyContainerResults(t *testing.T) {
 		hostIP:     "192.168.1.100",
 		labels:     []string{"coredns.host.name"},
 		records:    NewRecords(),
-		containers: make(map[string][]string),
+		containers: make(map[string]containerState),
 	}
 
 	if !dw.applyContainerSummary(container.Summary{
@@ -165,16 +178,16 @@ func TestConsumeEventsStopsOnContextCancellation(t *testing.T) {
 }
 
 func TestHandleEventRemovesStoppedContainers(t *testing.T) {
-	for _, action := range []events.Action{"stop", "die"} {
+	for _, action := range []events.Action{"stop", "die", "destroy", "pause"} {
 		t.Run(string(action), func(t *testing.T) {
 			dw := &DockerWatcher{
 				hostIP:     "192.168.1.100",
 				records:    NewRecords(),
-				containers: map[string][]string{"container-id": {"app.example.com"}},
+				containers: make(map[string]containerState),
 			}
-			dw.records.Add("app.example.com", dw.hostIP)
+			dw.updateContainer("container-id", []string{"app.example.com"}, RecordEntry{IP: dw.hostIP})
 
-			dw.handleEvent(events.Message{Action: action, Actor: events.Actor{ID: "container-id"}})
+			dw.handleEvent(events.Message{Type: events.ContainerEventType, Action: action, Actor: events.Actor{ID: "container-id"}})
 
 			if _, ok := dw.records.Lookup("app.example.com"); ok {
 				t.Fatal("record still exists after stop event")
@@ -186,6 +199,162 @@ func TestHandleEventRemovesStoppedContainers(t *testing.T) {
 	}
 }
 
+func TestHandleEventIgnoresOtherTypesActions(t *testing.T) {
+	dw := &DockerWatcher{
+		hostIP:     "192.168.1.100",
+		records:    NewRecords(),
+		containers: map[string]containerState{"container-id": {hostnames: []string{"app.example.com"}, entry: RecordEntry{IP: "192.168.1.100"}}},
+	}
+	dw.records.Add("app.example.com", dw.hostIP)
+
+	// Delivered because another type subscribes to the action
+	for _, event := range []events.Message{
+		{Type: events.NetworkEventType, Action: "destroy", Actor: events.Actor{ID: "container-id"}},
+		{Type: events.ContainerEventType, Action: "remove", Actor: events.Actor{ID: "container-id"}},
+		{Type: events.ServiceEventType, Action: "stop", Actor: events.Actor{ID: "container-id"}},
+	} {
+		dw.handleEvent(event)
+	}
+
+	if _, ok := dw.records.Lookup("app.example.com"); !ok {
+		t.Error("expected events of other types' actions to be ignored")
+	}
+}
+
+func TestResolveAddrs(t *testing.T) {
+	networks := map[string]*network.EndpointSettings{
+		"frontend": {IPAddress: netip.MustParseAddr("172.20.0.5")},
+		"backend":  {IPAddress: netip.MustParseAddr("172.21.0.7")},
+		"pending":  {},
+	}
+
+	tests := []struct {
+		name    string
+		mode    IPMode
+		network string
+		labels  map[string]string
+		want    string
+	}{
+		{name: "host mode", mode: IPModeHost, want: "192.168.1.100"},
+		{name: "container mode first network by name", mode: IPModeContainer, want: "172.21.0.7"},
+		{name: "container mode configured network", mode: IPModeContainer, network: "frontend", want: "172.20.0.5"},
+		{name: "container mode missing network", mode: IPModeContainer, network: "other", want: ""},
+		{name: "container mode network without address", mode: IPModeContainer, network: "pending", want: ""},
+		{
+			name:   "label selects container mode",
+			mode:   IPModeHost,
+			labels: map[string]string{ipModeLabel: "container", networkLabel: "frontend"},
+			want:   "172.20.0.5",
+		},
+		{
+			name:   "label selects host mode",
+			mode:   IPModeContainer,
+			labels: map[string]string{ipModeLabel: "host"},
+			want:   "192.168.1.100",
+		},
+		{
+			name:   "invalid label falls back to plugin mode",
+			mode:   IPModeHost,
+			labels: map[string]string{ipModeLabel: "bogus"},
+			want:   "192.168.1.100",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dw := &DockerWatcher{hostIP: "192.168.1.100", ipMode: tc.mode, network: tc.network}
+			if got, _ := dw.resolveAddrs("container-id", tc.labels, networks); got != tc.want {
+				t.Errorf("resolveAddrs() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveAddrsIPv6(t *testing.T) {
+	networks := map[string]*network.EndpointSettings{
+		"dualstack": {
+			IPAddress:         netip.MustParseAddr("172.20.0.5"),
+			GlobalIPv6Address: netip.MustParseAddr("fd00:20::5"),
+		},
+		"v6only": {GlobalIPv6Address: netip.MustParseAddr("fd00:30::7")},
+	}
+
+	dw := &DockerWatcher{hostIP: "192.168.1.100", hostIPv6: "fd00::100"}
+	if ip, ipv6 := dw.resolveAddrs("container-id", nil, networks); ip != "192.168.1.100" || ipv6 != "fd00::100" {
+		t.Errorf("host mode = %q, %q; want 192.168.1.100, fd00::100", ip, ipv6)
+	}
+
+	dw.ipMode = IPModeContainer
+	dw.network = "dualstack"
+	if ip, ipv6 := dw.resolveAddrs("container-id", nil, networks); ip != "172.20.0.5" || ipv6 != "fd00:20::5" {
+		t.Errorf("dual-stack network = %q, %q; want 172.20.0.5, fd00:20::5", ip, ipv6)
+	}
+
+	dw.network = "v6only"
+	if ip, ipv6 := dw.resolveAddrs("container-id", nil, networks); ip != "" || ipv6 != "fd00:30::7" {
+		t.Errorf("IPv6-only network = %q, %q; want \"\", fd00:30::7", ip, ipv6)
+	}
+}
+
+func TestApplyContainerInspectFollowsContainerAddress(t *testing.T) {
+	dw := &DockerWatcher{
+		hostIP:     "192.168.1.100",
+		labels:     []string{"coredns.host.name"},
+		records:    NewRecords(),
+		containers: make(map[string]containerState),
+		ipMode:     IPModeContainer,
+		network:    "macvlan",
+	}
+
+	var changes []string
+	dw.callback = func(hostname string, entry RecordEntry, added bool) {
+		if added {
+			changes = append(changes, "+"+hostname+"="+entry.IP)
+		} else {
+			changes = append(changes, "-"+hostname)
+		}
+	}
+
+	inspect := func(addr string) container.InspectResponse {
+		networks := map[string]*network.EndpointSettings{}
+		if addr != "" {
+			networks["macvlan"] = &network.EndpointSettings{IPAddress: netip.MustParseAddr(addr)}
+		}
+		return container.InspectResponse{
+			Config:          &container.Config{Labels: map[string]string{"coredns.host.name": "app.example.com"}},
+			NetworkSettings: &container.NetworkSettings{Networks: networks},
+		}
+	}
+
+	dw.applyContainerInspect("container-id", inspect("10.0.0.5"))
+	if got, ok := dw.records.Lookup("app.example.com"); !ok || got != "10.0.0.5" {
+		t.Fatalf("record = %q, %v; want 10.0.0.5, true", got, ok)
+	}
+
+	// Re-inspect with the same address is a no-op
+	dw.applyContainerInspect("container-id", inspect("10.0.0.5"))
+
+	// Reconnected with a new address: the record follows the container
+	dw.applyContainerInspect("container-id", inspect("10.0.0.9"))
+	if got, _ := dw.records.Lookup("app.example.com"); got != "10.0.0.9" {
+		t.Fatalf("record after address change = %q, want 10.0.0.9", got)
+	}
+
+	// Disconnected from the network: the record is withdrawn
+	dw.applyContainerInspect("container-id", inspect(""))
+	if _, ok := dw.records.Lookup("app.example.com"); ok {
+		t.Fatal("record still exists after network disconnect")
+	}
+	if _, ok := dw.containers["container-id"]; ok {
+		t.Fatal("container still tracked after network disconnect")
+	}
+
+	want := []string{"+app.example.com=10.0.0.5", "+app.example.com=10.0.0.9", "-app.example.com"}
+	if !equalSlice(changes, want) {
+		t.Errorf("callback changes = %v, want %v", changes, want)
+	}
+}
+
 func equalSlice(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -197,3 +366,195 @@ func equalSlice(a, b []string) bool {
 	}
 	return true
 }
+
+func TestParseSRVLabel(t *testing.T) {
+	got, err := parseSRVLabel("_http._tcp:8080, _DNS._udp:53")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []SRVPort{{Service: "_http", Proto: "_tcp", Port: 8080}, {Service: "_dns", Proto: "_udp", Port: 53}}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseSRVLabel = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"_http._tcp", "http._tcp:80", "_http._sctp:80", "_http._tcp:0", "_http._tcp:70000", "_-bad._tcp:80"} {
+		if _, err := parseSRVLabel(bad); err == nil {
+			t.Errorf("parseSRVLabel(%q) expected error", bad)
+		}
+	}
+}
+
+func TestContainerRecordIncludesSRV(t *testing.T) {
+	dw := &DockerWatcher{hostIP: "192.168.1.100"}
+
+	entry, ok := dw.containerRecord("container-id", map[string]string{srvLabel: "_http._tcp:8080"}, nil)
+	if !ok {
+		t.Fatal("expected a record in host mode")
+	}
+	if len(entry.SRV) != 1 || entry.SRV[0].Port != 8080 {
+		t.Errorf("expected SRV port 8080, got %v", entry.SRV)
+	}
+
+	// An invalid label is ignored, the addresses are still registered
+	entry, ok = dw.containerRecord("container-id", map[string]string{srvLabel: "nonsense"}, nil)
+	if !ok || entry.IP != "192.168.1.100" || entry.SRV != nil {
+		t.Errorf("expected address without SRV, got %+v (ok=%v)", entry, ok)
+	}
+}
+
+func TestContainerRecordCNAME(t *testing.T) {
+	dw := &DockerWatcher{hostIP: "192.168.1.100"}
+
+	entry, ok := dw.containerRecord("container-id", map[string]string{cnameLabel: "Target.Example.com."}, nil)
+	if !ok {
+		t.Fatal("expected a record for a CNAME label")
+	}
+	if entry.CNAME != "target.example.com" || entry.IP != "" {
+		t.Errorf("expected CNAME target.example.com without addresses, got %+v", entry)
+	}
+
+	// An invalid target is ignored, the addresses are still registered
+	entry, ok = dw.containerRecord("container-id", map[string]string{cnameLabel: "not a host"}, nil)
+	if !ok || entry.CNAME != "" || entry.IP != "192.168.1.100" {
+		t.Errorf("expected address without CNAME, got %+v (ok=%v)", entry, ok)
+	}
+}
+
+func TestContainerRecordTTL(t *testing.T) {
+	dw := &DockerWatcher{hostIP: "192.168.1.100", minTTL: 5, maxTTL: 3600}
+
+	tests := []struct {
+		value string
+		want  uint32
+	}{
+		{"30", 30},
+		{" 300 ", 300},
+		{"1", 5},        // clamped to min_ttl
+		{"86400", 3600}, // clamped to max_ttl
+		{"0", 0},        // invalid, plugin ttl is used
+		{"short", 0},    // invalid, plugin ttl is used
+	}
+	for _, tt := range tests {
+		entry, ok := dw.containerRecord("container-id", map[string]string{ttlLabel: tt.value}, nil)
+		if !ok {
+			t.Fatalf("%q: expected a record", tt.value)
+		}
+		if entry.TTL != tt.want {
+			t.Errorf("%q: expected TTL %d, got %d", tt.value, tt.want, entry.TTL)
+		}
+	}
+}
+
+func TestHealthAllows(t *testing.T) {
+	tests := []struct {
+		mode   HealthMode
+		labels map[string]string
+		status container.HealthStatus
+		want   bool
+	}{
+		{HealthWithdraw, nil, "", true},
+		{HealthWithdraw, nil, container.Starting, true},
+		{HealthWithdraw, nil, container.Healthy, true},
+		{HealthWithdraw, nil, container.Unhealthy, false},
+		{HealthRequire, nil, container.NoHealthcheck, true},
+		{HealthRequire, nil, container.Starting, false},
+		{HealthRequire, nil, container.Healthy, true},
+		{HealthRequire, nil, container.Unhealthy, false},
+		{HealthIgnore, nil, container.Unhealthy, true},
+		{HealthWithdraw, map[string]string{healthModeLabel: "ignore"}, container.Unhealthy, true},
+		{HealthIgnore, map[string]string{healthModeLabel: "require"}, container.Starting, false},
+		{HealthWithdraw, map[string]string{healthModeLabel: "bogus"}, container.Unhealthy, false},
+	}
+	for _, tt := range tests {
+		dw := &DockerWatcher{healthMode: tt.mode}
+		if got := dw.healthAllows("container-id", tt.labels, tt.status); got != tt.want {
+			t.Errorf("mode %d labels %v status %q: got %v, want %v", tt.mode, tt.labels, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestSummaryHealth(t *testing.T) {
+	tests := []struct {
+		summary container.Summary
+		want    container.HealthStatus
+	}{
+		{container.Summary{Health: &container.HealthSummary{Status: container.Healthy}, Status: "Up 1 minute (unhealthy)"}, container.Healthy},
+		{container.Summary{Status: "Up 5 minutes (unhealthy)"}, container.Unhealthy},
+		{container.Summary{Status: "Up 2 seconds (health: starting)"}, container.Starting},
+		{container.Summary{Status: "Up 5 minutes (healthy)"}, container.Healthy},
+		{container.Summary{Status: "Up 5 minutes"}, ""},
+	}
+	for _, tt := range tests {
+		if got := summaryHealth(tt.summary); got != tt.want {
+			t.Errorf("summaryHealth(%q) = %q, want %q", tt.summary.Status, got, tt.want)
+		}
+	}
+}
+
+func TestApplyContainerInspectFollowsHealth(t *testing.T) {
+	dw := &DockerWatcher{
+		hostIP:     "192.168.1.100",
+		labels:     []string{"coredns.host.name"},
+		records:    NewRecords(),
+		containers: make(map[string]containerState),
+		healthMode: HealthRequire,
+	}
+
+	var changes []string
+	dw.callback = func(hostname string, entry RecordEntry, added bool) {
+		if added {
+			changes = append(changes, "+"+hostname)
+		} else {
+			changes = append(changes, "-"+hostname)
+		}
+	}
+
+	inspect := func(status container.HealthStatus) container.InspectResponse {
+		return container.InspectResponse{
+			Config: &container.Config{Labels: map[string]string{"coredns.host.name": "app.example.com"}},
+			State:  &container.State{Running: true, Health: &container.Health{Status: status}},
+		}
+	}
+
+	// Not registered until the healthcheck passes
+	if hostnames := dw.applyContainerInspect("container-id", inspect(container.Starting)); hostnames != nil {
+		t.Fatalf("expected no hostnames while starting, got %v", hostnames)
+	}
+	if _, ok := dw.records.Lookup("app.example.com"); ok {
+		t.Fatal("record registered before the container is healthy")
+	}
+
+	dw.applyContainerInspect("container-id", inspect(container.Healthy))
+	if _, ok := dw.records.Lookup("app.example.com"); !ok {
+		t.Fatal("record not registered once healthy")
+	}
+
+	// Withdrawn while unhealthy, restored on recovery
+	dw.applyContainerInspect("container-id", inspect(container.Unhealthy))
+	if _, ok := dw.records.Lookup("app.example.com"); ok {
+		t.Fatal("record still exists while unhealthy")
+	}
+	dw.applyContainerInspect("container-id", inspect(container.Healthy))
+
+	want := []string{"+app.example.com", "-app.example.com", "+app.example.com"}
+	if !equalSlice(changes, want) {
+		t.Errorf("callback changes = %v, want %v", changes, want)
+	}
+}
+
+func TestInactiveReason(t *testing.T) {
+	tests := []struct {
+		state *container.State
+		want  string
+	}{
+		{nil, "not running"},
+		{&container.State{Running: false}, "not running"},
+		{&container.State{Running: true, Paused: true}, "paused"},
+		{&container.State{Running: true}, ""},
+	}
+	for _, tt := range tests {
+		if got := inactiveReason(tt.state); got != tt.want {
+			t.Errorf("inactiveReason(%+v) = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package dockercluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/internal/queryhits"
+)
+
+func init() {
+	queryhits.Register(recordHits)
+}
+
+// HitTracker counts the queries answered from each record, by record name
+// (a wildcard match counts for the wildcard), so hostnames nothing queries
+// any more can be found. The names of removed records are forgotten (see
+// Records.OnRemove). With clustering, the peers' counts arrive with push/pull
+// sync, so the cluster-wide counts lag by up to one sync interval.
+type HitTracker struct {
+	local queryhits.Tracker
+
+	mu     sync.Mutex
+	remote map[string]map[string]queryhits.Count // node ID -> name -> count
+}
+
+// NewHitTracker creates an empty HitTracker.
+func NewHitTracker() *HitTracker {
+	return &HitTracker{remote: make(map[string]map[string]queryhits.Count)}
+}
+
+// Record counts a query answered from the record name at now. A nil tracker
+// counts nothing.
+func (t *HitTracker) Record(name string, now time.Time) {
+	if t == nil {
+		return
+	}
+	t.local.Record(name, now)
+}
+
+// Forget drops this node's counts of the names of removed records. A nil
+// tracker has none.
+func (t *HitTracker) Forget(names []string) {
+	if t == nil {
+		return
+	}
+	t.local.Forget(names...)
+}
+
+// Local returns this node's counts by record name.
+func (t *HitTracker) Local() map[string]queryhits.Count {
+	return t.local.Counts()
+}
+
+// Cluster returns the counts of every node by record name: this node's and
+// those the peers last sent. A nil tracker has none.
+func (t *HitTracker) Cluster() map[string]queryhits.Count {
+	if t == nil {
+		return map[string]queryhits.Count{}
+	}
+	hits := t.Local()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, remote := range t.remote {
+		for name, count := range remote {
+			total := hits[name]
+			total.Add(count)
+			hits[name] = total
+		}
+	}
+	return hits
+}
+
+// setRemote replaces the counts of the peer nodeID.
+func (t *HitTracker) setRemote(nodeID string, hits map[string]queryhits.Count) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remote[nodeID] = hits
+}
+
+// forget drops the counts of the peer nodeID.
+func (t *HitTracker) forget(nodeID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.remote, nodeID)
+}
+
+// recordHits lists the records of every running backend with their counts,
+// across the cluster if clustered. Records never queried have a zero count.
+func recordHits() []queryhits.Hit {
+	backends.mu.Lock()
+	running := make([]*backend, 0, len(backends.entries))
+	for _, e := range backends.entries {
+		running = append(running, e.value)
+	}
+	backends.mu.Unlock()
+
+	hits := []queryhits.Hit{}
+	for _, b := range running {
+		counts := b.hits.Cluster()
+		for hostname := range b.records.load() {
+			hits = append(hits, queryhits.Hit{Hostname: hostname, Plugin: "docker-cluster", Count: counts[hostname]})
+		}
+	}
+	return hits
+}
+
+// HitView is a record's query counts, as the admin API shows them.
+type HitView struct {
+	Hostname    string     `json:"hostname"`
+	Plugin      string     `json:"plugin"` // "docker-cluster" or "traefik-externals"
+	Queries     uint64     `json:"queries"`
+	LastQueried *time.Time `json:"last_queried,omitempty"` // Omitted if never queried
+}
+
+// hitView returns the view of a record's counts.
+func hitView(h queryhits.Hit) HitView {
+	view := HitView{Hostname: h.Hostname, Plugin: h.Plugin, Queries: h.Queries}
+	if h.Last != 0 {
+		last := time.Unix(0, h.Last).UTC()
+		view.LastQueried = &last
+	}
+	return view
+}
@@ -0,0 +1,155 @@
+package dockercluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/internal/queryhits"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestHitTrackerClusterCounts(t *testing.T) {
+	hits := NewHitTracker()
+	now := time.Now()
+	hits.Record("app.example.com", now.Add(-time.Minute))
+	hits.Record("app.example.com", now)
+	hits.Record("", now)
+
+	local := hits.Local()
+	if len(local) != 1 || local["app.example.com"] != (queryhits.Count{Queries: 2, Last: now.UnixNano()}) {
+		t.Fatalf("unexpected local counts %+v", local)
+	}
+
+	hits.setRemote("node2", map[string]queryhits.Count{
+		"app.example.com": {Queries: 3, Last: now.Add(time.Second).UnixNano()},
+		"db.example.com":  {Queries: 1, Last: now.UnixNano()},
+	})
+	cluster := hits.Cluster()
+	if cluster["app.example.com"] != (queryhits.Count{Queries: 5, Last: now.Add(time.Second).UnixNano()}) || cluster["db.example.com"].Queries != 1 {
+		t.Errorf("unexpected cluster counts %+v", cluster)
+	}
+
+	hits.forget("node2")
+	if cluster := hits.Cluster(); len(cluster) != 1 || cluster["app.example.com"].Queries != 2 {
+		t.Errorf("expected the departed node's counts to be dropped, got %+v", cluster)
+	}
+
+	var none *HitTracker
+	none.Record("app.example.com", now)
+	if len(none.Cluster()) != 0 {
+		t.Error("expected a nil tracker to have no counts")
+	}
+}
+
+func TestHitTrackerForgetsRemovedRecords(t *testing.T) {
+	records := NewRecords()
+	hits := NewHitTracker()
+	records.OnRemove(hits.Forget)
+	records.Add("app.example.com", "192.168.1.100")
+	records.AddEntryWithMeta("app.example.com", RecordEntry{IP: "192.168.1.101", Timestamp: 1, NodeID: "node2"})
+	records.Add("db.example.com", "192.168.1.100")
+	hits.Record("app.example.com", time.Now())
+	hits.Record("db.example.com", time.Now())
+
+	records.Remove("app.example.com")
+	records.Remove("db.example.com")
+	local := hits.Local()
+	if _, ok := local["db.example.com"]; ok {
+		t.Error("expected the removed record's count to be forgotten")
+	}
+	if local["app.example.com"].Queries != 1 {
+		t.Errorf("expected the count of a record another node still has to be kept, got %+v", local)
+	}
+}
+
+func TestServeDNSRecordsHits(t *testing.T) {
+	records := NewRecords()
+	records.Add("app.example.com", "192.168.1.100")
+	records.Add("*.apps.example.com", "192.168.1.101")
+	dc := &DockerCluster{Records: records, Hits: NewHitTracker(), TTL: 60, UnknownAction: ActionNXDomain}
+
+	for _, q := range []struct {
+		name  string
+		qtype uint16
+	}{
+		{"app.example.com.", dns.TypeA},
+		{"APP.example.com.", dns.TypeAAAA},
+		{"one.apps.example.com.", dns.TypeA},
+		{"two.apps.example.com.", dns.TypeA},
+		{"missing.example.com.", dns.TypeA},
+	} {
+		req := new(dns.Msg)
+		req.SetQuestion(q.name, q.qtype)
+		if _, err := dc.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), req); err != nil {
+			t.Fatalf("%s: %v", q.name, err)
+		}
+	}
+
+	local := dc.Hits.Local()
+	if len(local) != 2 || local["app.example.com"].Queries != 2 || local["*.apps.example.com"].Queries != 2 {
+		t.Errorf("expected counts by record name, got %+v", local)
+	}
+}
+
+func TestDelegateExchangesHits(t *testing.T) {
+	now := time.Now().UnixNano()
+	sender := NewClusterDelegate("node2", NewRecords(), func() int { return 2 })
+	sender.hits = NewHitTracker()
+	sender.hits.Record("app.example.com", time.Unix(0, now))
+
+	d := NewClusterDelegate("node1", NewRecords(), func() int { return 2 })
+	d.hits = NewHitTracker()
+	d.MergeRemoteState(sender.LocalState(false), false)
+	if got := d.hits.Cluster()["app.example.com"]; got != (queryhits.Count{Queries: 1, Last: now}) {
+		t.Errorf("expected the peer's counts to be merged, got %+v", got)
+	}
+}
+
+func TestHitsHandler(t *testing.T) {
+	records := NewRecords()
+	records.Add("busy.example.com", "192.168.1.100")
+	records.Add("idle.example.com", "192.168.1.100")
+	records.Add("old.example.com", "192.168.1.100")
+	hits := NewHitTracker()
+	hits.Record("busy.example.com", time.Now())
+	hits.Record("old.example.com", time.Now().Add(-2*time.Hour))
+	backends.acquire("hits-test", func() (*backend, error) { return &backend{records: records, hits: hits}, nil })
+	defer backends.release("hits-test", func(*backend) {})
+	dc := &DockerCluster{Records: records, Hits: hits}
+
+	get := func(path string) (*httptest.ResponseRecorder, []HitView) {
+		rec := httptest.NewRecorder()
+		dc.hitsHandler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var views []HitView
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &views); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+		}
+		return rec, views
+	}
+
+	_, views := get("/hits")
+	if len(views) != 3 || views[0].Hostname != "busy.example.com" || views[0].Queries != 1 || views[0].LastQueried == nil {
+		t.Fatalf("unexpected hits %+v", views)
+	}
+	if views[1].Hostname != "idle.example.com" || views[1].Queries != 0 || views[1].LastQueried != nil || views[1].Plugin != "docker-cluster" {
+		t.Errorf("expected the unqueried record with a zero count, got %+v", views[1])
+	}
+
+	if _, views := get("/hits?unqueried=1h"); len(views) != 2 || views[0].Hostname != "idle.example.com" || views[1].Hostname != "old.example.com" {
+		t.Errorf("expected the records not queried within an hour, got %+v", views)
+	}
+	if _, views := get("/hits?unqueried=0"); len(views) != 1 || views[0].Hostname != "idle.example.com" {
+		t.Errorf("expected the records never queried, got %+v", views)
+	}
+	if rec, _ := get("/hits?unqueried=soon"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid duration, got %d", rec.Code)
+	}
+}
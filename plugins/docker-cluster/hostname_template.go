@@ -0,0 +1,150 @@
+package dockercluster
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// Labels Docker Compose sets on the containers it creates.
+const (
+	composeServiceLabel = "com.docker.compose.service"
+	composeProjectLabel = "com.docker.compose.project"
+	composeNumberLabel  = "com.docker.compose.container-number"
+)
+
+// hostnameData is what hostname templates - hostname label values and the
+// auto_register template - can refer to, e.g.
+// {{.ComposeService}}.{{.ComposeProject}}.lab.example.com.
+type hostnameData struct {
+	Name           string // Container (or Swarm service) name without the leading slash
+	ComposeService string // com.docker.compose.service label
+	ComposeProject string // com.docker.compose.project label
+	ComposeNumber  string // com.docker.compose.container-number label
+	Node           string // Name of this node (cluster node_name or the OS hostname)
+}
+
+// hostnameData collects the template values of a container.
+func (dw *DockerWatcher) hostnameData(name string, labels map[string]string) hostnameData {
+	return hostnameData{
+		Name:           strings.TrimPrefix(name, "/"),
+		ComposeService: labels[composeServiceLabel],
+		ComposeProject: labels[composeProjectLabel],
+		ComposeNumber:  labels[composeNumberLabel],
+		Node:           dw.nodeName,
+	}
+}
+
+// containerHostnames returns the hostnames a container registers: those in
+// its hostname labels and, with traefik_labels, its Traefik router rules or,
+// without any and with auto_register enabled, the name generated from the
+// template. enableLabel=false opts a container out.
+func (dw *DockerWatcher) containerHostnames(name string, labels map[string]string) []string {
+	if enabled, ok := labels[enableLabel]; ok && strings.EqualFold(strings.TrimSpace(enabled), "false") {
+		return nil
+	}
+	data := dw.hostnameData(name, labels)
+	hostnames := dw.extractHostnames(labels, data)
+	if dw.traefik != nil {
+		for _, hostname := range dw.traefik.hostnames(labels) {
+			if !slices.Contains(hostnames, hostname) {
+				hostnames = append(hostnames, hostname)
+			}
+		}
+	}
+	if len(hostnames) > 0 || dw.autoRegister == nil {
+		return hostnames
+	}
+	if hostname := dw.autoHostname(data); hostname != "" {
+		return []string{hostname}
+	}
+	return nil
+}
+
+// autoHostname renders the auto_register template. Returns "" if the result
+// is not a valid hostname, e.g. a Compose template for a container that
+// Compose didn't create.
+func (dw *DockerWatcher) autoHostname(data hostnameData) string {
+	hostname, err := renderHostname(dw.autoRegister, data)
+	if err != nil {
+		log.Warningf("docker-cluster: auto_register template failed for %s: %v", data.Name, err)
+		return ""
+	}
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if !isValidHostname(hostname) {
+		log.Debugf("docker-cluster: auto_register name %q for %s is not a valid hostname, skipping", hostname, data.Name)
+		return ""
+	}
+	return hostname
+}
+
+// expandLabel expands the template placeholders in a hostname label value.
+// Values without placeholders are returned unchanged.
+func (dw *DockerWatcher) expandLabel(value string, data hostnameData) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	tmpl, err := newHostnameTemplate("label", value, dw.templateEnv)
+	if err != nil {
+		return "", err
+	}
+	return renderHostname(tmpl, data)
+}
+
+// renderHostname executes a hostname template.
+func renderHostname(tmpl *template.Template, data hostnameData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// newHostnameTemplate parses a hostname template. {{env "VAR"}} reads the
+// environment variables in env, the ones allowed with template_env; like
+// traefik-externals, an unset or empty variable fails the template.
+func newHostnameTemplate(name, text string, env map[string]string) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"env": func(key string) (string, error) {
+				value, ok := env[key]
+				if !ok {
+					return "", fmt.Errorf("env var %s is not allowed, add it to template_env", key)
+				}
+				if value == "" {
+					return "", fmt.Errorf("env var %s is not set", key)
+				}
+				return value, nil
+			},
+		}).
+		Parse(text)
+}
+
+// parseAutoRegister parses an auto_register template. It is executed once
+// against empty values so that unknown fields and unusable variables fail at
+// startup.
+func parseAutoRegister(text string, env map[string]string) (*template.Template, error) {
+	tmpl, err := newHostnameTemplate("auto_register", text, env)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := renderHostname(tmpl, hostnameData{}); err != nil {
+		return nil, fmt.Errorf("%s: %w", text, err)
+	}
+	return tmpl, nil
+}
+
+// templateEnv captures the allowed environment variables for hostname
+// templates. Like traefik-externals, they are read once at startup.
+func templateEnv(keys []string) map[string]string {
+	env := make(map[string]string, len(keys))
+	for _, key := range keys {
+		env[key] = os.Getenv(key)
+	}
+	return env
+}
@@ -0,0 +1,135 @@
+package dockercluster
+
+import (
+	"testing"
+
+	"github.com/moby/moby/api/types/container"
+)
+
+func TestContainerHostnamesAutoRegister(t *testing.T) {
+	tmpl, err := parseAutoRegister("{{.ComposeService}}.{{.ComposeProject}}.lab.example.com", nil)
+	if err != nil {
+		t.Fatalf("parseAutoRegister() error = %v", err)
+	}
+	dw := &DockerWatcher{labels: []string{"coredns.host.name"}, autoRegister: tmpl}
+
+	compose := map[string]string{
+		"com.docker.compose.service": "Web",
+		"com.docker.compose.project": "shop",
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{"generated from compose labels", compose, []string{"web.shop.lab.example.com"}},
+		{"hostname label wins", map[string]string{"coredns.host.name": "app.example.com", "com.docker.compose.service": "web"}, []string{"app.example.com"}},
+		{"not created by compose", map[string]string{}, nil},
+		{"invalid generated name", map[string]string{"com.docker.compose.service": "my_web", "com.docker.compose.project": "shop"}, nil},
+		{"opted out", map[string]string{"coredns.enable": "false", "com.docker.compose.service": "web", "com.docker.compose.project": "shop"}, nil},
+		{"opt out covers labels", map[string]string{"coredns.enable": "FALSE", "coredns.host.name": "app.example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dw.containerHostnames("/shop-web-1", tt.labels); !equalSlice(got, tt.want) {
+				t.Errorf("containerHostnames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Without a template only labels register hostnames
+	dw.autoRegister = nil
+	if got := dw.containerHostnames("/shop-web-1", compose); got != nil {
+		t.Errorf("expected no hostnames without auto_register, got %v", got)
+	}
+}
+
+func TestApplyContainerSummaryAutoRegister(t *testing.T) {
+	tmpl, err := parseAutoRegister("{{.Name}}.docker.example.com", nil)
+	if err != nil {
+		t.Fatalf("parseAutoRegister() error = %v", err)
+	}
+	var added []string
+	dw := &DockerWatcher{
+		hostIP:       "192.168.1.100",
+		labels:       []string{"coredns.host.name"},
+		records:      NewRecords(),
+		containers:   make(map[string]containerState),
+		autoRegister: tmpl,
+		callback: func(hostname string, entry RecordEntry, isAdd bool) {
+			if isAdd {
+				added = append(added, hostname)
+			}
+		},
+	}
+
+	if !dw.applyContainerSummary(container.Summary{ID: "abc123", Names: []string{"/grafana"}}) {
+		t.Fatal("expected the container to be registered")
+	}
+	if ip, ok := dw.records.Lookup("grafana.docker.example.com"); !ok || ip != "192.168.1.100" {
+		t.Errorf("expected grafana.docker.example.com -> 192.168.1.100, got %q", ip)
+	}
+	if !equalSlice(added, []string{"grafana.docker.example.com"}) {
+		t.Errorf("expected generated name to be gossiped, got %v", added)
+	}
+}
+
+func TestParseAutoRegister(t *testing.T) {
+	env := map[string]string{"DOMAIN": "example.com", "UNSET": ""}
+
+	for _, text := range []string{
+		"{{.Name}}.docker.example.com",
+		"{{.ComposeService}}-{{.ComposeNumber}}.{{.ComposeProject}}.example.com",
+		`{{.Name}}.{{env "DOMAIN"}}`,
+	} {
+		if _, err := parseAutoRegister(text, env); err != nil {
+			t.Errorf("parseAutoRegister(%q) error = %v", text, err)
+		}
+	}
+	for _, text := range []string{
+		"{{.Name}.example.com",      // syntax error
+		"{{.Hostname}}.example.com", // unknown field
+		`{{.Name}}.{{env "HOME"}}`,  // not allowed
+		`{{.Name}}.{{env "UNSET"}}`, // allowed but empty
+	} {
+		if _, err := parseAutoRegister(text, env); err == nil {
+			t.Errorf("parseAutoRegister(%q) expected error", text)
+		}
+	}
+}
+
+func TestExtractHostnamesTemplates(t *testing.T) {
+	dw := &DockerWatcher{
+		labels:      []string{"coredns.host.name"},
+		nodeName:    "docker01",
+		templateEnv: map[string]string{"DOMAIN": "staging.example.com"},
+	}
+	data := dw.hostnameData("/shop-web-1", map[string]string{
+		"com.docker.compose.service": "web",
+		"com.docker.compose.project": "shop",
+	})
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"env", `app.{{env "DOMAIN"}}`, []string{"app.staging.example.com"}},
+		{"name and node", "{{.Name}}.{{.Node}}.example.com", []string{"shop-web-1.docker01.example.com"}},
+		{"compose", "{{.ComposeService}}.{{.ComposeProject}}.example.com,api.example.com", []string{"web.shop.example.com", "api.example.com"}},
+		{"wildcard", `*.{{env "DOMAIN"}}`, []string{"*.staging.example.com"}},
+		{"env not allowed", `app.{{env "HOME"}}`, nil},
+		{"unknown field", "{{.Hostname}}.example.com", nil},
+		{"syntax error", "{{.Name}.example.com", nil},
+		{"invalid result", "{{.ComposeService}}_x.example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dw.extractHostnames(map[string]string{"coredns.host.name": tt.value}, data)
+			if !equalSlice(got, tt.want) {
+				t.Errorf("extractHostnames(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
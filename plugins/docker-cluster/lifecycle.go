@@ -0,0 +1,368 @@
+package dockercluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// The Docker watcher, cluster membership and HTTP endpoints outlive a server
+// block: several blocks may configure the same ones, and on a Corefile
+// reload the new instance starts before the old one shuts down. They are
+// therefore shared by key and reference counted, so a reload that keeps
+// their settings carries them over, and the last release stops them.
+var (
+	backends    shared[*backend]
+	httpServers shared[*httpServer]
+)
+
+// shared holds values used by several server blocks, reference counted by
+// key.
+type shared[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*sharedEntry[T]
+}
+
+// sharedEntry is a shared value and the number of its holders.
+type sharedEntry[T any] struct {
+	value T
+	refs  int
+}
+
+// acquire returns the value of key, creating it with create if there is
+// none yet.
+func (s *shared[T]) acquire(key string, create func() (T, error)) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.refs++
+		return e.value, nil
+	}
+	value, err := create()
+	if err != nil {
+		return value, err
+	}
+	if s.entries == nil {
+		s.entries = make(map[string]*sharedEntry[T])
+	}
+	s.entries[key] = &sharedEntry[T]{value: value, refs: 1}
+	return value, nil
+}
+
+// release drops a reference to the value of key; the last one removes it
+// and passes it to stop.
+func (s *shared[T]) release(key string, stop func(T)) {
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	last := ok && e.refs == 1
+	if last {
+		delete(s.entries, key)
+	} else if ok {
+		e.refs--
+	}
+	s.mu.Unlock()
+
+	if last {
+		stop(e.value)
+	}
+}
+
+// backend is what the server blocks of a node share: the records and their
+// query counts with the cluster membership and snapshot that keep them, and the Docker watcher
+// (and manual records) publishing to them. A node runs one watcher at a
+// time: the blocks of a Corefile sharing a backend have the same watcher
+// settings (setup rejects others), and the new instance of a reload with
+// other settings replaces it without leaving the cluster.
+type backend struct {
+	settings string // Settings the backend was created with
+
+	records  *Records
+	hits     *HitTracker
+	cluster  *ClusterManager
+	snapshot *Snapshot
+
+	mu         sync.Mutex
+	watcherKey string
+	watcher    *DockerWatcher
+	manual     *ManualRecords
+}
+
+// newBackend creates the backend of dc's records, joining the cluster and
+// restoring the snapshot if configured.
+func newBackend(dc *DockerCluster) (*backend, error) {
+	b := &backend{settings: dc.backendSettings, records: dc.Records, hits: NewHitTracker(), snapshot: dc.Snapshot}
+	b.records.OnRemove(b.hits.Forget)
+
+	if dc.ClusterConfig != nil && dc.ClusterConfig.Enabled {
+		cm, err := NewClusterManager(dc.ClusterConfig, dc.Records)
+		if err != nil {
+			return nil, err
+		}
+		// Exchange the query counts with the records during push/pull sync
+		cm.delegate.hits = b.hits
+		if err := cm.Start(context.Background()); err != nil {
+			return nil, err
+		}
+
+		// Join cluster (non-blocking, logs warnings on failure)
+		go func() {
+			if err := cm.Join(); err != nil {
+				log.Warningf("docker-cluster: failed to join cluster: %v", err)
+			}
+		}()
+
+		log.Infof("docker-cluster: clustering enabled, node=%s", dc.ClusterConfig.NodeName)
+		b.cluster = cm
+	}
+
+	// Serve the last known records until Docker and the cluster report in
+	if b.snapshot != nil {
+		n, err := b.snapshot.Load(b.cluster != nil)
+		if err != nil {
+			log.Warningf("docker-cluster: failed to restore records: %v", err)
+		} else {
+			log.Infof("docker-cluster: restored %d record(s) from %s (stale_ttl=%d grace=%s)", n, b.snapshot.Path, b.snapshot.StaleTTL, b.snapshot.Grace)
+		}
+	}
+
+	return b, nil
+}
+
+// useWatcher starts dc's watcher and manual records as the backend's,
+// unless the backend already runs a watcher with the same settings, which
+// dc then uses. A replaced watcher is stopped, and the local records it
+// published that the new one does not are withdrawn once it has synced.
+func (b *backend) useWatcher(dc *DockerCluster) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.watcher != nil && b.watcherKey == dc.watcherKey {
+		dc.Watcher, dc.Manual = b.watcher, b.manual
+		return nil
+	}
+
+	watcher := dc.Watcher
+	watcher.useRecords(b.records)
+	if cm := b.cluster; cm != nil {
+		// Wire callback from DockerWatcher to ClusterManager
+		watcher.SetCallback(func(hostname string, entry RecordEntry, added bool) {
+			if added {
+				cm.NotifyRecordEntryAdd(hostname, entry)
+			} else {
+				cm.NotifyRecordRemove(hostname, entry.Timestamp)
+			}
+		})
+	}
+
+	replaced := b.watcher != nil
+	if replaced {
+		log.Info("docker-cluster: watcher settings changed, replacing the Docker watcher")
+		b.stopWatcher()
+		b.records.MarkLocalRestored()
+	} else if b.snapshot != nil {
+		b.snapshot.Start(context.Background(), watcher)
+	}
+
+	// Claim the manual records before Docker reports in
+	if dc.Manual != nil {
+		n, err := dc.Manual.Load()
+		if err != nil {
+			log.Warningf("docker-cluster: failed to load manual records: %v", err)
+		} else {
+			log.Infof("docker-cluster: loaded %d manual record(s) from %s", n, dc.Manual.Path)
+		}
+		dc.Manual.Start(context.Background())
+	}
+
+	if err := watcher.Start(context.Background()); err != nil {
+		// Stop what did start, so nothing keeps running unowned
+		watcher.Stop()
+		if dc.Manual != nil {
+			dc.Manual.Stop()
+		}
+		return err
+	}
+	b.watcherKey, b.watcher, b.manual = dc.watcherKey, watcher, dc.Manual
+	if replaced {
+		watcher.reconcile()
+	}
+	return nil
+}
+
+// stopWatcher stops the watcher and manual records. Callers hold b.mu.
+func (b *backend) stopWatcher() {
+	if b.watcher != nil {
+		b.watcher.Stop()
+	}
+	if b.manual != nil {
+		b.manual.Stop()
+	}
+}
+
+// stop stops the watcher, leaves the cluster and writes the snapshot.
+func (b *backend) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stopWatcher()
+	if b.cluster != nil {
+		b.cluster.Stop()
+	}
+	if b.snapshot != nil {
+		b.snapshot.Stop()
+	}
+	b.records.uncount()
+}
+
+// useRecords makes the watcher, and those of its further daemons, publish
+// to records.
+func (dw *DockerWatcher) useRecords(records *Records) {
+	dw.records = records
+	dw.owners.records = records
+	for _, daemon := range dw.daemons {
+		daemon.records = records
+	}
+}
+
+// reconcile withdraws, in the background, the local node's restored entries
+// no container claims once the watcher has synced every daemon.
+func (dw *DockerWatcher) reconcile() {
+	dw.wg.Add(1)
+	go func() {
+		defer dw.wg.Done()
+		reconcileLocal(dw.ctx, dw.records, dw)
+	}()
+}
+
+// httpServer serves the version and admin endpoints on an address shared by
+// several server blocks. Requests go to the block started last.
+type httpServer struct {
+	server   *http.Server
+	mu       sync.RWMutex
+	handlers []*DockerCluster
+}
+
+// newHTTPServer starts serving the version and admin endpoints on addr. It
+// binds addr before returning, so a port already in use fails the startup.
+func newHTTPServer(addr string) (*httpServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("version and admin endpoints: %w", err)
+	}
+
+	s := &httpServer{}
+	s.server = &http.Server{
+		Addr:         addr,
+		Handler:      s,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	go func() {
+		log.Infof("docker-cluster: version and admin endpoints listening on %s", addr)
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorf("docker-cluster: version endpoint failed: %v", err)
+		}
+	}()
+
+	return s, nil
+}
+
+// ServeHTTP passes the request to the handler of the block started last.
+func (s *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	var dc *DockerCluster
+	if n := len(s.handlers); n > 0 {
+		dc = s.handlers[n-1]
+	}
+	s.mu.RUnlock()
+
+	if dc == nil {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	dc.admin.ServeHTTP(w, r)
+}
+
+// add routes requests to dc.
+func (s *httpServer) add(dc *DockerCluster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, dc)
+}
+
+// remove stops routing requests to dc.
+func (s *httpServer) remove(dc *DockerCluster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = slices.DeleteFunc(s.handlers, func(h *DockerCluster) bool { return h == dc })
+}
+
+// shutdown stops the server.
+func (s *httpServer) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Errorf("docker-cluster: version server shutdown error: %v", err)
+	}
+}
+
+// httpAddr returns the address of the version and admin endpoints.
+func (dc *DockerCluster) httpAddr() string {
+	// COREDNS_VERSION_PORT takes precedence over http_addr
+	if envVersionAddr := os.Getenv("COREDNS_VERSION_PORT"); envVersionAddr != "" {
+		return envVersionAddr
+	}
+	return dc.HTTPAddr
+}
+
+// start acquires the backend and HTTP server dc shares with the other
+// server blocks, or with the previous instance across a reload, starting
+// what no block runs yet.
+func (dc *DockerCluster) start() error {
+	b, err := backends.acquire(dc.backendKey, func() (*backend, error) { return newBackend(dc) })
+	if err != nil {
+		return err
+	}
+	if b.settings != dc.backendSettings {
+		log.Warning("docker-cluster: cluster and snapshot settings changed; they take effect after a restart")
+	}
+	dc.Records, dc.Hits, dc.ClusterManager, dc.Snapshot = b.records, b.hits, b.cluster, b.snapshot
+	if err := b.useWatcher(dc); err != nil {
+		backends.release(dc.backendKey, (*backend).stop)
+		return err
+	}
+
+	dc.admin = dc.adminHandler()
+	addr := dc.httpAddr()
+	server, err := httpServers.acquire(addr, func() (*httpServer, error) { return newHTTPServer(addr) })
+	if err != nil {
+		backends.release(dc.backendKey, (*backend).stop)
+		return err
+	}
+	dc.server = server
+	dc.server.add(dc)
+	return nil
+}
+
+// stop releases what start acquired; the last block to release something
+// stops it.
+func (dc *DockerCluster) stop() error {
+	if dc.server == nil {
+		return nil // Not started
+	}
+	dc.server.remove(dc)
+	httpServers.release(dc.server.server.Addr, (*httpServer).shutdown)
+	dc.server = nil
+	backends.release(dc.backendKey, (*backend).stop)
+	return nil
+}
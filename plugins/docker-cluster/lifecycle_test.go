@@ -0,0 +1,183 @@
+package dockercluster
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSharedRefCounting(t *testing.T) {
+	var s shared[*int]
+	created, stopped := 0, 0
+	create := func() (*int, error) {
+		created++
+		v := created
+		return &v, nil
+	}
+	stop := func(*int) { stopped++ }
+
+	a, _ := s.acquire("key", create)
+	b, _ := s.acquire("key", create)
+	if a != b || created != 1 {
+		t.Fatalf("expected one shared value, created %d", created)
+	}
+	s.release("key", stop)
+	if stopped != 0 {
+		t.Fatal("expected the value to outlive the first release")
+	}
+	s.release("key", stop)
+	if stopped != 1 {
+		t.Fatal("expected the last release to stop the value")
+	}
+	s.release("key", stop)
+	if stopped != 1 {
+		t.Error("expected releasing an unknown key to do nothing")
+	}
+
+	if c, _ := s.acquire("key", create); c == a || created != 2 {
+		t.Error("expected a new value after the last release")
+	}
+	if _, err := s.acquire("other", func() (*int, error) { return nil, errors.New("failed") }); err == nil {
+		t.Error("expected the create error")
+	}
+	if _, ok := s.entries["other"]; ok {
+		t.Error("expected a failed create to store nothing")
+	}
+}
+
+// startBlock parses and starts a docker-cluster server block.
+func startBlock(t *testing.T, corefile string) *DockerCluster {
+	t.Helper()
+	dc, err := parseConfig(caddy.NewTestController("dns", corefile))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if err := dc.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return dc
+}
+
+func TestServerBlocksShareWatcher(t *testing.T) {
+	t.Setenv("DOCKER_SOCKET", "")
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("COREDNS_VERSION_PORT", "")
+
+	first := startBlock(t, `docker-cluster example.com {
+		docker_socket unix:///nonexistent/docker.sock
+		host_ip 192.168.1.100
+		http_addr 127.0.0.1:0
+	}`)
+	second := startBlock(t, `docker-cluster example.org {
+		docker_socket unix:///nonexistent/docker.sock
+		host_ip 192.168.1.100
+		ttl 30
+		http_addr 127.0.0.1:0
+	}`)
+
+	if second.Watcher != first.Watcher || second.Records != first.Records || second.server != first.server {
+		t.Fatal("expected blocks with the same watcher settings to share watcher, records and HTTP server")
+	}
+	if second.TTL != 30 || first.TTL != 60 {
+		t.Error("expected each block to keep its own ttl")
+	}
+
+	first.stop()
+	if !first.Watcher.running {
+		t.Fatal("expected the watcher to keep running while a block uses it")
+	}
+	second.stop()
+	if first.Watcher.running {
+		t.Error("expected the last block to stop the watcher")
+	}
+}
+
+func TestReloadReplacesWatcherKeepsCluster(t *testing.T) {
+	t.Setenv("DOCKER_SOCKET", "")
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("COREDNS_VERSION_PORT", "")
+	const cluster = `
+		docker_socket unix:///nonexistent/docker.sock
+		host_ip 192.168.1.100
+		http_addr 127.0.0.1:0
+		cluster_enabled true
+		cluster_port 7995
+		cluster_bind_addr 127.0.0.1
+		discovery_port 7996
+		node_name reload-node`
+
+	old := startBlock(t, "docker-cluster {"+cluster+"\n}")
+	old.Watcher.updateContainer("web", []string{"web.example.com"}, RecordEntry{IP: "192.168.1.100"})
+	old.Watcher.updateContainer("gone", []string{"gone.example.com"}, RecordEntry{IP: "192.168.1.100"})
+
+	// The new instance starts before the old one shuts down
+	reloaded := startBlock(t, "docker-cluster {"+cluster+"\n\t\tlabel other.host.name\n}")
+	if reloaded.ClusterManager != old.ClusterManager || reloaded.Records != old.Records {
+		t.Fatal("expected the reload to keep the cluster and records")
+	}
+	if reloaded.Watcher == old.Watcher || old.Watcher.running {
+		t.Fatal("expected the changed watcher settings to replace the watcher")
+	}
+	if entry, ok := reloaded.Records.LookupEntry("web.example.com"); !ok || !entry.restored {
+		t.Errorf("expected the old watcher's records to await confirmation, got %+v", entry)
+	}
+
+	reloaded.Watcher.updateContainer("web", []string{"web.example.com"}, RecordEntry{IP: "192.168.1.100"})
+	reloaded.Watcher.markSynced()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := reloaded.Records.Lookup("gone.example.com"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the record the new watcher does not claim to be withdrawn")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if entry, ok := reloaded.Records.LookupEntry("web.example.com"); !ok || entry.restored {
+		t.Errorf("expected the claimed record to be confirmed, got %+v", entry)
+	}
+
+	old.stop()
+	if !reloaded.ClusterManager.IsHealthy() {
+		t.Fatal("expected the old instance's shutdown to keep the cluster membership")
+	}
+	reloaded.stop()
+	if reloaded.ClusterManager.IsHealthy() {
+		t.Error("expected the last block to leave the cluster")
+	}
+}
+
+func TestStartFailsOnHTTPPortInUse(t *testing.T) {
+	t.Setenv("DOCKER_SOCKET", "")
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("COREDNS_VERSION_PORT", "")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	dc, err := parseConfig(caddy.NewTestController("dns", `docker-cluster {
+		docker_socket unix:///nonexistent/docker.sock
+		host_ip 192.168.1.100
+		http_addr `+ln.Addr().String()+`
+	}`))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if err := dc.start(); err == nil {
+		dc.stop()
+		t.Fatal("expected start to fail when the HTTP port is in use")
+	}
+	if dc.Watcher.running {
+		t.Error("expected the failed start to stop the watcher")
+	}
+	if _, ok := backends.entries[dc.backendKey]; ok {
+		t.Error("expected the failed start to release the backend")
+	}
+}
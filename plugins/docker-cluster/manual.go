@@ -0,0 +1,254 @@
+package dockercluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// manualDaemon is the daemon manual records claim their hostnames under, so
+// that no Docker daemon's sync ever releases them.
+const manualDaemon = "manual"
+
+// manualExpiryInterval is how often expired manual records are removed.
+const manualExpiryInterval = 10 * time.Second
+
+// ManualRecord is a record created through the admin API rather than by a
+// container.
+type ManualRecord struct {
+	Hostname string     `json:"hostname"`
+	IP       string     `json:"ip,omitempty"`
+	IPv6     string     `json:"ipv6,omitempty"`
+	TTL      uint32     `json:"ttl,omitempty"`     // Answer TTL in seconds; 0 uses the plugin's ttl
+	Expires  *time.Time `json:"expires,omitempty"` // Removed at this time (nil: never)
+}
+
+// entry returns the record entry the manual record claims its hostname with.
+func (m ManualRecord) entry() RecordEntry {
+	return RecordEntry{IP: m.IP, IPv6: m.IPv6, TTL: m.TTL, Manual: true}
+}
+
+// expired reports whether the record has expired at now.
+func (m ManualRecord) expired(now time.Time) bool {
+	return m.Expires != nil && !now.Before(*m.Expires)
+}
+
+// validate normalizes the hostname and checks the record can be served.
+func (m *ManualRecord) validate() error {
+	m.Hostname = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(m.Hostname)), ".")
+	if !isValidHostname(m.Hostname) && !isValidWildcard(m.Hostname) {
+		return fmt.Errorf("invalid hostname %q", m.Hostname)
+	}
+	if m.IP == "" && m.IPv6 == "" {
+		return fmt.Errorf("%s: ip or ipv6 is required", m.Hostname)
+	}
+	if ip := net.ParseIP(m.IP); m.IP != "" && (ip == nil || ip.To4() == nil) {
+		return fmt.Errorf("%s: invalid ip %q", m.Hostname, m.IP)
+	}
+	if m.IPv6 != "" && !isIPv6(m.IPv6) {
+		return fmt.Errorf("%s: invalid ipv6 %q", m.Hostname, m.IPv6)
+	}
+	return nil
+}
+
+// ManualRecords holds the records created through the admin API. They claim
+// their hostnames like containers do, so they are announced to the cluster
+// through the watcher's callback and take part in the conflict policy, and
+// they are kept in a state file so they survive restarts.
+type ManualRecords struct {
+	Path string // State file, written atomically on every change
+
+	watcher *DockerWatcher
+	mu      sync.Mutex
+	records map[string]ManualRecord // hostname -> record
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewManualRecords creates an empty set of manual records stored at path,
+// claiming hostnames through watcher.
+func NewManualRecords(path string, watcher *DockerWatcher) *ManualRecords {
+	return &ManualRecords{
+		Path:    path,
+		watcher: watcher,
+		records: make(map[string]ManualRecord),
+	}
+}
+
+// Load reads the state file and claims its records. Expired and invalid
+// records are skipped; a missing file is not an error. Returns the number of
+// records loaded.
+func (m *ManualRecords) Load() (int, error) {
+	data, err := os.ReadFile(m.Path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var saved []ManualRecord
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, fmt.Errorf("invalid manual records file %s: %v", m.Path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, rec := range saved {
+		if err := rec.validate(); err != nil {
+			log.Warningf("docker-cluster: ignoring manual record: %v", err)
+			continue
+		}
+		if rec.expired(now) {
+			continue
+		}
+		m.records[rec.Hostname] = rec
+		m.claim(rec)
+	}
+	return len(m.records), nil
+}
+
+// Set creates or replaces the manual record of rec.Hostname.
+func (m *ManualRecords) Set(rec ManualRecord) (ManualRecord, error) {
+	if err := rec.validate(); err != nil {
+		return rec, err
+	}
+	if rec.expired(time.Now()) {
+		return rec, fmt.Errorf("%s: expires in the past", rec.Hostname)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev, existed := m.records[rec.Hostname]
+	m.records[rec.Hostname] = rec
+	if err := m.save(); err != nil {
+		if existed {
+			m.records[rec.Hostname] = prev
+		} else {
+			delete(m.records, rec.Hostname)
+		}
+		return rec, err
+	}
+	m.claim(rec)
+	return rec, nil
+}
+
+// Delete removes the manual record of hostname. Returns false if there is
+// none.
+func (m *ManualRecords) Delete(hostname string) (bool, error) {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.records[hostname]
+	if !ok {
+		return false, nil
+	}
+	delete(m.records, hostname)
+	if err := m.save(); err != nil {
+		m.records[hostname] = rec
+		return true, err
+	}
+	m.release(hostname)
+	return true, nil
+}
+
+// List returns the manual records sorted by hostname.
+func (m *ManualRecords) List() []ManualRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sorted()
+}
+
+// sorted returns the records sorted by hostname. Callers hold m.mu.
+func (m *ManualRecords) sorted() []ManualRecord {
+	list := make([]ManualRecord, 0, len(m.records))
+	for _, rec := range m.records {
+		list = append(list, rec)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Hostname < list[j].Hostname })
+	return list
+}
+
+// Start removes manual records as they expire.
+func (m *ManualRecords) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(manualExpiryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				m.expire(now)
+			}
+		}
+	}()
+}
+
+// Stop halts the expiry of manual records.
+func (m *ManualRecords) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+}
+
+// expire removes the records expired at now.
+func (m *ManualRecords) expire(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired []string
+	for hostname, rec := range m.records {
+		if rec.expired(now) {
+			delete(m.records, hostname)
+			expired = append(expired, hostname)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	sort.Strings(expired)
+	log.Infof("docker-cluster: removing %d expired manual record(s): %v", len(expired), expired)
+	if err := m.save(); err != nil {
+		log.Errorf("docker-cluster: failed to write manual records file %s: %v", m.Path, err)
+	}
+	for _, hostname := range expired {
+		m.release(hostname)
+	}
+}
+
+// claim claims the record's hostname and announces the resulting changes.
+// Callers hold m.mu.
+func (m *ManualRecords) claim(rec ManualRecord) {
+	owners := m.watcher.hostnameOwners()
+	m.watcher.notify(owners.update(manualDaemon, rec.Hostname, nil, []string{rec.Hostname}, rec.entry()))
+}
+
+// release drops the claim on hostname and announces the resulting changes.
+// Callers hold m.mu.
+func (m *ManualRecords) release(hostname string) {
+	owners := m.watcher.hostnameOwners()
+	m.watcher.notify(owners.update(manualDaemon, hostname, []string{hostname}, nil, RecordEntry{}))
+}
+
+// save writes the records to the state file. Callers hold m.mu.
+func (m *ManualRecords) save() error {
+	data, err := json.MarshalIndent(m.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.Path, data)
+}
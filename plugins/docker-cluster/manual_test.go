@@ -0,0 +1,216 @@
+package dockercluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManualRecordsSetAndDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manual.json")
+	watcher := NewDockerWatcher("", "192.168.1.100", nil, NewRecords())
+	type event struct {
+		hostname string
+		entry    RecordEntry
+		added    bool
+	}
+	events := make(chan event, 4)
+	watcher.SetCallback(func(hostname string, entry RecordEntry, added bool) {
+		events <- event{hostname, entry, added}
+	})
+
+	m := NewManualRecords(path, watcher)
+	if _, err := m.Set(ManualRecord{Hostname: "NAS.example.com.", IP: "10.0.0.50", TTL: 30}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	entry, ok := watcher.records.LookupEntry("nas.example.com")
+	if !ok || entry.IP != "10.0.0.50" || entry.TTL != 30 || !entry.Manual {
+		t.Errorf("unexpected record %+v", entry)
+	}
+	if e := <-events; !e.added || e.hostname != "nas.example.com" || !e.entry.Manual {
+		t.Errorf("expected the record to be announced, got %+v", e)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the manual records file to be written: %v", err)
+	}
+
+	found, err := m.Delete("nas.example.com")
+	if err != nil || !found {
+		t.Fatalf("Delete: %v, %v", found, err)
+	}
+	if _, ok := watcher.records.Lookup("nas.example.com"); ok {
+		t.Error("expected the record to be removed")
+	}
+	if e := <-events; e.added || e.hostname != "nas.example.com" {
+		t.Errorf("expected the removal to be announced, got %+v", e)
+	}
+	if found, _ := m.Delete("nas.example.com"); found {
+		t.Error("expected deleting a missing record to report false")
+	}
+}
+
+func TestManualRecordsValidation(t *testing.T) {
+	m := NewManualRecords(filepath.Join(t.TempDir(), "manual.json"), NewDockerWatcher("", "192.168.1.100", nil, NewRecords()))
+	past := time.Now().Add(-time.Minute)
+	for _, rec := range []ManualRecord{
+		{Hostname: "nas.example.com"},
+		{Hostname: "bad_name.example.com", IP: "10.0.0.50"},
+		{Hostname: "nas.example.com", IP: "fd00::50"},
+		{Hostname: "nas.example.com", IPv6: "10.0.0.50"},
+		{Hostname: "nas.example.com", IP: "10.0.0.50", Expires: &past},
+	} {
+		if _, err := m.Set(rec); err == nil {
+			t.Errorf("%+v: expected error", rec)
+		}
+	}
+	if len(m.List()) != 0 {
+		t.Errorf("expected no records, got %+v", m.List())
+	}
+}
+
+func TestManualRecordsSurviveDockerSync(t *testing.T) {
+	watcher := NewDockerWatcher("", "192.168.1.100", nil, NewRecords())
+	watcher.owners.policy = ConflictFirstWins
+	m := NewManualRecords(filepath.Join(t.TempDir(), "manual.json"), watcher)
+	if _, err := m.Set(ManualRecord{Hostname: "app.example.com", IP: "10.0.0.50"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	watcher.updateContainer("app", []string{"app.example.com"}, RecordEntry{IP: "192.168.1.100"})
+	watcher.removeContainer("app")
+
+	entry, ok := watcher.records.LookupEntry("app.example.com")
+	if !ok || entry.IP != "10.0.0.50" || !entry.Manual {
+		t.Errorf("expected the manual record to remain, got %+v (found %v)", entry, ok)
+	}
+}
+
+func TestManualRecordsLoadAndExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manual.json")
+	soon, past := time.Now().Add(time.Hour), time.Now().Add(-time.Minute)
+	data, err := json.Marshal([]ManualRecord{
+		{Hostname: "nas.example.com", IP: "10.0.0.50"},
+		{Hostname: "temp.example.com", IP: "10.0.0.51", Expires: &soon},
+		{Hostname: "old.example.com", IP: "10.0.0.52", Expires: &past},
+		{Hostname: "bad_name.example.com", IP: "10.0.0.53"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := NewDockerWatcher("", "192.168.1.100", nil, NewRecords())
+	m := NewManualRecords(path, watcher)
+	n, err := m.Load()
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 records loaded, got %d, %v", n, err)
+	}
+	if _, ok := watcher.records.Lookup("temp.example.com"); !ok {
+		t.Error("expected the unexpired record to be served")
+	}
+
+	m.expire(soon)
+	if _, ok := watcher.records.Lookup("temp.example.com"); ok {
+		t.Error("expected the expired record to be removed")
+	}
+	if list := m.List(); len(list) != 1 || list[0].Hostname != "nas.example.com" {
+		t.Errorf("unexpected records after expiry %+v", list)
+	}
+
+	reloaded := NewManualRecords(path, NewDockerWatcher("", "192.168.1.100", nil, NewRecords()))
+	if n, err := reloaded.Load(); err != nil || n != 1 {
+		t.Errorf("expected the expiry to be persisted, loaded %d, %v", n, err)
+	}
+}
+
+func TestManualRecordHandlers(t *testing.T) {
+	records := NewRecords()
+	records.SetLocalNode("node1")
+	watcher := NewDockerWatcher("", "192.168.1.100", nil, records)
+	dc := &DockerCluster{
+		Records:    watcher.records,
+		Watcher:    watcher,
+		TTL:        60,
+		Manual:     NewManualRecords(filepath.Join(t.TempDir(), "manual.json"), watcher),
+		AdminToken: "s3cret",
+	}
+	mux := dc.adminHandler()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"hostname": "nas.example.com", "ip": "10.0.0.50", "expires_in": "1h"}`
+	for _, token := range []string{"", "wrong"} {
+		if rec := do(http.MethodPost, "/records", token, body); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: expected 401, got %d", token, rec.Code)
+		}
+	}
+	for _, bad := range []string{`{"hostname": "nas.example.com"}`, `{"hostname": "nas.example.com", "ip": "10.0.0.50", "port": 80}`, `{"hostname": "nas.example.com", "ip": "10.0.0.50", "expires_in": "-1h"}`} {
+		if rec := do(http.MethodPost, "/records", "s3cret", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, rec.Code)
+		}
+	}
+
+	rec := do(http.MethodPost, "/records", "s3cret", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created manualResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if created.Expires == nil || time.Until(*created.Expires) <= 0 || created.NodeID != "node1" {
+		t.Errorf("expected an expiry and the local node, got %+v", created)
+	}
+
+	if rec := do(http.MethodGet, "/records/nas.example.com", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a read without token, got %d", rec.Code)
+	}
+	rec = do(http.MethodGet, "/records/nas.example.com", "s3cret", "")
+	var views []RecordView
+	if err := json.Unmarshal(rec.Body.Bytes(), &views); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(views) != 1 || views[0].Source != "manual" || views[0].IP != "10.0.0.50" {
+		t.Errorf("unexpected record %+v", views)
+	}
+
+	if rec := do(http.MethodDelete, "/records/nas.example.com", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/records/nas.example.com", "s3cret", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/records/nas.example.com", "s3cret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted record, got %d", rec.Code)
+	}
+
+	// Another node's manual record can only be changed on that node
+	watcher.records.AddEntryWithMeta("vm.example.com", RecordEntry{IP: "10.0.0.60", Timestamp: 1, NodeID: "node2", Manual: true})
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPost, "/records", `{"hostname": "vm.example.com", "ip": "10.0.0.61"}`},
+		{http.MethodDelete, "/records/vm.example.com", ""},
+	} {
+		rec := do(req.method, req.path, "s3cret", req.body)
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "node2") {
+			t.Errorf("%s %s: expected 409 naming node2, got %d: %s", req.method, req.path, rec.Code, rec.Body.String())
+		}
+	}
+	if entries := watcher.records.LookupAll("vm.example.com"); len(entries) != 1 || entries[0].NodeID != "node2" {
+		t.Errorf("expected node2's record to be left alone, got %+v", entries)
+	}
+}
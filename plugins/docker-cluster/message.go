@@ -2,6 +2,8 @@ package dockercluster
 
 import (
 	"encoding/json"
+
+	"github.com/coredns/coredns/plugin/internal/queryhits"
 )
 
 // RecordAction defines the type of record operation for gossip messages.
@@ -18,27 +20,107 @@ const (
 // These messages are broadcast to cluster peers when local Docker
 // containers start or stop.
 type RecordMessage struct {
-	Hostname  string       `json:"h"` // Hostname (lowercase, without trailing dot)
-	IP        string       `json:"i"` // IP address to resolve to
-	Action    RecordAction `json:"a"` // Add or Remove
-	Timestamp int64        `json:"t"` // Unix nanosecond timestamp for LWW
-	NodeID    string       `json:"n"` // Source node identifier
+	Hostname  string         `json:"h"`            // Hostname (lowercase, without trailing dot)
+	IP        string         `json:"i"`            // IPv4 address to resolve to
+	IPv6      string         `json:"6,omitempty"`  // IPv6 address to resolve to
+	Addrs     []string       `json:"x,omitempty"`  // Further addresses of either family, e.g. every Swarm node running a service
+	CNAME     string         `json:"cn,omitempty"` // Alias target; set instead of addresses
+	TTL       uint32         `json:"l,omitempty"`  // Answer TTL in seconds; 0 uses the plugin's ttl
+	SRV       []SRVPort      `json:"s,omitempty"`  // SRV records served under the hostname
+	Container *ContainerInfo `json:"c,omitempty"`  // Container that registered the hostname
+	Manual    bool           `json:"m,omitempty"`  // Created through the admin API rather than by a container
+	Action    RecordAction   `json:"a"`            // Add or Remove
+	Timestamp int64          `json:"t"`            // Unix nanosecond timestamp for LWW
+	NodeID    string         `json:"n"`            // Source node identifier
 }
 
 // RecordEntry stores a DNS record with metadata for conflict resolution.
 // Used in both local storage and full state synchronization.
 type RecordEntry struct {
-	IP        string `json:"i"` // IP address
-	Timestamp int64  `json:"t"` // Unix nanosecond timestamp
-	NodeID    string `json:"n"` // Node that created/updated this record
+	IP        string         `json:"i"`            // IPv4 address
+	IPv6      string         `json:"6,omitempty"`  // IPv6 address
+	Addrs     []string       `json:"x,omitempty"`  // Further addresses of either family, e.g. every Swarm node running a service
+	CNAME     string         `json:"cn,omitempty"` // Alias target; set instead of addresses
+	TTL       uint32         `json:"l,omitempty"`  // Answer TTL in seconds; 0 uses the plugin's ttl
+	SRV       []SRVPort      `json:"s,omitempty"`  // SRV records served under the hostname
+	Container *ContainerInfo `json:"c,omitempty"`  // Container that registered the hostname
+	Manual    bool           `json:"m,omitempty"`  // Created through the admin API rather than by a container
+	Timestamp int64          `json:"t"`            // Unix nanosecond timestamp
+	NodeID    string         `json:"n"`            // Node that created/updated this record
+
+	// restored marks an entry loaded from a state file that its node has not
+	// confirmed since; it is answered with the snapshot's stale_ttl.
+	restored bool
+}
+
+// SRVPort describes an SRV record _service._proto.<hostname> pointing at the
+// hostname on Port.
+type SRVPort struct {
+	Service string `json:"s"` // Service label with leading underscore, e.g. "_http"
+	Proto   string `json:"p"` // Protocol label with leading underscore, "_tcp" or "_udp"
+	Port    uint16 `json:"o"` // Port the service listens on
+}
+
+// ContainerInfo identifies the container behind a record, for diagnostics.
+type ContainerInfo struct {
+	ID    string `json:"id"`    // Full container ID
+	Name  string `json:"name"`  // Container name without the leading slash
+	Image string `json:"image"` // Image reference the container was started from
 }
 
 // FullState represents the complete DNS record state of a node.
 // Used for TCP-based full state synchronization during cluster joins
 // and periodic anti-entropy syncs.
+//
+// Records travel as "entries". Nodes from before hostnames had one entry per
+// owning node read and send only "records", one entry per hostname, so that
+// field is still written (each hostname's newest entry) and read from them,
+// which keeps push/pull working during a rolling upgrade. It can be dropped
+// once no such node remains.
 type FullState struct {
-	NodeID  string                 `json:"node"`    // Source node identifier
-	Records map[string]RecordEntry `json:"records"` // hostname -> record entry
+	NodeID  string                     `json:"node"`           // Source node identifier
+	Records map[string][]RecordEntry   `json:"entries"`        // hostname -> one entry per owning node
+	Hits    map[string]queryhits.Count `json:"hits,omitempty"` // Source node's query counts by record name
+}
+
+// fullStateJSON is a FullState with the legacy "records" field.
+type fullStateJSON struct {
+	FullState
+	Legacy map[string]RecordEntry `json:"records"` // hostname -> newest entry
+}
+
+// newAddMessage builds the RecordActionAdd message announcing entry for hostname.
+func newAddMessage(hostname string, entry RecordEntry) *RecordMessage {
+	return &RecordMessage{
+		Hostname:  hostname,
+		IP:        entry.IP,
+		IPv6:      entry.IPv6,
+		Addrs:     entry.Addrs,
+		CNAME:     entry.CNAME,
+		TTL:       entry.TTL,
+		SRV:       entry.SRV,
+		Container: entry.Container,
+		Manual:    entry.Manual,
+		Action:    RecordActionAdd,
+		Timestamp: entry.Timestamp,
+		NodeID:    entry.NodeID,
+	}
+}
+
+// Entry returns the record an add message carries.
+func (m *RecordMessage) Entry() RecordEntry {
+	return RecordEntry{
+		IP:        m.IP,
+		IPv6:      m.IPv6,
+		Addrs:     m.Addrs,
+		CNAME:     m.CNAME,
+		TTL:       m.TTL,
+		SRV:       m.SRV,
+		Container: m.Container,
+		Manual:    m.Manual,
+		Timestamp: m.Timestamp,
+		NodeID:    m.NodeID,
+	}
 }
 
 // Encode serializes a RecordMessage to JSON bytes for gossip transmission.
@@ -55,24 +137,41 @@ func DecodeRecordMessage(data []byte) (*RecordMessage, error) {
 	return &m, nil
 }
 
-// Encode serializes a FullState to JSON bytes for TCP state sync.
+// Encode serializes a FullState to JSON bytes for TCP state sync, with the
+// legacy "records" field.
 func (s *FullState) Encode() ([]byte, error) {
-	return json.Marshal(s)
+	legacy := make(map[string]RecordEntry, len(s.Records))
+	for hostname, entries := range s.Records {
+		for i, e := range entries {
+			if i == 0 || newer(e, legacy[hostname]) {
+				legacy[hostname] = e
+			}
+		}
+	}
+	return json.Marshal(fullStateJSON{FullState: *s, Legacy: legacy})
 }
 
-// DecodeFullState deserializes JSON bytes into a FullState.
+// DecodeFullState deserializes JSON bytes into a FullState. State without
+// "entries", sent by a node from before multi-owner records, is read from
+// the legacy "records" field.
 func DecodeFullState(data []byte) (*FullState, error) {
-	var s FullState
+	var s fullStateJSON
 	if err := json.Unmarshal(data, &s); err != nil {
 		return nil, err
 	}
-	return &s, nil
+	if s.Records == nil && s.Legacy != nil {
+		s.Records = make(map[string][]RecordEntry, len(s.Legacy))
+		for hostname, e := range s.Legacy {
+			s.Records[hostname] = []RecordEntry{e}
+		}
+	}
+	return &s.FullState, nil
 }
 
 // NewFullState creates a new FullState with the given node ID and empty records.
 func NewFullState(nodeID string) *FullState {
 	return &FullState{
 		NodeID:  nodeID,
-		Records: make(map[string]RecordEntry),
+		Records: make(map[string][]RecordEntry),
 	}
 }
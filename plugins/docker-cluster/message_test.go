@@ -1,6 +1,7 @@
 package dockercluster
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -107,19 +108,19 @@ func TestFullStateEncodeDecode(t *testing.T) {
 			name: "empty state",
 			state: FullState{
 				NodeID:  "node1",
-				Records: map[string]RecordEntry{},
+				Records: map[string][]RecordEntry{},
 			},
 		},
 		{
 			name: "single record",
 			state: FullState{
 				NodeID: "node1",
-				Records: map[string]RecordEntry{
-					"app.example.com": {
+				Records: map[string][]RecordEntry{
+					"app.example.com": {{
 						IP:        "192.168.1.100",
 						Timestamp: 1234567890123456789,
 						NodeID:    "node1",
-					},
+					}},
 				},
 			},
 		},
@@ -127,22 +128,22 @@ func TestFullStateEncodeDecode(t *testing.T) {
 			name: "multiple records",
 			state: FullState{
 				NodeID: "node2",
-				Records: map[string]RecordEntry{
-					"app.example.com": {
+				Records: map[string][]RecordEntry{
+					"app.example.com": {{
 						IP:        "192.168.1.100",
 						Timestamp: 1000000000000000000,
 						NodeID:    "node1",
-					},
-					"api.example.com": {
+					}},
+					"api.example.com": {{
 						IP:        "192.168.1.101",
 						Timestamp: 2000000000000000000,
 						NodeID:    "node2",
-					},
-					"web.example.com": {
+					}},
+					"web.example.com": {{
 						IP:        "192.168.1.102",
 						Timestamp: 3000000000000000000,
 						NodeID:    "node3",
-					},
+					}},
 				},
 			},
 		},
@@ -168,12 +169,14 @@ func TestFullStateEncodeDecode(t *testing.T) {
 				t.Fatalf("Records len = %d, want %d", len(decoded.Records), len(tt.state.Records))
 			}
 
-			for hostname, want := range tt.state.Records {
-				got, ok := decoded.Records[hostname]
-				if !ok {
+			for hostname, wants := range tt.state.Records {
+				want := wants[0]
+				entries, ok := decoded.Records[hostname]
+				if !ok || len(entries) != 1 {
 					t.Errorf("Record %q not found", hostname)
 					continue
 				}
+				got := entries[0]
 				if got.IP != want.IP {
 					t.Errorf("Record[%q].IP = %q, want %q", hostname, got.IP, want.IP)
 				}
@@ -263,16 +266,16 @@ func BenchmarkRecordMessageDecode(b *testing.B) {
 func BenchmarkFullStateEncode(b *testing.B) {
 	state := FullState{
 		NodeID:  "node1",
-		Records: make(map[string]RecordEntry),
+		Records: make(map[string][]RecordEntry),
 	}
 	// Add 100 records
 	for i := 0; i < 100; i++ {
 		hostname := "app" + string(rune('0'+i%10)) + ".example.com"
-		state.Records[hostname] = RecordEntry{
+		state.Records[hostname] = []RecordEntry{{
 			IP:        "192.168.1.100",
 			Timestamp: int64(i) * 1000000000,
 			NodeID:    "node1",
-		}
+		}}
 	}
 
 	b.ResetTimer()
@@ -280,3 +283,116 @@ func BenchmarkFullStateEncode(b *testing.B) {
 		_, _ = state.Encode()
 	}
 }
+
+func TestRecordMessageCarriesSRV(t *testing.T) {
+	entry := RecordEntry{
+		IP:        "10.0.0.1",
+		SRV:       []SRVPort{{Service: "_http", Proto: "_tcp", Port: 8080}},
+		Timestamp: 1000,
+		NodeID:    "node1",
+	}
+
+	encoded, err := newAddMessage("app.example.com", entry).Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	decoded, err := DecodeRecordMessage(encoded)
+	if err != nil {
+		t.Fatalf("DecodeRecordMessage() error = %v", err)
+	}
+
+	r := NewRecords()
+	if !r.ApplyMessage(decoded) {
+		t.Fatal("expected message to be applied")
+	}
+	got := r.LookupAll("app.example.com")
+	if len(got) != 1 || len(got[0].SRV) != 1 || got[0].SRV[0] != entry.SRV[0] {
+		t.Errorf("expected replicated SRV %v, got %+v", entry.SRV, got)
+	}
+}
+
+func TestRecordMessageCarriesCNAME(t *testing.T) {
+	entry := RecordEntry{CNAME: "app.example.com", Timestamp: 1000, NodeID: "node1"}
+
+	encoded, err := newAddMessage("www.example.com", entry).Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	decoded, err := DecodeRecordMessage(encoded)
+	if err != nil {
+		t.Fatalf("DecodeRecordMessage() error = %v", err)
+	}
+
+	r := NewRecords()
+	if !r.ApplyMessage(decoded) {
+		t.Fatal("expected message to be applied")
+	}
+	got := r.LookupAll("www.example.com")
+	if len(got) != 1 || got[0].CNAME != "app.example.com" {
+		t.Errorf("expected replicated CNAME app.example.com, got %+v", got)
+	}
+}
+
+func TestRecordMessageCarriesTTL(t *testing.T) {
+	entry := RecordEntry{IP: "10.0.0.1", TTL: 5, Timestamp: 1000, NodeID: "node1"}
+
+	encoded, err := newAddMessage("app.example.com", entry).Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	decoded, err := DecodeRecordMessage(encoded)
+	if err != nil {
+		t.Fatalf("DecodeRecordMessage() error = %v", err)
+	}
+	if got := decoded.Entry(); got.TTL != 5 {
+		t.Errorf("expected replicated TTL 5, got %d", got.TTL)
+	}
+}
+
+func TestRecordMessageCarriesAddrs(t *testing.T) {
+	entry := RecordEntry{IP: "10.0.0.1", Addrs: []string{"10.0.0.2", "fd00::2"}, Timestamp: 1000, NodeID: "node1"}
+
+	encoded, err := newAddMessage("app.example.com", entry).Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	decoded, err := DecodeRecordMessage(encoded)
+	if err != nil {
+		t.Fatalf("DecodeRecordMessage() error = %v", err)
+	}
+	if got := decoded.Entry(); !equalSlice(got.Addrs, entry.Addrs) {
+		t.Errorf("expected replicated addresses %v, got %v", entry.Addrs, got.Addrs)
+	}
+}
+
+func TestFullStateLegacyRecords(t *testing.T) {
+	// A node from before multi-owner records sends one entry per hostname
+	legacy := []byte(`{"node":"old","records":{"app.example.com":{"i":"10.0.0.1","t":1000,"n":"old"}}}`)
+	state, err := DecodeFullState(legacy)
+	if err != nil {
+		t.Fatalf("DecodeFullState() error = %v", err)
+	}
+	if entries := state.Records["app.example.com"]; len(entries) != 1 || entries[0].IP != "10.0.0.1" || entries[0].NodeID != "old" {
+		t.Errorf("unexpected records %+v", state.Records)
+	}
+
+	// and reads only "records", which must hold each hostname's newest entry
+	encoded, err := (&FullState{NodeID: "new", Records: map[string][]RecordEntry{
+		"app.example.com": {
+			{IP: "10.0.0.1", Timestamp: 1000, NodeID: "node1"},
+			{IP: "10.0.0.2", Timestamp: 2000, NodeID: "node2"},
+		},
+	}}).Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	var old struct {
+		Records map[string]RecordEntry `json:"records"`
+	}
+	if err := json.Unmarshal(encoded, &old); err != nil {
+		t.Fatalf("legacy decode error = %v", err)
+	}
+	if e := old.Records["app.example.com"]; e.IP != "10.0.0.2" || e.NodeID != "node2" {
+		t.Errorf("expected the newest entry in the legacy field, got %+v", e)
+	}
+}
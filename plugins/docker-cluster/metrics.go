@@ -0,0 +1,130 @@
+package dockercluster
+
+import (
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/internal/queryhits"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics for docker-cluster plugin
+var (
+	// queriesTotal counts DNS queries by result: hit (answered from records),
+	// miss (passed to the next plugin), drop or nxdomain (unknown_action)
+	queriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "queries_total",
+		Help:      "Total number of DNS queries handled by docker-cluster, by query type and result.",
+	}, []string{"type", "result"})
+
+	// recordsTotal tracks the current number of record entries by owner
+	recordsTotal = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "records_total",
+		Help:      "Number of DNS record entries currently stored, by source (local or remote node).",
+	}, []string{"source"})
+
+	// dockerConnected tracks whether each Docker daemon is connected
+	dockerConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "docker_connected",
+		Help:      "Whether the Docker daemon is connected (1) or not (0).",
+	}, []string{"endpoint"})
+
+	// dockerReconnectsTotal counts connection retries after a failure
+	dockerReconnectsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "docker_reconnects_total",
+		Help:      "Total number of Docker daemon reconnection attempts after a failure.",
+	}, []string{"endpoint"})
+
+	// dockerBackoff tracks the current reconnect delay (0 while connected)
+	dockerBackoff = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "docker_backoff_seconds",
+		Help:      "Current delay before reconnecting to the Docker daemon, 0 while connected.",
+	}, []string{"endpoint"})
+
+	// dockerEventsTotal counts processed Docker events
+	dockerEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "docker_events_total",
+		Help:      "Total number of Docker events processed, by type and action.",
+	}, []string{"type", "action"})
+
+	// syncDuration observes full container syncs
+	syncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "sync_duration_seconds",
+		Help:      "Duration of full container syncs with a Docker daemon.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	// clusterMembers tracks the cluster members this node sees, itself included
+	clusterMembers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "cluster_members",
+		Help:      "Number of cluster members, this node included.",
+	})
+
+	// gossipSentTotal counts record messages queued for broadcast
+	gossipSentTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "gossip_messages_sent_total",
+		Help:      "Total number of record messages broadcast to cluster peers.",
+	})
+
+	// gossipReceivedTotal counts record messages received from peers
+	gossipReceivedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "gossip_messages_received_total",
+		Help:      "Total number of record messages received from cluster peers.",
+	})
+
+	// gossipStaleTotal counts received messages rejected by LWW
+	gossipStaleTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "gossip_messages_stale_total",
+		Help:      "Total number of received record messages rejected as stale.",
+	})
+
+	// gossipDroppedTotal counts received messages dropped on a full queue
+	gossipDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "gossip_messages_dropped_total",
+		Help:      "Total number of received record messages dropped because the processing queue was full.",
+	})
+
+	// hostnameConflicts tracks the hostnames currently claimed by more than one local container
+	hostnameConflicts = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "hostname_conflicts",
+		Help:      "Number of hostnames currently claimed by more than one local container.",
+	})
+
+	// conflictsTotal counts containers claiming a hostname another local container already claims
+	conflictsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "docker_cluster",
+		Name:      "hostname_conflicts_total",
+		Help:      "Total number of times a container claimed a hostname already claimed by another local container.",
+	})
+)
+
+// hostnamesUnqueried reports, by window, the records not queried within it
+// across the cluster (see queryhits.NewUnqueriedGauges).
+var hostnamesUnqueried = queryhits.NewUnqueriedGauges("docker_cluster",
+	"Number of record names not queried within the window, or never queried since startup, across the cluster.", recordHits)
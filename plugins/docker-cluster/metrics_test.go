@@ -0,0 +1,155 @@
+package dockercluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/fall"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueriesTotalResults(t *testing.T) {
+	records := NewRecords()
+	records.Add("app.example.com", "192.168.1.100")
+	next := test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		return dns.RcodeSuccess, nil
+	})
+
+	var through fall.F
+	through.SetZonesFromArgs([]string{})
+
+	tests := []struct {
+		name   string
+		dc     *DockerCluster
+		qname  string
+		result string
+	}{
+		{name: "hit", dc: &DockerCluster{Records: records, TTL: 60}, qname: "app.example.com.", result: "hit"},
+		{name: "drop", dc: &DockerCluster{Records: records, TTL: 60}, qname: "unknown.example.com.", result: "drop"},
+		{name: "nxdomain", dc: &DockerCluster{Records: records, TTL: 60, UnknownAction: ActionNXDomain}, qname: "unknown.example.com.", result: "nxdomain"},
+		{name: "fallthrough", dc: &DockerCluster{Records: records, TTL: 60, Fall: through, Next: next}, qname: "unknown.example.com.", result: "miss"},
+		{name: "outside zones", dc: &DockerCluster{Records: records, TTL: 60, Zones: []string{"example.com."}, Next: next}, qname: "app.example.org.", result: "miss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := queriesTotal.WithLabelValues("A", tt.result)
+			before := testutil.ToFloat64(counter)
+
+			req := new(dns.Msg)
+			req.SetQuestion(tt.qname, dns.TypeA)
+			tt.dc.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("expected one %s query counted, got %v", tt.result, got)
+			}
+		})
+	}
+}
+
+func TestRecordsTotalBySource(t *testing.T) {
+	local, remote := recordsTotal.WithLabelValues("local"), recordsTotal.WithLabelValues("remote")
+	baseLocal, baseRemote := testutil.ToFloat64(local), testutil.ToFloat64(remote)
+	check := func(step string, wantLocal, wantRemote float64) {
+		t.Helper()
+		if got := testutil.ToFloat64(local) - baseLocal; got != wantLocal {
+			t.Errorf("%s: expected %v local entries, got %v", step, wantLocal, got)
+		}
+		if got := testutil.ToFloat64(remote) - baseRemote; got != wantRemote {
+			t.Errorf("%s: expected %v remote entries, got %v", step, wantRemote, got)
+		}
+	}
+
+	r := NewRecords()
+	r.AddEntry("app.example.com", RecordEntry{IP: "10.0.0.1"})
+	r.SetLocalNode("node1")
+	r.AddEntryWithMeta("app.example.com", RecordEntry{IP: "10.0.0.2", Timestamp: 1, NodeID: "node2"})
+	r.AddEntryWithMeta("web.example.com", RecordEntry{IP: "10.0.0.3", Timestamp: 1, NodeID: "node3"})
+	check("added", 1, 2)
+
+	r.Remove("app.example.com")
+	r.RemoveNode("node3")
+	check("removed", 0, 1)
+
+	r.uncount()
+	check("uncounted", 0, 0)
+}
+
+func TestGossipMetrics(t *testing.T) {
+	records := NewRecords()
+	d := NewClusterDelegate("node1", records, func() int { return 1 })
+	d.Start(context.Background())
+	defer d.Stop()
+
+	received, stale := testutil.ToFloat64(gossipReceivedTotal), testutil.ToFloat64(gossipStaleTotal)
+	for _, ts := range []int64{2000, 1000} {
+		msg := &RecordMessage{Hostname: "app.example.com", IP: "10.0.0.2", Action: RecordActionAdd, Timestamp: ts, NodeID: "node2"}
+		data, err := msg.Encode()
+		if err != nil {
+			t.Fatalf("failed to encode message: %v", err)
+		}
+		d.NotifyMsg(data)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(gossipReceivedTotal)-received < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("messages were not processed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(gossipStaleTotal) - stale; got != 1 {
+		t.Errorf("expected the older message to be counted as stale, got %v", got)
+	}
+
+	sent := testutil.ToFloat64(gossipSentTotal)
+	d.BroadcastRecord(&RecordMessage{Hostname: "app.example.com", IP: "10.0.0.1", Action: RecordActionAdd, Timestamp: 1, NodeID: "node1"})
+	if got := testutil.ToFloat64(gossipSentTotal) - sent; got != 1 {
+		t.Errorf("expected one sent message, got %v", got)
+	}
+}
+
+func TestGossipDroppedOnFullQueue(t *testing.T) {
+	d := NewClusterDelegate("node1", NewRecords(), func() int { return 1 })
+	msg := &RecordMessage{Hostname: "app.example.com", IP: "10.0.0.2", Action: RecordActionAdd, Timestamp: 1, NodeID: "node2"}
+	data, err := msg.Encode()
+	if err != nil {
+		t.Fatalf("failed to encode message: %v", err)
+	}
+
+	// Nothing drains the queue until Start
+	for range cap(d.msgChan) {
+		d.NotifyMsg(data)
+	}
+	dropped := testutil.ToFloat64(gossipDroppedTotal)
+	d.NotifyMsg(data)
+	if got := testutil.ToFloat64(gossipDroppedTotal) - dropped; got != 1 {
+		t.Errorf("expected one dropped message, got %v", got)
+	}
+}
+
+func TestHostnamesUnqueried(t *testing.T) {
+	before := map[string]float64{}
+	for window, gauge := range hostnamesUnqueried {
+		before[window] = testutil.ToFloat64(gauge)
+	}
+
+	records := NewRecords()
+	records.Add("busy.example.com", "192.168.1.100")
+	records.Add("old.example.com", "192.168.1.100")
+	records.Add("idle.example.com", "192.168.1.100")
+	hits := NewHitTracker()
+	hits.Record("busy.example.com", time.Now())
+	hits.Record("old.example.com", time.Now().Add(-2*time.Hour))
+	backends.acquire("metrics-test", func() (*backend, error) { return &backend{records: records, hits: hits}, nil })
+	defer backends.release("metrics-test", func(*backend) {})
+
+	for window, want := range map[string]float64{"1h": 2, "24h": 1, "7d": 1, "never": 1} {
+		if got := testutil.ToFloat64(hostnamesUnqueried[window]) - before[window]; got != want {
+			t.Errorf("window %s: expected %v unqueried hostnames, got %v", window, want, got)
+		}
+	}
+}
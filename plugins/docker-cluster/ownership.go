@@ -0,0 +1,319 @@
+package dockercluster
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// ConflictPolicy selects the record a hostname serves when several local
+// containers claim it.
+type ConflictPolicy int
+
+const (
+	// ConflictLastWins serves the most recent claimant's record - default
+	ConflictLastWins ConflictPolicy = iota
+	// ConflictFirstWins serves the earliest claimant's record until it goes away
+	ConflictFirstWins
+	// ConflictMulti serves the addresses of every claimant
+	ConflictMulti
+)
+
+// String returns the Corefile name of the policy.
+func (p ConflictPolicy) String() string {
+	switch p {
+	case ConflictFirstWins:
+		return "first-wins"
+	case ConflictMulti:
+		return "multi-value"
+	default:
+		return "last-wins"
+	}
+}
+
+// parseConflictPolicy converts a string to ConflictPolicy.
+func parseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "last-wins":
+		return ConflictLastWins, nil
+	case "first-wins":
+		return ConflictFirstWins, nil
+	case "multi-value", "multi":
+		return ConflictMulti, nil
+	default:
+		return ConflictLastWins, fmt.Errorf("unknown conflict policy: %s", s)
+	}
+}
+
+// claim is a container's claim on a hostname.
+type claim struct {
+	daemon string // Docker endpoint the container runs on
+	id     string // Container ID, or service key for Swarm services
+	entry  RecordEntry
+}
+
+// recordChange is a change of a published record, reported to the
+// RecordChangeCallback.
+type recordChange struct {
+	hostname string
+	entry    RecordEntry
+	added    bool
+}
+
+// owners tracks which containers claim each hostname, across the watchers
+// of all daemons, and publishes the record the conflict policy selects. A
+// hostname's record is only removed when its last claimant goes away.
+type owners struct {
+	mu        sync.Mutex
+	policy    ConflictPolicy
+	records   *Records
+	claims    map[string][]claim     // hostname -> claims, oldest first
+	published map[string]RecordEntry // hostname -> record currently served
+}
+
+// newOwners creates an empty ownership index publishing to records.
+func newOwners(records *Records, policy ConflictPolicy) *owners {
+	return &owners{
+		policy:    policy,
+		records:   records,
+		claims:    make(map[string][]claim),
+		published: make(map[string]RecordEntry),
+	}
+}
+
+// update sets the claims of container id on daemon: it claims hostnames
+// with entry and releases the oldHostnames it no longer lists (pass no
+// hostnames to release all). Returns the resulting record changes.
+func (o *owners) update(daemon, id string, oldHostnames, hostnames []string, entry RecordEntry) []recordChange {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Records are case-insensitive, so are claims
+	oldHostnames, hostnames = lowerAll(oldHostnames), lowerAll(hostnames)
+
+	var affected []string
+	for _, h := range oldHostnames {
+		if !slices.Contains(hostnames, h) {
+			o.release(h, daemon, id)
+			affected = append(affected, h)
+		}
+	}
+	for _, h := range hostnames {
+		o.claim(h, claim{daemon: daemon, id: id, entry: entry})
+		affected = append(affected, h)
+	}
+
+	ts := time.Now().UnixNano()
+	var changes []recordChange
+	for _, h := range affected {
+		if change, ok := o.publish(h, ts); ok {
+			changes = append(changes, change)
+		}
+	}
+	hostnameConflicts.Set(float64(o.conflictCount()))
+	return changes
+}
+
+// claim adds or refreshes a claim on hostname. A refreshed claim keeps its
+// place in the claim order.
+func (o *owners) claim(hostname string, c claim) {
+	claims := o.claims[hostname]
+	for i := range claims {
+		if claims[i].daemon == c.daemon && claims[i].id == c.id {
+			claims[i].entry = c.entry
+			return
+		}
+	}
+	o.claims[hostname] = append(claims, c)
+	if len(claims) > 0 {
+		conflictsTotal.Inc()
+		log.Warningf("docker-cluster: hostname %s claimed by %d containers %v, conflict_policy %s",
+			hostname, len(claims)+1, claimantNames(o.claims[hostname]), o.policy)
+	}
+}
+
+// release drops a container's claim on hostname.
+func (o *owners) release(hostname, daemon, id string) {
+	claims := slices.DeleteFunc(o.claims[hostname], func(c claim) bool {
+		return c.daemon == daemon && c.id == id
+	})
+	if len(claims) == 0 {
+		delete(o.claims, hostname)
+		return
+	}
+	o.claims[hostname] = claims
+	log.Infof("docker-cluster: container %s released hostname %s, still claimed by %v",
+		truncateID(id, 12), hostname, claimantNames(claims))
+}
+
+// publish brings the record of hostname in line with its claims. Releasing
+// a hostname that was never published changes nothing.
+func (o *owners) publish(hostname string, ts int64) (recordChange, bool) {
+	prev, served := o.published[hostname]
+	claims := o.claims[hostname]
+	if len(claims) == 0 {
+		if !served {
+			return recordChange{}, false
+		}
+		// The last claimant released it
+		delete(o.published, hostname)
+		o.records.Remove(hostname)
+		return recordChange{hostname: hostname, entry: RecordEntry{Timestamp: ts}}, true
+	}
+
+	entry := o.selected(claims)
+	if served && sameRecord(prev, entry) {
+		return recordChange{}, false
+	}
+	o.published[hostname] = entry
+	entry.Timestamp = ts
+	o.records.AddEntry(hostname, entry)
+	return recordChange{hostname: hostname, entry: entry, added: true}, true
+}
+
+// selected returns the record the policy serves for claims.
+func (o *owners) selected(claims []claim) RecordEntry {
+	switch {
+	case len(claims) == 1 || o.policy == ConflictFirstWins:
+		return claims[0].entry
+	case o.policy == ConflictMulti:
+		return mergeClaims(claims)
+	default:
+		return claims[len(claims)-1].entry
+	}
+}
+
+// serving reports whether the claim at index i of claims is served.
+func (o *owners) serving(claims []claim, i int) bool {
+	switch o.policy {
+	case ConflictFirstWins:
+		return i == 0
+	case ConflictMulti:
+		if claims[i].entry.CNAME == "" {
+			return true
+		}
+		// Aliases are only served if no claimant has addresses
+		return i == 0 && !slices.ContainsFunc(claims, func(c claim) bool { return c.entry.CNAME == "" })
+	default:
+		return i == len(claims)-1
+	}
+}
+
+// conflictCount returns the number of hostnames with more than one claim.
+func (o *owners) conflictCount() int {
+	n := 0
+	for _, claims := range o.claims {
+		if len(claims) > 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// HostnameConflict describes a hostname claimed by several local containers.
+type HostnameConflict struct {
+	Hostname string          `json:"hostname"`
+	Policy   string          `json:"policy"`
+	Claims   []HostnameClaim `json:"claims"`
+}
+
+// HostnameClaim is one container's claim in a HostnameConflict.
+type HostnameClaim struct {
+	Daemon    string         `json:"daemon,omitempty"`    // Docker endpoint the container runs on
+	Container *ContainerInfo `json:"container,omitempty"` // Claiming container
+	Serving   bool           `json:"serving"`             // Whether its record is served
+}
+
+// conflicts lists the hostnames with more than one claim, sorted by name.
+func (o *owners) conflicts() []HostnameConflict {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	conflicts := []HostnameConflict{}
+	for hostname, claims := range o.claims {
+		if len(claims) < 2 {
+			continue
+		}
+		conflict := HostnameConflict{Hostname: hostname, Policy: o.policy.String()}
+		for i, c := range claims {
+			conflict.Claims = append(conflict.Claims, HostnameClaim{
+				Daemon:    c.daemon,
+				Container: c.entry.Container,
+				Serving:   o.serving(claims, i),
+			})
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Hostname < conflicts[j].Hostname })
+	return conflicts
+}
+
+// mergeClaims combines the claims' addresses and SRV ports into one record
+// (multi-value). Aliases are only served if no claimant has addresses; the
+// lowest TTL applies, and the oldest claimant is reported as the container
+// (or the record as manual).
+func mergeClaims(claims []claim) RecordEntry {
+	var (
+		merged RecordEntry
+		addrs  []string
+		oldest = true
+	)
+	for _, c := range claims {
+		e := c.entry
+		if e.CNAME != "" {
+			continue
+		}
+		if oldest {
+			merged.Container, merged.Manual = e.Container, e.Manual
+			oldest = false
+		}
+		for _, addr := range append(e.addrs(false), e.addrs(true)...) {
+			if !slices.Contains(addrs, addr) {
+				addrs = append(addrs, addr)
+			}
+		}
+		for _, srv := range e.SRV {
+			if !slices.Contains(merged.SRV, srv) {
+				merged.SRV = append(merged.SRV, srv)
+			}
+		}
+		if e.TTL != 0 && (merged.TTL == 0 || e.TTL < merged.TTL) {
+			merged.TTL = e.TTL
+		}
+	}
+	if len(addrs) == 0 {
+		return claims[0].entry
+	}
+	merged.IP, merged.IPv6, merged.Addrs = splitAddrs(addrs)
+	return merged
+}
+
+// lowerAll returns names in lower case.
+func lowerAll(names []string) []string {
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	return lower
+}
+
+// claimantNames returns the container names (or short IDs) of claims.
+func claimantNames(claims []claim) []string {
+	names := make([]string, 0, len(claims))
+	for _, c := range claims {
+		switch {
+		case c.daemon == manualDaemon:
+			names = append(names, "manual")
+		case c.entry.Container != nil && c.entry.Container.Name != "":
+			names = append(names, c.entry.Container.Name)
+		default:
+			names = append(names, truncateID(c.id, 12))
+		}
+	}
+	return names
+}
@@ -0,0 +1,215 @@
+package dockercluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func claimEntry(ip, name string) RecordEntry {
+	return RecordEntry{IP: ip, Container: &ContainerInfo{ID: name + "-id", Name: name}}
+}
+
+func TestOwnersKeepRecordUntilLastClaimantReleases(t *testing.T) {
+	records := NewRecords()
+	o := newOwners(records, ConflictLastWins)
+	hostnames := []string{"app.example.com"}
+
+	o.update("", "blue", nil, hostnames, claimEntry("10.0.0.1", "blue"))
+	o.update("", "green", nil, hostnames, claimEntry("10.0.0.2", "green"))
+	if ip, _ := records.Lookup("app.example.com"); ip != "10.0.0.2" {
+		t.Fatalf("expected the last claimant's 10.0.0.2, got %q", ip)
+	}
+
+	changes := o.update("", "green", hostnames, nil, RecordEntry{})
+	if ip, ok := records.Lookup("app.example.com"); !ok || ip != "10.0.0.1" {
+		t.Fatalf("expected the remaining claimant's 10.0.0.1, got %q (found %v)", ip, ok)
+	}
+	if len(changes) != 1 || !changes[0].added || changes[0].entry.IP != "10.0.0.1" {
+		t.Errorf("expected the remaining claimant's record to be announced, got %+v", changes)
+	}
+
+	changes = o.update("", "blue", hostnames, nil, RecordEntry{})
+	if _, ok := records.Lookup("app.example.com"); ok {
+		t.Fatal("record still exists after the last claimant released it")
+	}
+	if len(changes) != 1 || changes[0].added {
+		t.Errorf("expected a removal, got %+v", changes)
+	}
+}
+
+func TestOwnersIgnoreReleaseOfUnpublishedHostname(t *testing.T) {
+	records := NewRecords()
+	records.Add("other.example.com", "10.0.0.9")
+	o := newOwners(records, ConflictLastWins)
+
+	changes := o.update("", "blue", []string{"other.example.com"}, nil, RecordEntry{})
+	if len(changes) != 0 {
+		t.Errorf("expected no change for a hostname never published, got %+v", changes)
+	}
+	if _, ok := records.Lookup("other.example.com"); !ok {
+		t.Error("expected a record this owner never published to stay")
+	}
+}
+
+func TestOwnersPolicies(t *testing.T) {
+	tests := []struct {
+		policy    ConflictPolicy
+		wantIP    string
+		wantAddrs []string
+	}{
+		{policy: ConflictLastWins, wantIP: "10.0.0.2"},
+		{policy: ConflictFirstWins, wantIP: "10.0.0.1"},
+		{policy: ConflictMulti, wantIP: "10.0.0.1", wantAddrs: []string{"10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			records := NewRecords()
+			o := newOwners(records, tt.policy)
+			o.update("", "blue", nil, []string{"App.example.com"}, claimEntry("10.0.0.1", "blue"))
+			o.update("", "green", nil, []string{"app.example.com"}, claimEntry("10.0.0.2", "green"))
+
+			entry, ok := records.LookupEntry("app.example.com")
+			if !ok {
+				t.Fatal("expected a record")
+			}
+			if entry.IP != tt.wantIP || !slices.Equal(entry.Addrs, tt.wantAddrs) {
+				t.Errorf("got IP %s Addrs %v, want %s %v", entry.IP, entry.Addrs, tt.wantIP, tt.wantAddrs)
+			}
+		})
+	}
+}
+
+func TestOwnersRefreshKeepsClaimOrder(t *testing.T) {
+	records := NewRecords()
+	o := newOwners(records, ConflictFirstWins)
+	hostnames := []string{"app.example.com"}
+	o.update("", "blue", nil, hostnames, claimEntry("10.0.0.1", "blue"))
+	o.update("", "green", nil, hostnames, claimEntry("10.0.0.2", "green"))
+
+	// A resync refreshes blue's claim without moving it behind green's
+	if changes := o.update("", "blue", hostnames, hostnames, claimEntry("10.0.0.1", "blue")); len(changes) != 0 {
+		t.Errorf("expected no changes for an unchanged claim, got %+v", changes)
+	}
+	o.update("", "blue", hostnames, hostnames, claimEntry("10.0.0.3", "blue"))
+	if ip, _ := records.Lookup("app.example.com"); ip != "10.0.0.3" {
+		t.Errorf("expected blue's new address 10.0.0.3, got %q", ip)
+	}
+}
+
+func TestMergeClaims(t *testing.T) {
+	blue := RecordEntry{IP: "10.0.0.1", IPv6: "fd00::1", TTL: 60, SRV: []SRVPort{{Service: "_http", Proto: "_tcp", Port: 80}}}
+	green := RecordEntry{IP: "10.0.0.2", Addrs: []string{"10.0.0.1"}, TTL: 30, SRV: []SRVPort{{Service: "_http", Proto: "_tcp", Port: 80}}}
+	alias := RecordEntry{CNAME: "other.example.com"}
+
+	got := mergeClaims([]claim{{id: "alias", entry: alias}, {id: "blue", entry: blue}, {id: "green", entry: green}})
+	if got.IP != "10.0.0.1" || got.IPv6 != "fd00::1" || !slices.Equal(got.Addrs, []string{"10.0.0.2"}) {
+		t.Errorf("got IP %s IPv6 %s Addrs %v, want deduplicated addresses of blue and green", got.IP, got.IPv6, got.Addrs)
+	}
+	if got.CNAME != "" || got.TTL != 30 || len(got.SRV) != 1 {
+		t.Errorf("got CNAME %q TTL %d SRV %v, want no alias, the lowest TTL and one SRV entry", got.CNAME, got.TTL, got.SRV)
+	}
+
+	if got := mergeClaims([]claim{{id: "alias", entry: alias}}); got.CNAME != alias.CNAME {
+		t.Errorf("expected the alias without address claimants, got %+v", got)
+	}
+}
+
+func TestOwnersConflicts(t *testing.T) {
+	o := newOwners(NewRecords(), ConflictLastWins)
+	o.update("", "solo", nil, []string{"solo.example.com"}, claimEntry("10.0.0.9", "solo"))
+	if conflicts := o.conflicts(); conflicts == nil || len(conflicts) != 0 {
+		t.Fatalf("expected an empty list, got %#v", conflicts)
+	}
+
+	o.update("unix:///var/run/docker.sock", "blue", nil, []string{"app.example.com"}, claimEntry("10.0.0.1", "blue"))
+	o.update("tcp://nas:2376", "green", nil, []string{"app.example.com"}, claimEntry("10.0.0.2", "green"))
+
+	conflicts := o.conflicts()
+	if len(conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %+v", conflicts)
+	}
+	c := conflicts[0]
+	if c.Hostname != "app.example.com" || c.Policy != "last-wins" || len(c.Claims) != 2 {
+		t.Fatalf("unexpected conflict %+v", c)
+	}
+	if c.Claims[0].Serving || !c.Claims[1].Serving || c.Claims[1].Daemon != "tcp://nas:2376" || c.Claims[1].Container.Name != "green" {
+		t.Errorf("expected green on the nas to be served, got %+v", c.Claims)
+	}
+	if n := o.conflictCount(); n != 1 {
+		t.Errorf("conflictCount() = %d, want 1", n)
+	}
+}
+
+func TestWatchersShareOwnersAcrossDaemons(t *testing.T) {
+	records := NewRecords()
+	dw := NewDockerWatcher("unix:///var/run/docker.sock", "192.168.1.100", []string{"coredns.host.name"}, records)
+	nas := dw.AddDaemon(DockerDaemon{Host: "tcp://nas:2376", HostIP: "192.168.1.70"})
+
+	var removed []string
+	dw.SetCallback(func(hostname string, entry RecordEntry, added bool) {
+		if !added {
+			removed = append(removed, hostname)
+		}
+	})
+
+	dw.updateContainer("local", []string{"app.example.com"}, RecordEntry{IP: "192.168.1.100"})
+	nas.updateContainer("remote", []string{"app.example.com"}, RecordEntry{IP: "192.168.1.70"})
+	if len(dw.Conflicts()) != 1 {
+		t.Fatalf("expected the daemons' claims to conflict, got %+v", dw.Conflicts())
+	}
+
+	if got := nas.removeContainer("remote"); got != nil {
+		t.Errorf("expected no removed hostnames while the local claim remains, got %v", got)
+	}
+	if ip, _ := records.Lookup("app.example.com"); ip != "192.168.1.100" {
+		t.Errorf("expected the local container's record, got %q", ip)
+	}
+	if len(removed) != 0 {
+		t.Errorf("expected no removal to be announced, got %v", removed)
+	}
+}
+
+func TestConflictsHandler(t *testing.T) {
+	dc := &DockerCluster{Watcher: NewDockerWatcher("", "192.168.1.100", nil, NewRecords())}
+	dc.Watcher.updateContainer("blue", []string{"app.example.com"}, claimEntry("10.0.0.1", "blue"))
+	dc.Watcher.updateContainer("green", []string{"app.example.com"}, claimEntry("10.0.0.2", "green"))
+
+	rec := httptest.NewRecorder()
+	dc.conflictsHandler(rec, httptest.NewRequest(http.MethodGet, "/conflicts", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var conflicts []HostnameConflict
+	if err := json.Unmarshal(rec.Body.Bytes(), &conflicts); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Hostname != "app.example.com" {
+		t.Errorf("unexpected conflicts %+v", conflicts)
+	}
+
+	rec = httptest.NewRecorder()
+	dc.conflictsHandler(rec, httptest.NewRequest(http.MethodPost, "/conflicts", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	for input, want := range map[string]ConflictPolicy{
+		"last-wins":   ConflictLastWins,
+		"first-wins":  ConflictFirstWins,
+		"multi-value": ConflictMulti,
+		"Multi":       ConflictMulti,
+	} {
+		got, err := parseConflictPolicy(input)
+		if err != nil || got != want {
+			t.Errorf("parseConflictPolicy(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := parseConflictPolicy("random"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
@@ -2,69 +2,234 @@
 package dockercluster
 
 import (
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+
+	"github.com/coredns/coredns/plugin/internal/netaddr"
 )
 
 // RecordMeta stores metadata for a DNS record, used for LWW conflict resolution.
 type RecordMeta struct {
-	Timestamp int64  // Unix nanosecond timestamp of last update
-	NodeID    string // Node that created/updated this record
+	Timestamp int64  `json:"timestamp"` // Unix nanosecond timestamp of last update
+	NodeID    string `json:"node"`      // Node that created/updated this record
 }
 
 // Records provides thread-safe storage for DNS hostname-to-IP mappings.
 // It uses atomic.Value for lock-free reads on the hot path (DNS queries),
 // with copy-on-write semantics for updates.
 //
-// For cluster synchronization, it also maintains metadata (timestamps, node IDs)
-// to support last-write-wins (LWW) conflict resolution.
+// A hostname holds one entry per owning node, so a service running on
+// several cluster nodes resolves to every node's address. Each entry holds
+// at most one IPv4 and one IPv6 address. Wildcard hostnames ("*.example.com")
+// are stored under their literal name and matched by suffix on lookup.
+//
+// For cluster synchronization, each entry carries metadata (timestamp, node ID)
+// to support last-write-wins (LWW) conflict resolution between updates from
+// the same node.
 type Records struct {
 	// data holds the current immutable snapshot of records.
 	// Read operations access this atomically without locks.
-	data atomic.Value // holds map[string]string
+	data atomic.Value // holds *snapshot
+
+	// localNode is the node ID that owns records written with Add/AddEntry/Remove.
+	localNode string
 
-	// meta holds metadata for each record (timestamp, nodeID).
-	// Used for cluster LWW conflict resolution.
-	meta atomic.Value // holds map[string]RecordMeta
+	// version counts the snapshots swapped in, so writers of the state file
+	// can tell whether anything changed since they last saved.
+	version atomic.Uint64
+
+	// local and remote are the entries the records_total gauge holds for
+	// this store, adjusted on every swap. Guarded by mu.
+	local, remote int
+
+	// onRemove is called with the hostnames removed by a swap (see OnRemove).
+	onRemove func(hostnames []string)
 
 	// mu protects write operations (Add/Remove) to ensure
 	// atomic copy-on-write updates.
 	mu sync.Mutex
 }
 
+// snapshot is an immutable state of the store.
+type snapshot struct {
+	hosts map[string]map[string]RecordEntry // hostname -> nodeID -> entry
+
+	// parents counts, for each name with hostnames below it, the hostnames
+	// below it, so HasSubdomain doesn't have to scan them.
+	parents map[string]int
+}
+
 // NewRecords creates a new empty Records store.
 func NewRecords() *Records {
 	r := &Records{}
-	r.data.Store(make(map[string]string))
-	r.meta.Store(make(map[string]RecordMeta))
+	r.data.Store(&snapshot{hosts: map[string]map[string]RecordEntry{}, parents: map[string]int{}})
 	return r
 }
 
-// Add adds or updates a DNS record mapping hostname to ip.
+// SetLocalNode sets the node ID that owns records written with Add, AddEntry
+// and Remove. Records already written by the local node are moved to the new ID.
+// It must be called before the store serves queries (Lookup reads the node ID without locking).
+func (r *Records) SetLocalNode(nodeID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if nodeID == r.localNode {
+		return
+	}
+
+	current := r.load()
+	newData := make(map[string]map[string]RecordEntry, len(current))
+	var changed []string
+	for hostname, owners := range current {
+		_, hasNew := owners[nodeID]
+		entry, ok := owners[r.localNode]
+		if !ok {
+			newData[hostname] = owners
+			if hasNew {
+				changed = append(changed, hostname) // Becomes local
+			}
+			continue
+		}
+		newOwners := copyOwners(owners)
+		delete(newOwners, r.localNode)
+		entry.NodeID = nodeID
+		newOwners[nodeID] = entry
+		newData[hostname] = newOwners
+		changed = append(changed, hostname)
+	}
+
+	// The entries counted as local change with the node ID
+	for _, hostname := range changed {
+		r.count(current[hostname], -1)
+	}
+	r.localNode = nodeID
+	for _, hostname := range changed {
+		r.count(newData[hostname], 1)
+	}
+	r.data.Store(&snapshot{hosts: newData, parents: r.data.Load().(*snapshot).parents})
+	r.version.Add(1)
+}
+
+// load returns the current snapshot of records.
+func (r *Records) load() map[string]map[string]RecordEntry {
+	return r.data.Load().(*snapshot).hosts
+}
+
+// OnRemove sets fn to be called with the hostnames no node has an entry for
+// any more, after each change removing some. fn runs with the write lock
+// held, so it must not write to the store.
+func (r *Records) OnRemove(fn func(hostnames []string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onRemove = fn
+}
+
+// swap atomically replaces the current snapshot with data, which differs
+// from it in the changed hostnames only. The caller must hold r.mu.
+func (r *Records) swap(data map[string]map[string]RecordEntry, changed ...string) {
+	current := r.data.Load().(*snapshot)
+	parents := current.parents
+	copied := false
+	var removed []string
+	for _, hostname := range changed {
+		r.count(current.hosts[hostname], -1)
+		r.count(data[hostname], 1)
+
+		_, existed := current.hosts[hostname]
+		_, exists := data[hostname]
+		if existed == exists {
+			continue
+		}
+		if !copied {
+			parents = maps.Clone(parents)
+			copied = true
+		}
+		delta := 1
+		if existed {
+			delta = -1
+			removed = append(removed, hostname)
+		}
+		for parent := hostname; ; {
+			i := strings.IndexByte(parent, '.')
+			if i < 0 {
+				break
+			}
+			parent = parent[i+1:]
+			if parents[parent] += delta; parents[parent] == 0 {
+				delete(parents, parent)
+			}
+		}
+	}
+	r.data.Store(&snapshot{hosts: data, parents: parents})
+	r.version.Add(1)
+	if len(removed) > 0 && r.onRemove != nil {
+		r.onRemove(removed)
+	}
+}
+
+// count adds a hostname's entries, times sign, to the records_total gauge.
+// The caller must hold r.mu.
+func (r *Records) count(owners map[string]RecordEntry, sign int) {
+	local := 0
+	if _, ok := owners[r.localNode]; ok {
+		local = 1
+	}
+	remote := len(owners) - local
+	r.local += sign * local
+	r.remote += sign * remote
+	recordsTotal.WithLabelValues("local").Add(float64(sign * local))
+	recordsTotal.WithLabelValues("remote").Add(float64(sign * remote))
+}
+
+// uncount removes the store's entries from the records_total gauge, once it
+// is no longer used.
+func (r *Records) uncount() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recordsTotal.WithLabelValues("local").Sub(float64(r.local))
+	recordsTotal.WithLabelValues("remote").Sub(float64(r.remote))
+	r.local, r.remote = 0, 0
+}
+
+// Version returns a counter that changes whenever the records do.
+func (r *Records) Version() uint64 {
+	return r.version.Load()
+}
+
+// Add adds or updates the local node's DNS record mapping hostname to a single ip.
+// IPv6 addresses are stored as the record's AAAA address; anything else is
+// stored as its A address (and validated when served).
 // The hostname is normalized to lowercase.
 // This operation uses copy-on-write for thread safety.
 func (r *Records) Add(hostname, ip string) {
+	entry := RecordEntry{IP: ip}
+	if isIPv6(ip) {
+		entry = RecordEntry{IPv6: ip}
+	}
+	r.AddEntry(hostname, entry)
+}
+
+// AddEntry adds or updates the local node's DNS record with the addresses in entry.
+// The hostname is normalized to lowercase.
+// This operation uses copy-on-write for thread safety.
+func (r *Records) AddEntry(hostname string, entry RecordEntry) {
 	hostname = strings.ToLower(hostname)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Load current data
-	current := r.data.Load().(map[string]string)
-
-	// Create a new map with all existing entries plus the new one
-	newData := make(map[string]string, len(current)+1)
-	for k, v := range current {
-		newData[k] = v
-	}
-	newData[hostname] = ip
-
-	// Atomically swap in the new map
-	r.data.Store(newData)
+	entry.NodeID = r.localNode
+	r.store(hostname, entry)
 }
 
-// Remove removes a DNS record for the given hostname.
+// Remove removes the local node's DNS record for the given hostname.
+// Entries owned by other nodes are kept.
 // The hostname is normalized to lowercase.
 // This operation uses copy-on-write for thread safety.
 // If the hostname doesn't exist, this is a no-op.
@@ -74,107 +239,211 @@ func (r *Records) Remove(hostname string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Load current data
-	current := r.data.Load().(map[string]string)
+	r.delete(hostname, r.localNode)
+}
+
+// store swaps in a snapshot with entry set for hostname under entry.NodeID.
+// The caller must hold r.mu.
+func (r *Records) store(hostname string, entry RecordEntry) {
+	current := r.load()
 
-	// Check if the key exists; if not, nothing to do
-	if _, exists := current[hostname]; !exists {
-		return
+	// Create a new map with all existing entries plus the new one
+	newData := make(map[string]map[string]RecordEntry, len(current)+1)
+	for k, v := range current {
+		newData[k] = v
+	}
+	owners := copyOwners(current[hostname])
+	owners[entry.NodeID] = entry
+	newData[hostname] = owners
+
+	// Atomically swap in the new map
+	r.swap(newData, hostname)
+}
+
+// delete swaps in a snapshot without nodeID's entry for hostname. The hostname
+// is dropped once its last entry is gone. Returns false if there was no entry.
+// The caller must hold r.mu.
+func (r *Records) delete(hostname, nodeID string) bool {
+	current := r.load()
+
+	// Check if the entry exists; if not, nothing to do
+	if _, exists := current[hostname][nodeID]; !exists {
+		return false
 	}
 
 	// Create a new map without the removed entry
-	newData := make(map[string]string, len(current)-1)
+	newData := make(map[string]map[string]RecordEntry, len(current))
 	for k, v := range current {
 		if k != hostname {
 			newData[k] = v
 		}
 	}
+	if len(current[hostname]) > 1 {
+		owners := copyOwners(current[hostname])
+		delete(owners, nodeID)
+		newData[hostname] = owners
+	}
 
 	// Atomically swap in the new map
-	r.data.Store(newData)
+	r.swap(newData, hostname)
+	return true
 }
 
-// Lookup retrieves the IP address for a hostname.
+// Lookup retrieves the IPv4 address of a hostname's primary entry (see LookupEntry).
+// Wildcard records are matched as described in LookupAll.
 // The hostname is normalized to lowercase.
 // This is a lock-free operation optimized for the DNS query hot path.
 // Returns the IP and true if found, or empty string and false if not found.
+// An IPv6-only hostname is found with an empty IP; use LookupEntry for both families.
 func (r *Records) Lookup(hostname string) (ip string, found bool) {
-	hostname = strings.ToLower(hostname)
-	current := r.data.Load().(map[string]string)
-	ip, found = current[hostname]
+	entry, found := r.LookupEntry(hostname)
+	return entry.IP, found
+}
+
+// LookupEntry retrieves the primary record (IPv4 and IPv6 addresses) for a hostname:
+// the local node's entry if it has one, otherwise the most recently updated entry
+// (ties broken by the higher node ID).
+// The hostname is normalized to lowercase and matched as described in LookupAll.
+// This is a lock-free operation optimized for the DNS query hot path.
+func (r *Records) LookupEntry(hostname string) (entry RecordEntry, found bool) {
+	_, owners := r.match(strings.ToLower(hostname))
+	return r.primary(owners)
+}
+
+// LookupAll retrieves every node's record for a hostname, sorted by node ID.
+// The hostname is normalized to lowercase. An exact record takes precedence;
+// otherwise the most specific wildcard record ("*.suffix") covering the
+// hostname is used.
+// Returns nil if the hostname is not found.
+func (r *Records) LookupAll(hostname string) []RecordEntry {
+	_, entries := r.LookupMatch(hostname)
+	return entries
+}
+
+// LookupMatch is LookupAll that also returns the name of the record matched:
+// the hostname itself or the wildcard covering it.
+func (r *Records) LookupMatch(hostname string) (name string, entries []RecordEntry) {
+	name, owners := r.match(strings.ToLower(hostname))
+	return name, sortedEntries(owners)
+}
+
+// match returns the owners of hostname, falling back to the closest wildcard:
+// for a.b.example.com it tries *.b.example.com, then *.example.com, then *.com.
+// name is the record matched.
+func (r *Records) match(hostname string) (name string, owners map[string]RecordEntry) {
+	current := r.load()
+	if owners, ok := current[hostname]; ok {
+		return hostname, owners
+	}
+	for suffix := hostname; ; {
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			return "", nil
+		}
+		suffix = suffix[i+1:]
+		if owners, ok := current["*."+suffix]; ok {
+			return "*." + suffix, owners
+		}
+	}
+}
+
+// primary picks the entry served by Lookup from a hostname's owners.
+func (r *Records) primary(owners map[string]RecordEntry) (entry RecordEntry, found bool) {
+	if local, ok := owners[r.localNode]; ok {
+		return local, true
+	}
+	for _, e := range owners {
+		if !found || newer(e, entry) {
+			entry, found = e, true
+		}
+	}
 	return
 }
 
-// GetAll returns a copy of all current DNS records.
+// LookupAddr returns the hostnames whose records resolve to ip (IPv4 or IPv6),
+// sorted. Wildcard hostnames are skipped since they can't be a PTR target.
+// Returns nil if ip is not a valid address or nothing resolves to it.
+func (r *Records) LookupAddr(ip string) []string {
+	if _, err := netip.ParseAddr(ip); err != nil {
+		return nil
+	}
+
+	var names []string
+	for hostname, owners := range r.load() {
+		if strings.HasPrefix(hostname, "*.") {
+			continue
+		}
+		for _, entry := range owners {
+			if slices.ContainsFunc(entry.addrs(isIPv6(ip)), func(a string) bool { return netaddr.SameAddr(a, ip) }) {
+				names = append(names, hostname)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetAll returns a copy of all current DNS records as hostname -> IPv4 address
+// of the primary entry (empty for IPv6-only records).
 // The returned map is safe to modify without affecting the stored records.
 func (r *Records) GetAll() map[string]string {
-	current := r.data.Load().(map[string]string)
+	current := r.load()
 
 	// Return a copy to prevent external modification
 	result := make(map[string]string, len(current))
-	for k, v := range current {
-		result[k] = v
+	for k, owners := range current {
+		entry, _ := r.primary(owners)
+		result[k] = entry.IP
 	}
 	return result
 }
 
-// Count returns the number of DNS records currently stored.
+// HasSubdomain reports whether any hostname (including wildcards) is stored
+// below hostname, i.e. hostname is an empty non-terminal of the stored names.
+// The hostname is normalized to lowercase.
+func (r *Records) HasSubdomain(hostname string) bool {
+	return r.data.Load().(*snapshot).parents[strings.ToLower(hostname)] > 0
+}
+
+// Count returns the number of hostnames currently stored.
 func (r *Records) Count() int {
-	current := r.data.Load().(map[string]string)
-	return len(current)
+	return len(r.load())
 }
 
-// AddWithMeta adds or updates a DNS record with metadata for LWW conflict resolution.
-// Returns true if the record was added/updated, false if an existing record has a newer timestamp.
+// AddWithMeta adds or updates a node's DNS record with metadata for LWW conflict resolution.
+// Returns true if the record was added/updated, false if the node's existing record is as new or newer.
 // The hostname is normalized to lowercase.
 func (r *Records) AddWithMeta(hostname, ip string, timestamp int64, nodeID string) bool {
+	return r.AddEntryWithMeta(hostname, RecordEntry{IP: ip, Timestamp: timestamp, NodeID: nodeID})
+}
+
+// AddEntryWithMeta adds or updates the DNS record entry.NodeID owns for hostname,
+// using entry.Timestamp for LWW conflict resolution. Other nodes' entries are kept.
+// Returns true if the record was added/updated, false if the node's existing record is as new or newer.
+// The hostname is normalized to lowercase.
+func (r *Records) AddEntryWithMeta(hostname string, entry RecordEntry) bool {
 	hostname = strings.ToLower(hostname)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Load current metadata
-	currentMeta := r.meta.Load().(map[string]RecordMeta)
-
-	// Check if existing record is newer (LWW)
-	if existing, ok := currentMeta[hostname]; ok {
-		if existing.Timestamp > timestamp {
-			return false // Existing record is newer
-		}
-		if existing.Timestamp == timestamp && existing.NodeID >= nodeID {
-			return false // Same timestamp, tie-break by nodeID (higher wins)
+	// Check if the node's existing record is newer (LWW)
+	if existing, ok := r.load()[hostname][entry.NodeID]; ok && existing.Timestamp >= entry.Timestamp {
+		// The same version of a restored record confirms it is still current
+		if existing.restored && existing.Timestamp == entry.Timestamp {
+			r.store(hostname, entry)
 		}
+		return false
 	}
 
-	// Load current data
-	currentData := r.data.Load().(map[string]string)
-
-	// Create new data map
-	newData := make(map[string]string, len(currentData)+1)
-	for k, v := range currentData {
-		newData[k] = v
-	}
-	newData[hostname] = ip
-
-	// Create new meta map
-	newMeta := make(map[string]RecordMeta, len(currentMeta)+1)
-	for k, v := range currentMeta {
-		newMeta[k] = v
-	}
-	newMeta[hostname] = RecordMeta{
-		Timestamp: timestamp,
-		NodeID:    nodeID,
-	}
-
-	// Atomically swap in new maps
-	r.data.Store(newData)
-	r.meta.Store(newMeta)
-
+	r.store(hostname, entry)
 	return true
 }
 
-// RemoveWithMeta removes a DNS record with metadata for LWW conflict resolution.
-// Returns true if the record was removed, false if an existing record has a newer timestamp.
+// RemoveWithMeta removes the DNS record nodeID owns for hostname, with metadata
+// for LWW conflict resolution. Other nodes' entries are kept.
+// Returns true if the record was removed, false if there is none or it is newer.
 // The hostname is normalized to lowercase.
 func (r *Records) RemoveWithMeta(hostname string, timestamp int64, nodeID string) bool {
 	hostname = strings.ToLower(hostname)
@@ -182,64 +451,56 @@ func (r *Records) RemoveWithMeta(hostname string, timestamp int64, nodeID string
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Load current data
-	currentData := r.data.Load().(map[string]string)
-
-	// Check if the key exists
-	if _, exists := currentData[hostname]; !exists {
+	existing, ok := r.load()[hostname][nodeID]
+	if !ok {
 		return false // Nothing to remove
 	}
 
-	// Load current metadata
-	currentMeta := r.meta.Load().(map[string]RecordMeta)
-
 	// Check if existing record is newer (LWW)
-	if existing, ok := currentMeta[hostname]; ok {
-		if existing.Timestamp > timestamp {
-			return false // Existing record is newer
-		}
-		if existing.Timestamp == timestamp && existing.NodeID >= nodeID {
-			return false // Same timestamp, tie-break by nodeID (higher wins)
-		}
+	if existing.Timestamp > timestamp {
+		return false
 	}
 
-	// Create new data map without the removed entry
-	newData := make(map[string]string, len(currentData)-1)
-	for k, v := range currentData {
-		if k != hostname {
-			newData[k] = v
-		}
-	}
+	return r.delete(hostname, nodeID)
+}
 
-	// Create new meta map without the removed entry
-	newMeta := make(map[string]RecordMeta, len(currentMeta)-1)
-	for k, v := range currentMeta {
-		if k != hostname {
-			newMeta[k] = v
+// RemoveNode removes every record owned by nodeID, e.g. when it leaves the cluster.
+// Returns the number of entries removed.
+func (r *Records) RemoveNode(nodeID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.load()
+	newData := make(map[string]map[string]RecordEntry, len(current))
+	var removed []string
+	for hostname, owners := range current {
+		if _, ok := owners[nodeID]; !ok {
+			newData[hostname] = owners
+			continue
+		}
+		removed = append(removed, hostname)
+		if len(owners) > 1 {
+			newOwners := copyOwners(owners)
+			delete(newOwners, nodeID)
+			newData[hostname] = newOwners
 		}
 	}
 
-	// Atomically swap in new maps
-	r.data.Store(newData)
-	r.meta.Store(newMeta)
-
-	return true
+	if len(removed) > 0 {
+		r.swap(newData, removed...)
+	}
+	return len(removed)
 }
 
-// GetAllWithMeta returns a copy of all current DNS records with metadata.
+// GetAllWithMeta returns a copy of all current DNS records with metadata,
+// as hostname -> entries sorted by node ID.
 // The returned map is safe to modify without affecting the stored records.
-func (r *Records) GetAllWithMeta() map[string]RecordEntry {
-	currentData := r.data.Load().(map[string]string)
-	currentMeta := r.meta.Load().(map[string]RecordMeta)
-
-	result := make(map[string]RecordEntry, len(currentData))
-	for hostname, ip := range currentData {
-		meta := currentMeta[hostname]
-		result[hostname] = RecordEntry{
-			IP:        ip,
-			Timestamp: meta.Timestamp,
-			NodeID:    meta.NodeID,
-		}
+func (r *Records) GetAllWithMeta() map[string][]RecordEntry {
+	current := r.load()
+
+	result := make(map[string][]RecordEntry, len(current))
+	for hostname, owners := range current {
+		result[hostname] = sortedEntries(owners)
 	}
 	return result
 }
@@ -249,7 +510,7 @@ func (r *Records) GetAllWithMeta() map[string]RecordEntry {
 func (r *Records) ApplyMessage(msg *RecordMessage) bool {
 	switch msg.Action {
 	case RecordActionAdd:
-		return r.AddWithMeta(msg.Hostname, msg.IP, msg.Timestamp, msg.NodeID)
+		return r.AddEntryWithMeta(msg.Hostname, msg.Entry())
 	case RecordActionRemove:
 		return r.RemoveWithMeta(msg.Hostname, msg.Timestamp, msg.NodeID)
 	default:
@@ -257,10 +518,178 @@ func (r *Records) ApplyMessage(msg *RecordMessage) bool {
 	}
 }
 
-// GetMeta returns the metadata for a hostname, or zero value if not found.
+// GetMeta returns the metadata of a hostname's primary entry (see LookupEntry),
+// or zero value if not found. Wildcards are not expanded.
 func (r *Records) GetMeta(hostname string) (RecordMeta, bool) {
-	hostname = strings.ToLower(hostname)
-	currentMeta := r.meta.Load().(map[string]RecordMeta)
-	meta, ok := currentMeta[hostname]
-	return meta, ok
+	entry, ok := r.primary(r.load()[strings.ToLower(hostname)])
+	if !ok {
+		return RecordMeta{}, false
+	}
+	return RecordMeta{Timestamp: entry.Timestamp, NodeID: entry.NodeID}, true
+}
+
+// Restore adds records loaded from a state file (see Snapshot), keyed by
+// hostname with one entry per owning node, marked as restored. Entries of
+// nodes keep rejects and entries already present are skipped.
+// Returns the number of entries added.
+func (r *Records) Restore(state map[string][]RecordEntry, keep func(nodeID string) bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.load()
+	newData := make(map[string]map[string]RecordEntry, len(current)+len(state))
+	for k, v := range current {
+		newData[k] = v
+	}
+	added := 0
+	var changed []string
+	for hostname, entries := range state {
+		hostname = strings.ToLower(hostname)
+		n := added
+		for _, entry := range entries {
+			if _, exists := newData[hostname][entry.NodeID]; exists || !keep(entry.NodeID) {
+				continue
+			}
+			owners := copyOwners(newData[hostname])
+			entry.restored = true
+			owners[entry.NodeID] = entry
+			newData[hostname] = owners
+			added++
+		}
+		if added > n {
+			changed = append(changed, hostname)
+		}
+	}
+
+	if added > 0 {
+		r.swap(newData, changed...)
+	}
+	return added
+}
+
+// MarkLocalRestored marks the local node's entries as restored (see
+// Restore), so that DropRestored(true) withdraws those not published again,
+// e.g. by a watcher taking over the records. Returns the number marked.
+func (r *Records) MarkLocalRestored() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.load()
+	newData := make(map[string]map[string]RecordEntry, len(current))
+	var marked []string
+	for hostname, owners := range current {
+		newData[hostname] = owners
+		if entry, ok := owners[r.localNode]; ok && !entry.restored {
+			owners = copyOwners(owners)
+			entry.restored = true
+			owners[r.localNode] = entry
+			newData[hostname] = owners
+			marked = append(marked, hostname)
+		}
+	}
+
+	if len(marked) > 0 {
+		r.swap(newData, marked...)
+	}
+	return len(marked)
+}
+
+// DropRestored removes the restored entries (see Restore) no source has
+// confirmed since: the local node's if local is true, otherwise those of
+// other nodes. Returns the hostnames of the removed entries, sorted.
+func (r *Records) DropRestored(local bool) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.load()
+	newData := make(map[string]map[string]RecordEntry, len(current))
+	var removed []string
+	for hostname, owners := range current {
+		newOwners := owners
+		for nodeID, entry := range owners {
+			if !entry.restored || (nodeID == r.localNode) != local {
+				continue
+			}
+			if len(newOwners) == len(owners) {
+				newOwners = copyOwners(owners)
+			}
+			delete(newOwners, nodeID)
+		}
+		if len(newOwners) < len(owners) {
+			removed = append(removed, hostname)
+		}
+		if len(newOwners) > 0 {
+			newData[hostname] = newOwners
+		}
+	}
+
+	if len(removed) > 0 {
+		r.swap(newData, removed...)
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// copyOwners returns a writable copy of a hostname's node -> entry map.
+func copyOwners(owners map[string]RecordEntry) map[string]RecordEntry {
+	c := make(map[string]RecordEntry, len(owners)+1)
+	for k, v := range owners {
+		c[k] = v
+	}
+	return c
+}
+
+// sortedEntries returns the entries of owners sorted by node ID, or nil if empty.
+func sortedEntries(owners map[string]RecordEntry) []RecordEntry {
+	if len(owners) == 0 {
+		return nil
+	}
+	entries := make([]RecordEntry, 0, len(owners))
+	for _, e := range owners {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].NodeID < entries[j].NodeID })
+	return entries
+}
+
+// newer reports whether a was updated after b, breaking ties by the higher node ID.
+func newer(a, b RecordEntry) bool {
+	if a.Timestamp != b.Timestamp {
+		return a.Timestamp > b.Timestamp
+	}
+	return a.NodeID > b.NodeID
+}
+
+// addrs returns every IPv4 (or, if ipv6 is set, IPv6) address of the entry:
+// its IP or IPv6 address followed by the matching Addrs.
+func (e RecordEntry) addrs(ipv6 bool) []string {
+	primary := e.IP
+	if ipv6 {
+		primary = e.IPv6
+	}
+	var addrs []string
+	if primary != "" {
+		addrs = append(addrs, primary)
+	}
+	for _, a := range e.Addrs {
+		if isIPv6(a) == ipv6 {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// sameRecord reports whether a and b serve the same data, ignoring metadata.
+func sameRecord(a, b RecordEntry) bool {
+	sameContainer := (a.Container == nil) == (b.Container == nil) &&
+		(a.Container == nil || *a.Container == *b.Container)
+	return a.IP == b.IP && a.IPv6 == b.IPv6 && slices.Equal(a.Addrs, b.Addrs) &&
+		a.CNAME == b.CNAME && a.TTL == b.TTL &&
+		slices.Equal(a.SRV, b.SRV) && sameContainer && a.Manual == b.Manual
+}
+
+// isIPv6 returns true if s is a valid IPv6 (not IPv4 or IPv4-mapped) address.
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() == nil
 }
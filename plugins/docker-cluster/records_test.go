@@ -271,8 +271,8 @@ func TestRecordsLWWOlderRejected(t *testing.T) {
 	// Add initial record with higher timestamp
 	r.AddWithMeta("example.com", "192.168.1.1", 2000, "node1")
 
-	// Try to update with older timestamp
-	added := r.AddWithMeta("example.com", "192.168.1.2", 1000, "node2")
+	// Try to update with older timestamp from the same node
+	added := r.AddWithMeta("example.com", "192.168.1.2", 1000, "node1")
 	if added {
 		t.Error("expected older timestamp to be rejected")
 	}
@@ -327,7 +327,7 @@ func TestRecordsRemoveWithMeta(t *testing.T) {
 	r.AddWithMeta("example.com", "192.168.1.1", 1000, "node1")
 
 	// Remove with newer timestamp
-	removed := r.RemoveWithMeta("example.com", 2000, "node2")
+	removed := r.RemoveWithMeta("example.com", 2000, "node1")
 	if !removed {
 		t.Error("expected RemoveWithMeta to return true")
 	}
@@ -360,7 +360,7 @@ func TestRecordsRemoveWithMetaLWW(t *testing.T) {
 	r.AddWithMeta("example.com", "192.168.1.1", 2000, "node1")
 
 	// Try to remove with older timestamp
-	removed := r.RemoveWithMeta("example.com", 1000, "node2")
+	removed := r.RemoveWithMeta("example.com", 1000, "node1")
 	if removed {
 		t.Error("expected older remove to be rejected")
 	}
@@ -373,16 +373,16 @@ func TestRecordsRemoveWithMetaLWW(t *testing.T) {
 		t.Errorf("expected 192.168.1.1, got %s", ip)
 	}
 
-	// Remove with same timestamp but lower nodeID should be rejected
-	removed = r.RemoveWithMeta("example.com", 2000, "node0")
+	// Another node can't remove node1's record
+	removed = r.RemoveWithMeta("example.com", 3000, "node2")
 	if removed {
-		t.Error("expected lower nodeID remove to be rejected with same timestamp")
+		t.Error("expected remove from a node without an entry to be rejected")
 	}
 
-	// Remove with same timestamp but higher nodeID should succeed
-	removed = r.RemoveWithMeta("example.com", 2000, "node2")
+	// Remove with same timestamp from the owner should succeed
+	removed = r.RemoveWithMeta("example.com", 2000, "node1")
 	if !removed {
-		t.Error("expected higher nodeID remove to succeed with same timestamp")
+		t.Error("expected owner remove to succeed with same timestamp")
 	}
 
 	_, found = r.Lookup("example.com")
@@ -391,6 +391,78 @@ func TestRecordsRemoveWithMetaLWW(t *testing.T) {
 	}
 }
 
+func TestRecordsMultipleOwners(t *testing.T) {
+	r := NewRecords()
+
+	r.AddWithMeta("app.example.com", "10.0.0.1", 1000, "node1")
+	r.AddWithMeta("app.example.com", "10.0.0.2", 2000, "node2")
+	r.AddWithMeta("app.example.com", "10.0.0.3", 1500, "node3")
+
+	entries := r.LookupAll("APP.example.com")
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, want := range []string{"node1", "node2", "node3"} {
+		if entries[i].NodeID != want {
+			t.Errorf("entry %d: expected node %s, got %s", i, want, entries[i].NodeID)
+		}
+	}
+	if r.Count() != 1 {
+		t.Errorf("expected 1 hostname, got %d", r.Count())
+	}
+
+	// The primary entry is the most recently updated one
+	if ip, _ := r.Lookup("app.example.com"); ip != "10.0.0.2" {
+		t.Errorf("expected primary 10.0.0.2, got %s", ip)
+	}
+
+	// Removing one node's entry keeps the others
+	if !r.RemoveWithMeta("app.example.com", 3000, "node2") {
+		t.Fatal("expected node2 remove to succeed")
+	}
+	entries = r.LookupAll("app.example.com")
+	if len(entries) != 2 || entries[0].NodeID != "node1" || entries[1].NodeID != "node3" {
+		t.Errorf("expected node1 and node3 to remain, got %+v", entries)
+	}
+
+	// RemoveNode drops everything a departed node owned
+	r.AddWithMeta("other.example.com", "10.0.0.3", 1000, "node3")
+	if n := r.RemoveNode("node3"); n != 2 {
+		t.Errorf("expected RemoveNode to remove 2 entries, got %d", n)
+	}
+	if _, found := r.Lookup("other.example.com"); found {
+		t.Error("expected other.example.com to be gone with its only owner")
+	}
+	if ip, _ := r.Lookup("app.example.com"); ip != "10.0.0.1" {
+		t.Errorf("expected node1's 10.0.0.1 to remain, got %s", ip)
+	}
+}
+
+func TestRecordsLocalNodeOwnership(t *testing.T) {
+	r := NewRecords()
+
+	// Local writes before the node ID is known move with SetLocalNode
+	r.Add("app.example.com", "10.0.0.1")
+	r.SetLocalNode("node1")
+	r.AddWithMeta("app.example.com", "10.0.0.2", 5000, "node2")
+
+	entries := r.LookupAll("app.example.com")
+	if len(entries) != 2 || entries[0].NodeID != "node1" {
+		t.Fatalf("expected local entry owned by node1, got %+v", entries)
+	}
+
+	// The local entry is primary even when a remote one is newer
+	if ip, _ := r.Lookup("app.example.com"); ip != "10.0.0.1" {
+		t.Errorf("expected local 10.0.0.1, got %s", ip)
+	}
+
+	// Local removal only withdraws this node's entry
+	r.Remove("app.example.com")
+	if ip, found := r.Lookup("app.example.com"); !found || ip != "10.0.0.2" {
+		t.Errorf("expected node2's 10.0.0.2 to remain, got %q (found=%v)", ip, found)
+	}
+}
+
 func TestRecordsGetAllWithMeta(t *testing.T) {
 	r := NewRecords()
 
@@ -402,7 +474,7 @@ func TestRecordsGetAllWithMeta(t *testing.T) {
 		t.Errorf("expected 2 records, got %d", len(all))
 	}
 
-	entryA := all["a.com"]
+	entryA := all["a.com"][0]
 	if entryA.IP != "1.1.1.1" {
 		t.Errorf("expected 1.1.1.1 for a.com, got %s", entryA.IP)
 	}
@@ -413,7 +485,7 @@ func TestRecordsGetAllWithMeta(t *testing.T) {
 		t.Errorf("expected nodeID 'node1' for a.com, got %s", entryA.NodeID)
 	}
 
-	entryB := all["b.com"]
+	entryB := all["b.com"][0]
 	if entryB.IP != "2.2.2.2" {
 		t.Errorf("expected 2.2.2.2 for b.com, got %s", entryB.IP)
 	}
@@ -432,7 +504,7 @@ func TestRecordsGetAllWithMetaReturnsCopy(t *testing.T) {
 	all := r.GetAllWithMeta()
 
 	// Modify the returned map
-	all["example.com"] = RecordEntry{IP: "modified", Timestamp: 9999, NodeID: "modified"}
+	all["example.com"][0] = RecordEntry{IP: "modified", Timestamp: 9999, NodeID: "modified"}
 
 	// Original should be unchanged
 	ip, _ := r.Lookup("example.com")
@@ -482,7 +554,7 @@ func TestRecordsApplyMessageRemove(t *testing.T) {
 		Hostname:  "example.com",
 		Action:    RecordActionRemove,
 		Timestamp: 2000,
-		NodeID:    "node2",
+		NodeID:    "node1",
 	}
 
 	applied := r.ApplyMessage(msg)
@@ -513,6 +585,48 @@ func TestRecordsApplyMessageUnknownAction(t *testing.T) {
 	}
 }
 
+func TestRecordsAddDetectsIPv6(t *testing.T) {
+	r := NewRecords()
+
+	r.Add("v6.example.com", "fd00::1")
+	entry, found := r.LookupEntry("v6.example.com")
+	if !found {
+		t.Fatal("expected to find v6.example.com")
+	}
+	if entry.IP != "" || entry.IPv6 != "fd00::1" {
+		t.Errorf("expected IPv6-only entry, got %+v", entry)
+	}
+}
+
+func TestRecordsApplyMessageDualStack(t *testing.T) {
+	r := NewRecords()
+
+	msg := &RecordMessage{
+		Hostname:  "example.com",
+		IP:        "192.168.1.1",
+		IPv6:      "fd00::1",
+		Action:    RecordActionAdd,
+		Timestamp: 1000,
+		NodeID:    "node1",
+	}
+	if !r.ApplyMessage(msg) {
+		t.Fatal("expected ApplyMessage to succeed")
+	}
+
+	entry, found := r.LookupEntry("example.com")
+	if !found {
+		t.Fatal("expected to find example.com")
+	}
+	if entry.IP != "192.168.1.1" || entry.IPv6 != "fd00::1" {
+		t.Errorf("expected both addresses, got %+v", entry)
+	}
+
+	all := r.GetAllWithMeta()
+	if all["example.com"][0].IPv6 != "fd00::1" {
+		t.Errorf("expected GetAllWithMeta to carry IPv6, got %+v", all["example.com"])
+	}
+}
+
 func TestRecordsGetMeta(t *testing.T) {
 	r := NewRecords()
 
@@ -691,12 +805,13 @@ func TestRecordsLargeStateSync(t *testing.T) {
 	// Verify a sample of records
 	for i := 0; i < recordCount; i += 10 {
 		hostname := "host-" + string(rune('a'+i/26)) + string(rune('a'+i%26)) + ".example.com"
-		entry, ok := allWithMeta[hostname]
-		if !ok {
+		entries, ok := allWithMeta[hostname]
+		if !ok || len(entries) != 1 {
 			t.Errorf("expected to find %s in GetAllWithMeta", hostname)
 			continue
 		}
 
+		entry := entries[0]
 		expectedTimestamp := int64(1000 + i)
 		if entry.Timestamp != expectedTimestamp {
 			t.Errorf("expected timestamp %d for %s, got %d", expectedTimestamp, hostname, entry.Timestamp)
@@ -714,3 +829,138 @@ func TestRecordsLargeStateSync(t *testing.T) {
 		t.Error("modifying GetAllWithMeta result affected original records")
 	}
 }
+
+func TestRecordsWildcardLookup(t *testing.T) {
+	r := NewRecords()
+	r.Add("*.example.com", "10.0.0.1")
+	r.Add("*.preview.example.com", "10.0.0.2")
+	r.Add("main.preview.example.com", "10.0.0.3")
+
+	tests := []struct {
+		query string
+		want  string
+		found bool
+	}{
+		{"feature-1.preview.example.com", "10.0.0.2", true}, // most specific wildcard wins
+		{"a.b.preview.example.com", "10.0.0.2", true},       // wildcards cover deeper names
+		{"MAIN.preview.example.com", "10.0.0.3", true},      // exact beats wildcard
+		{"other.example.com", "10.0.0.1", true},             // falls back to the broader wildcard
+		{"example.com", "", false},                          // wildcard doesn't match its own suffix
+		{"example.org", "", false},                          // unrelated name
+		{"*.preview.example.com", "10.0.0.2", true},         // the wildcard itself
+	}
+
+	for _, tc := range tests {
+		ip, found := r.Lookup(tc.query)
+		if found != tc.found || ip != tc.want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q, %v", tc.query, ip, found, tc.want, tc.found)
+		}
+	}
+
+	if len(r.LookupAll("x.preview.example.com")) != 1 {
+		t.Error("expected LookupAll to match the wildcard")
+	}
+	if _, ok := r.GetMeta("x.preview.example.com"); ok {
+		t.Error("expected GetMeta not to expand wildcards")
+	}
+}
+
+func TestRecordsRestore(t *testing.T) {
+	r := NewRecords()
+	r.SetLocalNode("node1")
+	r.AddEntry("live.example.com", RecordEntry{IP: "10.0.0.9"})
+
+	state := map[string][]RecordEntry{
+		"App.example.com":  {{IP: "10.0.0.1", Timestamp: 100, NodeID: "node1"}, {IP: "10.0.0.2", Timestamp: 100, NodeID: "node2"}},
+		"live.example.com": {{IP: "10.0.0.8", Timestamp: 100, NodeID: "node1"}},
+		"gone.example.com": {{IP: "10.0.0.3", Timestamp: 100, NodeID: "node3"}},
+	}
+	version := r.Version()
+	n := r.Restore(state, func(nodeID string) bool { return nodeID != "node3" })
+	if n != 2 {
+		t.Fatalf("expected 2 restored entries, got %d", n)
+	}
+	if r.Version() == version {
+		t.Error("expected the version to change")
+	}
+	if ip, _ := r.Lookup("live.example.com"); ip != "10.0.0.9" {
+		t.Errorf("expected the live record to be kept, got %s", ip)
+	}
+	if _, ok := r.Lookup("gone.example.com"); ok {
+		t.Error("expected entries of skipped nodes not to be restored")
+	}
+	entry, _ := r.LookupEntry("app.example.com")
+	if entry.IP != "10.0.0.1" || !entry.restored {
+		t.Errorf("expected the restored local entry, got %+v", entry)
+	}
+
+	// A peer confirming the same version clears the mark; a local update replaces it
+	r.AddEntryWithMeta("app.example.com", RecordEntry{IP: "10.0.0.2", Timestamp: 100, NodeID: "node2"})
+	r.AddEntry("app.example.com", RecordEntry{IP: "10.0.0.1"})
+	for _, e := range r.LookupAll("app.example.com") {
+		if e.restored {
+			t.Errorf("expected %s's entry to be confirmed", e.NodeID)
+		}
+	}
+}
+
+func TestRecordsDropRestored(t *testing.T) {
+	r := NewRecords()
+	r.SetLocalNode("node1")
+	r.Restore(map[string][]RecordEntry{
+		"app.example.com": {{IP: "10.0.0.1", Timestamp: 100, NodeID: "node1"}, {IP: "10.0.0.2", Timestamp: 100, NodeID: "node2"}},
+		"db.example.com":  {{IP: "10.0.0.1", Timestamp: 100, NodeID: "node1"}},
+		"web.example.com": {{IP: "10.0.0.2", Timestamp: 100, NodeID: "node2"}, {IP: "10.0.0.3", Timestamp: 100, NodeID: "node3"}},
+	}, func(string) bool { return true })
+	r.AddEntry("db.example.com", RecordEntry{IP: "10.0.0.1"})
+
+	removed := r.DropRestored(true)
+	if len(removed) != 1 || removed[0] != "app.example.com" {
+		t.Errorf("expected only app.example.com's unconfirmed local entry removed, got %v", removed)
+	}
+	if entries := r.LookupAll("app.example.com"); len(entries) != 1 || entries[0].NodeID != "node2" {
+		t.Errorf("expected node2's entry to remain, got %+v", entries)
+	}
+	if _, ok := r.Lookup("db.example.com"); !ok {
+		t.Error("expected the confirmed local record to remain")
+	}
+
+	removed = r.DropRestored(false)
+	if len(removed) != 2 || removed[0] != "app.example.com" || removed[1] != "web.example.com" {
+		t.Errorf("expected app and web removed once each, got %v", removed)
+	}
+	if r.Count() != 1 {
+		t.Errorf("expected only db.example.com to remain, got %v", r.GetAll())
+	}
+}
+
+func TestRecordsHasSubdomain(t *testing.T) {
+	r := NewRecords()
+	r.AddEntry("a.preview.example.com", RecordEntry{IP: "10.0.0.1"})
+	r.AddEntryWithMeta("a.preview.example.com", RecordEntry{IP: "10.0.0.2", Timestamp: 1, NodeID: "node2"})
+	r.AddEntry("*.apps.example.com", RecordEntry{IP: "10.0.0.3"})
+
+	for _, name := range []string{"preview.example.com", "PREVIEW.example.com", "example.com", "com", "apps.example.com"} {
+		if !r.HasSubdomain(name) {
+			t.Errorf("expected %s to have subdomains", name)
+		}
+	}
+	for _, name := range []string{"a.preview.example.com", "other.example.com", "example.org"} {
+		if r.HasSubdomain(name) {
+			t.Errorf("expected %s to have no subdomains", name)
+		}
+	}
+
+	// Subdomains are gone once every owner's entry is
+	r.Remove("a.preview.example.com")
+	if !r.HasSubdomain("preview.example.com") {
+		t.Error("expected node2's entry to keep preview.example.com")
+	}
+	r.RemoveNode("node2")
+	if r.HasSubdomain("preview.example.com") {
+		t.Error("expected preview.example.com to have no subdomains left")
+	}
+	if !r.HasSubdomain("example.com") {
+		t.Error("expected the wildcard to keep example.com")
+	}
+}
@@ -1,18 +1,20 @@
 package dockercluster
 
 import (
-	"context"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
-	"time"
+	"text/template"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/internal/netaddr"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/moby/moby/client"
 )
 
 func init() {
@@ -30,72 +32,48 @@ func setup(c *caddy.Controller) error {
 	if dc.UnknownAction == ActionNXDomain {
 		actionName = "nxdomain"
 	}
-	log.Infof("docker-cluster: host_ip=%s labels=%v ttl=%d unknown_action=%s",
-		dc.Watcher.hostIP, dc.Watcher.labels, dc.TTL, actionName)
+	ipModeName := "host"
+	if dc.Watcher.ipMode == IPModeContainer {
+		ipModeName = "container"
+	}
+	aaaaName := "answer"
+	if dc.AAAAMode == AAAAEmpty {
+		aaaaName = "empty"
+	}
+	healthName := "withdraw"
+	switch dc.Watcher.healthMode {
+	case HealthRequire:
+		healthName = "require"
+	case HealthIgnore:
+		healthName = "ignore"
+	}
+	log.Infof("docker-cluster: zones=%v host_ip=%s host_ipv6=%s labels=%v ttl=%d (label %d-%d) unknown_action=%s ip_mode=%s health_mode=%s conflict_policy=%s aaaa=%s reverse=%v",
+		dc.Zones, dc.Watcher.hostIP, dc.Watcher.hostIPv6, dc.Watcher.labels, dc.TTL, dc.Watcher.minTTL, dc.Watcher.maxTTL, actionName, ipModeName, healthName, dc.Watcher.owners.policy, aaaaName, dc.ReverseZones)
 	log.Infof("docker-cluster: docker_socket=%s", dc.Watcher.dockerSocket)
-
-	// Create ClusterManager if clustering is enabled
-	if dc.ClusterConfig != nil && dc.ClusterConfig.Enabled {
-		cm, err := NewClusterManager(dc.ClusterConfig, dc.Records)
-		if err != nil {
-			return plugin.Error("docker-cluster", err)
-		}
-		dc.ClusterManager = cm
-
-		// Wire callback from DockerWatcher to ClusterManager
-		dc.Watcher.SetCallback(func(hostname, ip string, added bool, timestamp int64) {
-			if added {
-				cm.NotifyRecordAdd(hostname, ip, timestamp)
-			} else {
-				cm.NotifyRecordRemove(hostname, timestamp)
-			}
-		})
-
-		// Start cluster manager
-		if err := cm.Start(context.Background()); err != nil {
-			return plugin.Error("docker-cluster", err)
-		}
-
-		// Join cluster (non-blocking, logs warnings on failure)
-		go func() {
-			if err := cm.Join(); err != nil {
-				log.Warningf("docker-cluster: failed to join cluster: %v", err)
-			}
-		}()
-
-		log.Infof("docker-cluster: clustering enabled, node=%s", dc.ClusterConfig.NodeName)
+	for _, daemon := range dc.Watcher.daemons {
+		log.Infof("docker-cluster: docker_socket=%s host_ip=%s host_ipv6=%s", daemon.dockerSocket, daemon.hostIP, daemon.hostIPv6)
 	}
-
-	// Start the Docker watcher
-	if err := dc.Watcher.Start(context.Background()); err != nil {
-		return plugin.Error("docker-cluster", err)
+	switch dc.Watcher.swarmMode {
+	case SwarmVIP:
+		log.Info("docker-cluster: publishing swarm services with their virtual IPs")
+	case SwarmNodes:
+		log.Info("docker-cluster: publishing swarm services with the addresses of their nodes")
 	}
-
-	// Configure version HTTP endpoint port
-	versionAddr := os.Getenv("COREDNS_VERSION_PORT")
-	if versionAddr == "" {
-		versionAddr = ":8081"
+	if t := dc.Watcher.traefik; t != nil {
+		log.Infof("docker-cluster: reading hostnames from Traefik router labels (exposed_by_default=%t)", t.ExposedByDefault)
+	}
+	if dc.Watcher.autoRegister != nil {
+		log.Infof("docker-cluster: auto_register %s for containers without hostname labels", dc.Watcher.autoRegister.Root)
+	}
+	if dc.Debug != nil {
+		log.Infof("docker-cluster: TXT diagnostics under %s.<hostname> for %v", dc.Debug.Label, dc.Debug.Allow)
 	}
 
-	// Start version HTTP endpoint and capture server reference
-	versionServer := dc.ServeVersionHTTP(versionAddr)
-
-	// Register shutdown handler
-	c.OnShutdown(func() error {
-		dc.Watcher.Stop()
-		if dc.ClusterManager != nil {
-			dc.ClusterManager.Stop()
-		}
-
-		// Shutdown version HTTP server
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := versionServer.Shutdown(ctx); err != nil {
-			log.Errorf("docker-cluster: version server shutdown error: %v", err)
-		}
-
-		return nil
-	})
+	// Start the watcher, cluster and HTTP endpoints on startup, shared with
+	// other server blocks: on a reload the new instance is set up and started
+	// while the old one still runs (see lifecycle.go)
+	c.OnStartup(dc.start)
+	c.OnShutdown(dc.stop)
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		dc.Next = next
@@ -107,32 +85,63 @@ func setup(c *caddy.Controller) error {
 
 func parseConfig(c *caddy.Controller) (*DockerCluster, error) {
 	var (
-		dockerSocket  = "unix:///var/run/docker.sock"
+		daemons       []DockerDaemon
+		zones         []string
 		hostIP        string
+		hostIPv6      string
 		labels        []string
 		ttl           uint32 = 60
+		minTTL        uint32 = 5
+		maxTTL        uint32 = 3600
 		f             fall.F
 		unknownAction = ActionDrop // default: no response for split DNS
+		aaaaMode      = AAAAAnswer
+		reverseZones  []string
+		canonical     string
+		debug         *DebugConfig
+		ipMode        = IPModeHost // default: answer with the Traefik host
+		healthMode    = HealthWithdraw
+		swarmMode     = SwarmOff
+		conflicts     = ConflictLastWins
+		autoRegister  string
+		templateKeys  []string
+		traefikLabels bool
+		traefikExpose = true
+		networkName   string
+		snapshotArgs  []string
+		manualPath    string
+		adminToken    string
+		httpAddr      = ":8081"
 		clusterConfig = NewClusterConfig()
 	)
 
 	for c.Next() {
-		// docker-cluster can have arguments (zones), but typically none
-		_ = c.RemainingArgs()
+		// Zones default to the server block's (e.g. "." for .:54)
+		zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
 
 		for c.NextBlock() {
 			switch c.Val() {
 			case "docker_socket":
-				if !c.NextArg() {
+				args := c.RemainingArgs()
+				if len(args) == 0 {
 					return nil, c.ArgErr()
 				}
-				dockerSocket = c.Val()
+				daemon, err := parseDaemon(args)
+				if err != nil {
+					return nil, c.Errf("invalid docker_socket: %v", err)
+				}
+				daemons = append(daemons, daemon)
 
 			case "host_ip":
-				if !c.NextArg() {
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
 					return nil, c.ArgErr()
 				}
-				hostIP = c.Val()
+				v4, v6, err := netaddr.ParseHostIPs(args)
+				if err != nil {
+					return nil, c.Errf("invalid host_ip: %v", err)
+				}
+				hostIP, hostIPv6 = v4, v6
 
 			case "label":
 				args := c.RemainingArgs()
@@ -151,6 +160,21 @@ func parseConfig(c *caddy.Controller) (*DockerCluster, error) {
 				}
 				ttl = uint32(parsed)
 
+			case "min_ttl", "max_ttl":
+				directive := c.Val()
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				parsed, err := strconv.ParseUint(c.Val(), 10, 32)
+				if err != nil || parsed == 0 {
+					return nil, c.Errf("invalid %s: %s", directive, c.Val())
+				}
+				if directive == "min_ttl" {
+					minTTL = uint32(parsed)
+				} else {
+					maxTTL = uint32(parsed)
+				}
+
 			case "fallthrough":
 				f.SetZonesFromArgs(c.RemainingArgs())
 
@@ -164,6 +188,138 @@ func parseConfig(c *caddy.Controller) (*DockerCluster, error) {
 				}
 				unknownAction = action
 
+			case "aaaa":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				mode, err := parseAAAAMode(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid aaaa: %s (valid: answer, empty)", c.Val())
+				}
+				aaaaMode = mode
+
+			case "reverse":
+				zones, err := netaddr.ParseReverseZones(c.RemainingArgs())
+				if err != nil {
+					return nil, c.Errf("invalid reverse: %v", err)
+				}
+				reverseZones = zones
+
+			case "reverse_canonical":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if !isValidHostname(c.Val()) {
+					return nil, c.Errf("invalid reverse_canonical: %s", c.Val())
+				}
+				canonical = strings.ToLower(c.Val())
+
+			case "debug_txt":
+				cfg, err := parseDebugConfig(c.RemainingArgs())
+				if err != nil {
+					return nil, c.Errf("invalid debug_txt: %v", err)
+				}
+				debug = cfg
+
+			case "ip_mode":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				mode, err := parseIPMode(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid ip_mode: %s (valid: host, container)", c.Val())
+				}
+				ipMode = mode
+
+			case "health_mode":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				mode, err := parseHealthMode(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid health_mode: %s (valid: withdraw, require, ignore)", c.Val())
+				}
+				healthMode = mode
+
+			case "conflict_policy":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				policy, err := parseConflictPolicy(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid conflict_policy: %s (valid: first-wins, last-wins, multi-value)", c.Val())
+				}
+				conflicts = policy
+
+			case "swarm":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				mode, err := parseSwarmMode(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid swarm: %s (valid: off, vip, nodes)", c.Val())
+				}
+				swarmMode = mode
+
+			case "auto_register":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				autoRegister = strings.Join(args, " ")
+
+			case "traefik_labels":
+				traefikLabels = true
+				args := c.RemainingArgs()
+				switch {
+				case len(args) == 0:
+				case len(args) == 2 && args[0] == "exposed_by_default":
+					val, err := strconv.ParseBool(args[1])
+					if err != nil {
+						return nil, c.Errf("invalid exposed_by_default: %s (valid: true, false)", args[1])
+					}
+					traefikExpose = val
+				default:
+					return nil, c.ArgErr()
+				}
+
+			case "template_env":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				templateKeys = append(templateKeys, args...)
+
+			case "snapshot":
+				snapshotArgs = c.RemainingArgs()
+				if len(snapshotArgs) == 0 {
+					return nil, c.ArgErr()
+				}
+
+			case "manual_records":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				manualPath = c.Val()
+
+			case "admin_token":
+				return nil, c.Err("admin_token in Corefile is not supported; set the ADMIN_TOKEN environment variable instead so the token is not committed to source control")
+
+			case "http_addr":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if _, _, err := net.SplitHostPort(c.Val()); err != nil {
+					return nil, c.Errf("invalid http_addr: %s", c.Val())
+				}
+				httpAddr = c.Val()
+
+			case "container_network":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				networkName = c.Val()
+
 			case "cluster_enabled":
 				if !c.NextArg() {
 					return nil, c.ArgErr()
@@ -238,11 +394,32 @@ func parseConfig(c *caddy.Controller) (*DockerCluster, error) {
 	}
 
 	// Check for environment variable overrides
+	// HOSTIP may list one address per family (e.g. "192.168.1.10,fd00::10");
+	// each address overrides only its own family
 	if envHostIP := os.Getenv("HOSTIP"); envHostIP != "" {
-		hostIP = envHostIP
+		v4, v6, err := netaddr.ParseHostIPs(strings.Split(envHostIP, ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid HOSTIP env var: %v", err)
+		}
+		if v4 != "" {
+			hostIP = v4
+		}
+		if v6 != "" {
+			hostIPv6 = v6
+		}
+	}
+	// DOCKER_SOCKET, else the docker CLI's DOCKER_HOST, replaces the first
+	// docker_socket; DOCKER_CERT_PATH configures its TLS unless tls is set
+	if len(daemons) == 0 {
+		daemons = []DockerDaemon{{Host: defaultDockerSocket}}
 	}
 	if envDockerSocket := os.Getenv("DOCKER_SOCKET"); envDockerSocket != "" {
-		dockerSocket = envDockerSocket
+		daemons[0].Host = envDockerSocket
+	} else if envDockerHost := os.Getenv(client.EnvOverrideHost); envDockerHost != "" {
+		daemons[0].Host = envDockerHost
+	}
+	if os.Getenv(client.EnvOverrideCertPath) != "" && daemons[0].TLS.Cert == "" {
+		daemons[0].TLS.FromEnv = true
 	}
 	if envUnknownAction := os.Getenv("DNS_UNKNOWN_ACTION"); envUnknownAction != "" {
 		action, err := parseUnknownAction(envUnknownAction)
@@ -287,17 +464,42 @@ func parseConfig(c *caddy.Controller) (*DockerCluster, error) {
 		}
 		clusterConfig.DiscoveryPort = port
 	}
+	adminToken = os.Getenv("ADMIN_TOKEN")
 
 	// Validate required fields
-	if hostIP == "" {
+	if hostIP == "" && hostIPv6 == "" {
 		return nil, c.Err("host_ip is required (set in config or HOSTIP env var)")
 	}
 
+	if manualPath != "" && adminToken == "" {
+		return nil, c.Err("manual_records requires the ADMIN_TOKEN env var")
+	}
+
+	if minTTL > maxTTL {
+		return nil, c.Errf("min_ttl %d is greater than max_ttl %d", minTTL, maxTTL)
+	}
+
 	// Validate cluster config
 	if err := clusterConfig.Validate(); err != nil {
 		return nil, c.Errf("cluster configuration error: %v", err)
 	}
 
+	// Hostname templates: {{.Node}} is the cluster node name, or the OS
+	// hostname without clustering
+	nodeName := clusterConfig.NodeName
+	if nodeName == "" {
+		nodeName, _ = os.Hostname()
+	}
+	env := templateEnv(templateKeys)
+	var autoRegisterTmpl *template.Template
+	if autoRegister != "" {
+		tmpl, err := parseAutoRegister(autoRegister, env)
+		if err != nil {
+			return nil, c.Errf("invalid auto_register template: %v", err)
+		}
+		autoRegisterTmpl = tmpl
+	}
+
 	// Set default labels if none specified
 	if len(labels) == 0 {
 		labels = []string{"coredns.host.name", "joyride.host.name"}
@@ -305,9 +507,67 @@ func parseConfig(c *caddy.Controller) (*DockerCluster, error) {
 
 	// Create shared records store
 	records := NewRecords()
+	var snapshot *Snapshot
+	if snapshotArgs != nil {
+		s, err := parseSnapshot(snapshotArgs, records)
+		if err != nil {
+			return nil, c.Errf("invalid snapshot: %v", err)
+		}
+		snapshot = s
+	}
 
 	// Create Docker watcher
-	watcher := NewDockerWatcher(dockerSocket, hostIP, labels, records)
+	watcher := NewDockerWatcher(daemons[0].Host, hostIP, labels, records)
+	watcher.hostIPv6 = hostIPv6
+	if daemons[0].HostIP != "" || daemons[0].HostIPv6 != "" {
+		watcher.hostIP, watcher.hostIPv6 = daemons[0].HostIP, daemons[0].HostIPv6
+	}
+	watcher.tls = daemons[0].TLS
+	watcher.ipMode = ipMode
+	watcher.network = networkName
+	watcher.healthMode = healthMode
+	watcher.swarmMode = swarmMode
+	watcher.owners.policy = conflicts
+	watcher.autoRegister = autoRegisterTmpl
+	if traefikLabels {
+		watcher.traefik = NewTraefikLabels(traefikExpose, env)
+	}
+	watcher.nodeName = nodeName
+	watcher.templateEnv = env
+	watcher.minTTL = minTTL
+	watcher.maxTTL = maxTTL
+	for _, daemon := range daemons[1:] {
+		if daemon.HostIP == "" && daemon.HostIPv6 == "" {
+			daemon.HostIP, daemon.HostIPv6 = hostIP, hostIPv6
+		}
+		watcher.AddDaemon(daemon)
+	}
+	var manual *ManualRecords
+	if manualPath != "" {
+		manual = NewManualRecords(manualPath, watcher)
+	}
+
+	// Server blocks with the same settings, and the instances before and
+	// after a reload, share the watcher and cluster (see lifecycle.go)
+	watcherKey := fmt.Sprintf("%#v", []any{daemons, hostIP, hostIPv6, labels, minTTL, maxTTL,
+		ipMode, networkName, healthMode, swarmMode, conflicts, autoRegister, env,
+		traefikLabels, traefikExpose, nodeName, manualPath})
+	backendKey := "standalone " + watcherKey
+	if clusterConfig.Enabled {
+		backendKey = fmt.Sprintf("cluster %s:%d", clusterConfig.BindAddr, clusterConfig.Port)
+
+		// A node runs one watcher per cluster, so the blocks of a Corefile
+		// clustering on the same address can't watch Docker differently
+		watcherKeys, _ := c.Get(watcherKeysKey{}).(map[string]string)
+		if watcherKeys == nil {
+			watcherKeys = make(map[string]string)
+			c.Set(watcherKeysKey{}, watcherKeys)
+		}
+		if key, ok := watcherKeys[backendKey]; ok && key != watcherKey {
+			return nil, c.Errf("server blocks clustering on %s:%d must use the same Docker settings (sockets, host IPs, labels, modes, node name and manual_records)", clusterConfig.BindAddr, clusterConfig.Port)
+		}
+		watcherKeys[backendKey] = watcherKey
+	}
 
 	dc := &DockerCluster{
 		Records:       records,
@@ -315,12 +575,30 @@ func parseConfig(c *caddy.Controller) (*DockerCluster, error) {
 		TTL:           ttl,
 		Fall:          f,
 		UnknownAction: unknownAction,
+		AAAAMode:      aaaaMode,
 		ClusterConfig: clusterConfig,
+		Zones:         zones,
+
+		ReverseZones:     reverseZones,
+		ReverseCanonical: canonical,
+		Debug:            debug,
+		Snapshot:         snapshot,
+		HTTPAddr:         httpAddr,
+		Manual:           manual,
+		AdminToken:       adminToken,
+
+		backendKey:      backendKey,
+		backendSettings: fmt.Sprintf("%#v", []any{*clusterConfig, snapshotArgs}),
+		watcherKey:      watcherKey,
 	}
 
 	return dc, nil
 }
 
+// watcherKeysKey is the instance storage key of the watcher settings of each
+// cluster address, as the server blocks of a Corefile configure them.
+type watcherKeysKey struct{}
+
 // parseUnknownAction converts a string to UnknownAction.
 func parseUnknownAction(s string) (UnknownAction, error) {
 	switch strings.ToLower(s) {
@@ -332,3 +610,15 @@ func parseUnknownAction(s string) (UnknownAction, error) {
 		return ActionDrop, fmt.Errorf("unknown action: %s", s)
 	}
 }
+
+// parseAAAAMode converts a string to AAAAMode.
+func parseAAAAMode(s string) (AAAAMode, error) {
+	switch strings.ToLower(s) {
+	case "answer":
+		return AAAAAnswer, nil
+	case "empty":
+		return AAAAEmpty, nil
+	default:
+		return AAAAAnswer, fmt.Errorf("unknown aaaa mode: %s", s)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/caddy/caddyfile"
 )
 
 func TestSetupMinimalConfig(t *testing.T) {
@@ -264,6 +265,98 @@ func TestSetupDefaultUnknownAction(t *testing.T) {
 	}
 }
 
+func TestSetupWithDualStackHostIP(t *testing.T) {
+	input := `docker-cluster {
+		host_ip 192.168.1.1 fd00::1
+		aaaa empty
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	dc, err := parseConfig(c)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dc.Watcher.hostIP != "192.168.1.1" {
+		t.Errorf("expected host_ip 192.168.1.1, got %s", dc.Watcher.hostIP)
+	}
+	if dc.Watcher.hostIPv6 != "fd00::1" {
+		t.Errorf("expected IPv6 host_ip fd00::1, got %s", dc.Watcher.hostIPv6)
+	}
+	if dc.AAAAMode != AAAAEmpty {
+		t.Errorf("expected AAAAEmpty, got %d", dc.AAAAMode)
+	}
+}
+
+func TestSetupWithInvalidHostIP(t *testing.T) {
+	tests := []string{
+		"host_ip not-an-ip",
+		"host_ip 192.168.1.1 192.168.1.2",
+		"host_ip fd00::1 fd00::2",
+		"host_ip 192.168.1.1 fd00::1 10.0.0.1",
+	}
+
+	for _, line := range tests {
+		t.Run(line, func(t *testing.T) {
+			c := caddy.NewTestController("dns", "docker-cluster {\n"+line+"\n}")
+			if _, err := parseConfig(c); err == nil {
+				t.Errorf("expected error for %q", line)
+			}
+		})
+	}
+}
+
+func TestSetupDefaultIPMode(t *testing.T) {
+	input := `docker-cluster {
+		host_ip 192.168.1.1
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	dc, err := parseConfig(c)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dc.Watcher.ipMode != IPModeHost {
+		t.Errorf("expected default IPModeHost, got %d", dc.Watcher.ipMode)
+	}
+}
+
+func TestSetupWithContainerIPMode(t *testing.T) {
+	input := `docker-cluster {
+		host_ip 192.168.1.1
+		ip_mode container
+		container_network macvlan
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	dc, err := parseConfig(c)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dc.Watcher.ipMode != IPModeContainer {
+		t.Errorf("expected IPModeContainer, got %d", dc.Watcher.ipMode)
+	}
+	if dc.Watcher.network != "macvlan" {
+		t.Errorf("expected container_network macvlan, got %s", dc.Watcher.network)
+	}
+}
+
+func TestSetupWithInvalidIPMode(t *testing.T) {
+	input := `docker-cluster {
+		host_ip 192.168.1.1
+		ip_mode bridge
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	_, err := parseConfig(c)
+
+	if err == nil {
+		t.Error("expected error for invalid ip_mode")
+	}
+}
+
 func TestSetupClusterDisabledByDefault(t *testing.T) {
 	input := `docker-cluster {
 		host_ip 192.168.1.1
@@ -310,6 +403,36 @@ func TestSetupWithClusterEnabled(t *testing.T) {
 	}
 }
 
+func TestSetupRejectsBlocksWatchingDifferentlyInOneCluster(t *testing.T) {
+	block := func(label, port string) string {
+		return "docker-cluster {\n host_ip 192.168.1.1\n cluster_enabled true\n node_name node1\n cluster_port " + port + "\n label " + label + "\n}"
+	}
+
+	// The blocks of one Corefile share the controller's instance
+	c := caddy.NewTestController("dns", block("coredns.host.name", "7946"))
+	if _, err := parseConfig(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		input   string
+		wantErr bool
+	}{
+		{block("coredns.host.name", "7946"), false},
+		{block("other.host.name", "7946"), true},
+		{block("other.host.name", "7947"), false}, // Another cluster
+	} {
+		c.Dispenser = caddyfile.NewDispenser("Testfile", strings.NewReader(tt.input))
+		if _, err := parseConfig(c); (err != nil) != tt.wantErr {
+			t.Errorf("%q: expected error %t, got %v", tt.input, tt.wantErr, err)
+		}
+	}
+
+	// A reload is a new instance, whose watcher replaces the old one
+	if _, err := parseConfig(caddy.NewTestController("dns", block("other.host.name", "7946"))); err != nil {
+		t.Errorf("expected a new instance to accept other watcher settings, got %v", err)
+	}
+}
+
 func TestSetupWithClusterSeeds(t *testing.T) {
 	input := `docker-cluster {
 		host_ip 192.168.1.1
@@ -506,6 +629,28 @@ func TestSetupHOSTIPEnvOverride(t *testing.T) {
 	}
 }
 
+func TestSetupHOSTIPEnvDualStack(t *testing.T) {
+	os.Setenv("HOSTIP", "10.20.30.40,fd00::40")
+	defer os.Unsetenv("HOSTIP")
+
+	input := `docker-cluster {
+		host_ip 0.0.0.0
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	dc, err := parseConfig(c)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dc.Watcher.hostIP != "10.20.30.40" {
+		t.Errorf("expected HOSTIP IPv4 override '10.20.30.40', got %s", dc.Watcher.hostIP)
+	}
+	if dc.Watcher.hostIPv6 != "fd00::40" {
+		t.Errorf("expected HOSTIP IPv6 'fd00::40', got %s", dc.Watcher.hostIPv6)
+	}
+}
+
 func TestSetupHOSTIPEnvProvidesMissingHostIP(t *testing.T) {
 	// Set HOSTIP env var to provide missing host_ip
 	os.Setenv("HOSTIP", "192.168.100.1")
@@ -629,3 +774,421 @@ func TestSetupCLUSTER_SEEDSEnvOverride(t *testing.T) {
 		t.Errorf("expected first seed '10.0.0.1:7946', got %s", dc.ClusterConfig.Seeds[0])
 	}
 }
+
+func TestSetupWithReverse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name: "disabled by default",
+			input: `docker-cluster {
+				host_ip 192.168.1.1
+			}`,
+			want: nil,
+		},
+		{
+			name: "all reverse zones",
+			input: `docker-cluster {
+				host_ip 192.168.1.1
+				reverse
+			}`,
+			want: []string{"in-addr.arpa.", "ip6.arpa."},
+		},
+		{
+			name: "zone and CIDR",
+			input: `docker-cluster {
+				host_ip 192.168.1.1
+				reverse 168.192.in-addr.arpa 10.0.0.0/8
+			}`,
+			want: []string{"168.192.in-addr.arpa.", "10.in-addr.arpa."},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tc.input)
+			dc, err := parseConfig(c)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalSlice(dc.ReverseZones, tc.want) {
+				t.Errorf("expected reverse zones %v, got %v", tc.want, dc.ReverseZones)
+			}
+		})
+	}
+}
+
+func TestSetupWithInvalidReverse(t *testing.T) {
+	for _, input := range []string{
+		`docker-cluster {
+			host_ip 192.168.1.1
+			reverse example.com
+		}`,
+		`docker-cluster {
+			host_ip 192.168.1.1
+			reverse_canonical "bad name"
+		}`,
+	} {
+		c := caddy.NewTestController("dns", input)
+		if _, err := parseConfig(c); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestSetupWithZones(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster example.com Internal.Example.org {
+		host_ip 192.168.1.100
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []string{"example.com.", "internal.example.org."}
+	if len(dc.Zones) != len(want) || dc.Zones[0] != want[0] || dc.Zones[1] != want[1] {
+		t.Errorf("expected zones %v, got %v", want, dc.Zones)
+	}
+}
+
+func TestSetupWithTTLBounds(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		min_ttl 10
+		max_ttl 600
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Watcher.minTTL != 10 || dc.Watcher.maxTTL != 600 {
+		t.Errorf("expected bounds 10-600, got %d-%d", dc.Watcher.minTTL, dc.Watcher.maxTTL)
+	}
+
+	for _, input := range []string{
+		`docker-cluster {
+			host_ip 192.168.1.100
+			min_ttl 0
+		}`,
+		`docker-cluster {
+			host_ip 192.168.1.100
+			max_ttl soon
+		}`,
+		`docker-cluster {
+			host_ip 192.168.1.100
+			min_ttl 600
+			max_ttl 60
+		}`,
+	} {
+		if _, err := parseConfig(caddy.NewTestController("dns", input)); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestSetupWithHealthMode(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		health_mode require
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Watcher.healthMode != HealthRequire {
+		t.Errorf("expected HealthRequire, got %d", dc.Watcher.healthMode)
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		health_mode sometimes
+	}`)
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for invalid health_mode")
+	}
+}
+
+func TestSetupWithSwarm(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		swarm nodes
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Watcher.swarmMode != SwarmNodes {
+		t.Errorf("expected SwarmNodes, got %d", dc.Watcher.swarmMode)
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		swarm ingress
+	}`)
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for invalid swarm mode")
+	}
+}
+
+func TestSetupWithConflictPolicy(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		docker_socket unix:///var/run/docker.sock
+		docker_socket tcp://192.168.1.70:2375
+		conflict_policy multi-value
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Watcher.owners.policy != ConflictMulti {
+		t.Errorf("expected ConflictMulti, got %s", dc.Watcher.owners.policy)
+	}
+	if len(dc.Watcher.daemons) != 1 || dc.Watcher.daemons[0].owners != dc.Watcher.owners {
+		t.Error("expected the daemons to share the ownership index")
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		conflict_policy random
+	}`)
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for invalid conflict_policy")
+	}
+}
+
+func TestSetupWithSnapshot(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		snapshot /data/records.json stale_ttl 10
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Snapshot == nil || dc.Snapshot.Path != "/data/records.json" || dc.Snapshot.StaleTTL != 10 {
+		t.Fatalf("unexpected snapshot %+v", dc.Snapshot)
+	}
+	if dc.Snapshot.records != dc.Records {
+		t.Error("expected the snapshot to persist the plugin's records")
+	}
+
+	for _, input := range []string{"snapshot", "snapshot /data/records.json grace never"} {
+		c = caddy.NewTestController("dns", "docker-cluster {\n\thost_ip 192.168.1.100\n\t"+input+"\n}")
+		if _, err := parseConfig(c); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestSetupWithHTTPAddr(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.HTTPAddr != ":8081" {
+		t.Errorf("expected default :8081, got %s", dc.HTTPAddr)
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		http_addr 127.0.0.1:9081
+	}`)
+	dc, err = parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.HTTPAddr != "127.0.0.1:9081" {
+		t.Errorf("expected 127.0.0.1:9081, got %s", dc.HTTPAddr)
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		http_addr 9081
+	}`)
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for http_addr without a port separator")
+	}
+}
+
+func TestSetupWithManualRecords(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		manual_records /data/manual.json
+	}`)
+	if _, err := parseConfig(c); err == nil || !strings.Contains(err.Error(), "ADMIN_TOKEN") {
+		t.Errorf("expected manual_records without ADMIN_TOKEN to fail, got %v", err)
+	}
+
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		manual_records /data/manual.json
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Manual == nil || dc.Manual.Path != "/data/manual.json" || dc.AdminToken != "s3cret" {
+		t.Errorf("unexpected manual records %+v, token %q", dc.Manual, dc.AdminToken)
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		admin_token s3cret
+	}`)
+	if _, err := parseConfig(c); err == nil || !strings.Contains(err.Error(), "ADMIN_TOKEN") {
+		t.Errorf("expected admin_token in Corefile to point at ADMIN_TOKEN, got %v", err)
+	}
+}
+
+func TestSetupWithAutoRegister(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		auto_register {{.Name}}.docker.example.com
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Watcher.autoRegister == nil {
+		t.Fatal("expected auto_register template")
+	}
+	if got := dc.Watcher.autoHostname(hostnameData{Name: "grafana"}); got != "grafana.docker.example.com" {
+		t.Errorf("expected grafana.docker.example.com, got %q", got)
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		auto_register {{.Hostname}}.example.com
+	}`)
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for unknown template field")
+	}
+}
+
+func TestSetupWithTemplateEnv(t *testing.T) {
+	t.Setenv("JOYRIDE_TEST_DOMAIN", "lab.example.com")
+
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		template_env JOYRIDE_TEST_DOMAIN
+		auto_register "{{.Name}}.{{env \"JOYRIDE_TEST_DOMAIN\"}}"
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := dc.Watcher.templateEnv["JOYRIDE_TEST_DOMAIN"]; got != "lab.example.com" {
+		t.Errorf("expected captured env var, got %q", got)
+	}
+	if got := dc.Watcher.autoHostname(hostnameData{Name: "grafana"}); got != "grafana.lab.example.com" {
+		t.Errorf("expected grafana.lab.example.com, got %q", got)
+	}
+	if dc.Watcher.nodeName == "" {
+		t.Error("expected node name to default to the OS hostname")
+	}
+
+	// Variables must be allowed with template_env
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		auto_register "{{.Name}}.{{env \"JOYRIDE_TEST_DOMAIN\"}}"
+	}`)
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for env var not in template_env")
+	}
+}
+
+func TestSetupWithMultipleDockerDaemons(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.1
+		docker_socket unix:///var/run/docker.sock
+		docker_socket tcp://10.0.0.5:2376 host_ip 10.0.0.5 tls /certs/cert.pem /certs/key.pem /certs/ca.pem
+		docker_socket tcp://10.0.0.6:2375
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dc.Watcher.dockerSocket != "unix:///var/run/docker.sock" {
+		t.Errorf("expected the first docker_socket to be the main watcher, got %s", dc.Watcher.dockerSocket)
+	}
+	if len(dc.Watcher.daemons) != 2 {
+		t.Fatalf("expected 2 further daemons, got %d", len(dc.Watcher.daemons))
+	}
+	remote := dc.Watcher.daemons[0]
+	if remote.dockerSocket != "tcp://10.0.0.5:2376" || remote.hostIP != "10.0.0.5" || remote.tls.CA != "/certs/ca.pem" {
+		t.Errorf("unexpected daemon %s host_ip=%s tls=%+v", remote.dockerSocket, remote.hostIP, remote.tls)
+	}
+	if dc.Watcher.daemons[1].hostIP != "192.168.1.1" {
+		t.Errorf("expected daemon without host_ip to use the plugin's, got %s", dc.Watcher.daemons[1].hostIP)
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.1
+		docker_socket tcp://10.0.0.5:2376 tls /certs/cert.pem
+	}`)
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for tls without a key")
+	}
+}
+
+func TestSetupDOCKER_HOSTEnv(t *testing.T) {
+	t.Setenv("DOCKER_SOCKET", "")
+	t.Setenv("DOCKER_HOST", "tcp://socket-proxy:2375")
+	t.Setenv("DOCKER_CERT_PATH", "/certs")
+
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.1
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dc.Watcher.dockerSocket != "tcp://socket-proxy:2375" {
+		t.Errorf("expected DOCKER_HOST, got %s", dc.Watcher.dockerSocket)
+	}
+	if !dc.Watcher.tls.FromEnv {
+		t.Error("expected TLS from DOCKER_CERT_PATH")
+	}
+}
+
+func TestSetupWithTraefikLabels(t *testing.T) {
+	c := caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		traefik_labels
+	}`)
+	dc, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Watcher.traefik == nil || !dc.Watcher.traefik.ExposedByDefault {
+		t.Errorf("expected traefik labels exposed by default, got %+v", dc.Watcher.traefik)
+	}
+
+	c = caddy.NewTestController("dns", `docker-cluster {
+		host_ip 192.168.1.100
+		traefik_labels exposed_by_default false
+	}`)
+	dc, err = parseConfig(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dc.Watcher.traefik == nil || dc.Watcher.traefik.ExposedByDefault {
+		t.Errorf("expected exposed_by_default false, got %+v", dc.Watcher.traefik)
+	}
+
+	for _, input := range []string{
+		"traefik_labels exposed_by_default maybe",
+		"traefik_labels explicit",
+	} {
+		c = caddy.NewTestController("dns", "docker-cluster {\n\thost_ip 192.168.1.100\n\t"+input+"\n}")
+		if _, err := parseConfig(c); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package dockercluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// snapshotInterval is how often the records are checked for changes and,
+// if they changed, written to the state file.
+const snapshotInterval = 5 * time.Second
+
+// defaultSnapshotGrace is how long restored records of other nodes are
+// served without a peer confirming them.
+const defaultSnapshotGrace = 2 * time.Minute
+
+// Snapshot persists the records to a state file, so that a restarted node
+// answers from the last known records right away instead of nothing until
+// Docker reconnects and cluster push/pull completes.
+//
+// Restored records are served until their source reports in: the local
+// node's until every Docker daemon has been synced once, other nodes' until
+// a peer confirms them or Grace runs out.
+type Snapshot struct {
+	Path string // State file, written atomically
+
+	// StaleTTL caps the answer TTL of restored records (0: no cap).
+	StaleTTL uint32
+	// Grace is how long restored records of other nodes wait for a peer.
+	Grace time.Duration
+
+	records *Records
+	saved   uint64 // Records version last written
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewSnapshot creates a Snapshot of records stored at path.
+func NewSnapshot(path string, records *Records) *Snapshot {
+	return &Snapshot{
+		Path:    path,
+		Grace:   defaultSnapshotGrace,
+		records: records,
+	}
+}
+
+// Load restores the records of the state file. Without clustering only the
+// local node's records are restored. A missing file is not an error.
+// Returns the number of entries restored.
+func (s *Snapshot) Load(clustered bool) (int, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	state, err := DecodeFullState(data)
+	if err != nil {
+		return 0, fmt.Errorf("invalid state file %s: %v", s.Path, err)
+	}
+	local := s.records.localNode
+	return s.records.Restore(state.Records, func(nodeID string) bool {
+		return clustered || nodeID == local
+	}), nil
+}
+
+// Save writes the records to the state file if they changed since the last
+// save. The file is replaced atomically, so a crash leaves the previous one.
+func (s *Snapshot) Save() error {
+	version := s.records.Version()
+	if version == s.saved {
+		return nil
+	}
+
+	state := &FullState{NodeID: s.records.localNode, Records: s.records.GetAllWithMeta()}
+	data, err := state.Encode()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.Path, data); err != nil {
+		return err
+	}
+	s.saved = version
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file in the same directory, so readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Start saves the records as they change and reconciles the restored ones:
+// the local node's once watcher has synced every daemon, withdrawing (and
+// announcing through the watcher's callback) those no container claims;
+// other nodes' after Grace.
+func (s *Snapshot) Start(ctx context.Context, watcher *DockerWatcher) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	s.wg.Add(3)
+	go s.saveLoop(ctx)
+	go func() {
+		defer s.wg.Done()
+		reconcileLocal(ctx, s.records, watcher)
+	}()
+	go func() {
+		defer s.wg.Done()
+		select {
+		case <-time.After(s.Grace):
+		case <-ctx.Done():
+			return
+		}
+		if removed := s.records.DropRestored(false); len(removed) > 0 {
+			log.Infof("docker-cluster: removed %d restored record(s) of other nodes no peer confirmed: %v", len(removed), removed)
+		}
+	}()
+}
+
+// reconcileLocal withdraws the local node's restored entries no container
+// claims once watcher has synced every daemon, and announces the removals
+// through the watcher's callback.
+func reconcileLocal(ctx context.Context, records *Records, watcher *DockerWatcher) {
+	if !watcher.waitSynced(ctx) {
+		return
+	}
+	removed := records.DropRestored(true)
+	if len(removed) > 0 {
+		log.Infof("docker-cluster: removed %d restored record(s) no container claims: %v", len(removed), removed)
+	}
+	ts := time.Now().UnixNano()
+	changes := make([]recordChange, len(removed))
+	for i, hostname := range removed {
+		changes[i] = recordChange{hostname: hostname, entry: RecordEntry{Timestamp: ts}}
+	}
+	watcher.notify(changes)
+}
+
+// Stop halts the background work and writes the records a last time.
+func (s *Snapshot) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	if err := s.Save(); err != nil {
+		log.Errorf("docker-cluster: failed to write state file %s: %v", s.Path, err)
+	}
+}
+
+// saveLoop writes the records every snapshotInterval if they changed.
+func (s *Snapshot) saveLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Save(); err != nil {
+				log.Errorf("docker-cluster: failed to write state file %s: %v", s.Path, err)
+			}
+		}
+	}
+}
+
+// parseSnapshot parses the arguments of snapshot:
+//
+//	PATH [stale_ttl SECONDS] [grace DURATION]
+func parseSnapshot(args []string, records *Records) (*Snapshot, error) {
+	if len(args) == 0 || len(args)%2 == 0 {
+		return nil, fmt.Errorf("takes PATH [stale_ttl SECONDS] [grace DURATION]")
+	}
+	s := NewSnapshot(args[0], records)
+	for i := 1; i < len(args); i += 2 {
+		option, value := args[i], args[i+1]
+		switch option {
+		case "stale_ttl":
+			ttl, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid stale_ttl: %s", value)
+			}
+			s.StaleTTL = uint32(ttl)
+		case "grace":
+			grace, err := time.ParseDuration(value)
+			if err != nil || grace < 0 {
+				return nil, fmt.Errorf("invalid grace: %s", value)
+			}
+			s.Grace = grace
+		default:
+			return nil, fmt.Errorf("unknown option %q (valid: stale_ttl, grace)", option)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,182 @@
+package dockercluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	records := NewRecords()
+	records.SetLocalNode("node1")
+	records.AddEntry("app.example.com", RecordEntry{IP: "10.0.0.1", TTL: 30, Timestamp: 100})
+	records.AddEntryWithMeta("web.example.com", RecordEntry{IP: "10.0.0.2", Timestamp: 100, NodeID: "node2"})
+
+	s := NewSnapshot(path, records)
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("state file not written: %v", err)
+	}
+
+	// Unchanged records are not written again
+	os.Remove(path)
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no write without changes (previous size %d)", info.Size())
+	}
+	records.Remove("app.example.com")
+	records.AddEntry("app.example.com", RecordEntry{IP: "10.0.0.1", TTL: 30, Timestamp: 100})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	for _, tt := range []struct {
+		clustered bool
+		want      int
+	}{
+		{clustered: true, want: 2},
+		{clustered: false, want: 1},
+	} {
+		restored := NewRecords()
+		restored.SetLocalNode("node1")
+		n, err := NewSnapshot(path, restored).Load(tt.clustered)
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if n != tt.want || restored.Count() != tt.want {
+			t.Errorf("clustered=%v: restored %d entries (%d hostnames), want %d", tt.clustered, n, restored.Count(), tt.want)
+		}
+		entry, _ := restored.LookupEntry("app.example.com")
+		if entry.IP != "10.0.0.1" || entry.TTL != 30 || !entry.restored {
+			t.Errorf("unexpected restored entry %+v", entry)
+		}
+	}
+}
+
+func TestSnapshotLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if n, err := NewSnapshot(filepath.Join(dir, "missing.json"), NewRecords()).Load(true); n != 0 || err != nil {
+		t.Errorf("expected a missing file to restore nothing, got %d, %v", n, err)
+	}
+
+	path := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSnapshot(path, NewRecords()).Load(true); err == nil {
+		t.Error("expected error for a corrupt state file")
+	}
+}
+
+func TestSnapshotReconcile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	records := NewRecords()
+	records.SetLocalNode("node1")
+	records.Restore(map[string][]RecordEntry{
+		"app.example.com":  {{IP: "10.0.0.1", Timestamp: 100, NodeID: "node1"}},
+		"gone.example.com": {{IP: "10.0.0.1", Timestamp: 100, NodeID: "node1"}},
+		"web.example.com":  {{IP: "10.0.0.2", Timestamp: 100, NodeID: "node2"}},
+	}, func(string) bool { return true })
+
+	watcher := NewDockerWatcher("", "10.0.0.1", nil, records)
+	removed := make(chan string, 4)
+	watcher.SetCallback(func(hostname string, entry RecordEntry, added bool) {
+		if !added {
+			removed <- hostname
+		}
+	})
+
+	s := NewSnapshot(path, records)
+	s.Grace = time.Hour
+	s.Start(context.Background(), watcher)
+
+	// The container behind app.example.com is still running
+	watcher.updateContainer("app", []string{"app.example.com"}, RecordEntry{IP: "10.0.0.1"})
+	watcher.markSynced()
+
+	select {
+	case hostname := <-removed:
+		if hostname != "gone.example.com" {
+			t.Errorf("expected gone.example.com to be withdrawn, got %s", hostname)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("restored record without a container was not withdrawn")
+	}
+	s.Stop()
+
+	if _, ok := records.Lookup("app.example.com"); !ok {
+		t.Error("expected the claimed record to remain")
+	}
+	if entry, ok := records.LookupEntry("web.example.com"); !ok || !entry.restored {
+		t.Error("expected other nodes' records to remain within the grace period")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the state file to be written on Stop: %v", err)
+	}
+}
+
+func TestSnapshotGrace(t *testing.T) {
+	records := NewRecords()
+	records.Restore(map[string][]RecordEntry{
+		"web.example.com": {{IP: "10.0.0.2", Timestamp: 100, NodeID: "node2"}},
+	}, func(string) bool { return true })
+
+	s := NewSnapshot(filepath.Join(t.TempDir(), "records.json"), records)
+	s.Grace = 10 * time.Millisecond
+	s.Start(context.Background(), &DockerWatcher{})
+	defer s.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for records.Count() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("unconfirmed record of another node outlived the grace period")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRecordTTLStale(t *testing.T) {
+	dc := &DockerCluster{TTL: 60, Snapshot: &Snapshot{StaleTTL: 10}}
+	if ttl := dc.recordTTL(RecordEntry{IP: "10.0.0.1"}); ttl != 60 {
+		t.Errorf("expected live records to use the plugin ttl, got %d", ttl)
+	}
+	if ttl := dc.recordTTL(RecordEntry{IP: "10.0.0.1"}, RecordEntry{IP: "10.0.0.2", restored: true}); ttl != 10 {
+		t.Errorf("expected restored records to use stale_ttl, got %d", ttl)
+	}
+	if ttl := dc.recordTTL(RecordEntry{IP: "10.0.0.1", TTL: 5, restored: true}); ttl != 5 {
+		t.Errorf("expected a lower label TTL to be kept, got %d", ttl)
+	}
+}
+
+func TestParseSnapshot(t *testing.T) {
+	s, err := parseSnapshot([]string{"/data/records.json", "stale_ttl", "10", "grace", "30s"}, NewRecords())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if s.Path != "/data/records.json" || s.StaleTTL != 10 || s.Grace != 30*time.Second {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+
+	if s, _ := parseSnapshot([]string{"/data/records.json"}, NewRecords()); s.StaleTTL != 0 || s.Grace != defaultSnapshotGrace {
+		t.Errorf("unexpected defaults %+v", s)
+	}
+
+	for _, args := range [][]string{
+		{"/data/records.json", "stale_ttl"},
+		{"/data/records.json", "stale_ttl", "-1"},
+		{"/data/records.json", "grace", "soon"},
+		{"/data/records.json", "ttl", "10"},
+	} {
+		if _, err := parseSnapshot(args, NewRecords()); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package dockercluster
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// SwarmMode selects whether Swarm services are published and which addresses
+// their hostnames resolve to.
+type SwarmMode int
+
+const (
+	// SwarmOff ignores Swarm services - default
+	SwarmOff SwarmMode = iota
+	// SwarmVIP answers with the service's virtual IPs
+	SwarmVIP
+	// SwarmNodes answers with the addresses of the nodes running the service's tasks
+	SwarmNodes
+)
+
+// swarmRefreshInterval is how often services are re-synced in SwarmNodes mode;
+// tasks moving between nodes don't emit service events.
+const swarmRefreshInterval = 30 * time.Second
+
+// serviceKeyPrefix marks Swarm services in DockerWatcher.containers, which
+// tracks their records alongside the local containers'.
+const serviceKeyPrefix = "service:"
+
+// syncServices publishes the DNS labels of every Swarm service and withdraws
+// services that are gone or have no address. It requires a manager node.
+func (dw *DockerWatcher) syncServices() error {
+	dw.mu.RLock()
+	cli := dw.client
+	dw.mu.RUnlock()
+
+	if cli == nil {
+		return nil
+	}
+
+	// Serialize syncs from events and the refresh loop
+	dw.swarmMu.Lock()
+	defer dw.swarmMu.Unlock()
+
+	services, err := cli.ServiceList(dw.ctx, client.ServiceListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var (
+		tasks     []swarm.Task
+		nodeAddrs map[string]string
+	)
+	if dw.swarmMode == SwarmNodes {
+		taskList, err := cli.TaskList(dw.ctx, client.TaskListOptions{
+			Filters: make(client.Filters).Add("desired-state", "running"),
+		})
+		if err != nil {
+			return err
+		}
+		nodeList, err := cli.NodeList(dw.ctx, client.NodeListOptions{})
+		if err != nil {
+			return err
+		}
+		tasks = taskList.Items
+		nodeAddrs = swarmNodeAddrs(nodeList.Items)
+	}
+
+	seen := make(map[string]bool)
+	for _, service := range services.Items {
+		if dw.applyService(service, tasks, nodeAddrs) {
+			seen[serviceKeyPrefix+service.ID] = true
+		}
+	}
+
+	var gone []string
+	dw.mu.RLock()
+	for key := range dw.containers {
+		if strings.HasPrefix(key, serviceKeyPrefix) && !seen[key] {
+			gone = append(gone, key)
+		}
+	}
+	dw.mu.RUnlock()
+
+	for _, key := range gone {
+		if hostnames := dw.removeContainer(key); len(hostnames) > 0 {
+			log.Infof("docker-cluster: service %s removed, removed hostnames: %v", truncateID(strings.TrimPrefix(key, serviceKeyPrefix), 12), hostnames)
+		}
+	}
+	return nil
+}
+
+// applyService adds records for a Swarm service from the DNS labels in its
+// spec. tasks and nodeAddrs are only used in SwarmNodes mode. Returns false if
+// the service has no hostnames or no address (e.g. no running tasks).
+func (dw *DockerWatcher) applyService(service swarm.Service, tasks []swarm.Task, nodeAddrs map[string]string) bool {
+	labels := service.Spec.Labels
+	hostnames := dw.containerHostnames(service.Spec.Name, labels)
+	if len(hostnames) == 0 {
+		return false
+	}
+
+	entry := dw.labelRecord("service "+service.Spec.Name, labels)
+	if entry.CNAME == "" {
+		var addrs []string
+		if dw.swarmMode == SwarmNodes {
+			addrs = serviceNodeAddrs(service.ID, tasks, nodeAddrs)
+		} else {
+			addrs = serviceVIPs(service)
+		}
+		entry.IP, entry.IPv6, entry.Addrs = splitAddrs(addrs)
+		if entry.IP == "" && entry.IPv6 == "" {
+			log.Debugf("docker-cluster: service %s has no address, not registering", service.Spec.Name)
+			return false
+		}
+	}
+
+	var image string
+	if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		// Drop the digest Swarm pins the image to
+		image, _, _ = strings.Cut(spec.Image, "@")
+	}
+	entry.Container = &ContainerInfo{ID: service.ID, Name: service.Spec.Name, Image: image}
+	dw.updateContainer(serviceKeyPrefix+service.ID, hostnames, entry)
+	return true
+}
+
+// refreshServices re-syncs services periodically until the watcher stops.
+func (dw *DockerWatcher) refreshServices() {
+	defer dw.wg.Done()
+
+	ticker := time.NewTicker(swarmRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dw.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dw.syncServices(); err != nil {
+				log.Warningf("docker-cluster: failed to sync swarm services: %v", err)
+			}
+		}
+	}
+}
+
+// serviceVIPs returns the virtual IPs of a service on all its networks.
+func serviceVIPs(service swarm.Service) []string {
+	var addrs []string
+	for _, vip := range service.Endpoint.VirtualIPs {
+		if vip.Addr.IsValid() {
+			addrs = append(addrs, vip.Addr.Addr().String())
+		}
+	}
+	return addrs
+}
+
+// serviceNodeAddrs returns the addresses of the nodes running tasks of a service.
+func serviceNodeAddrs(serviceID string, tasks []swarm.Task, nodeAddrs map[string]string) []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, task := range tasks {
+		if task.ServiceID != serviceID || task.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+		if addr, ok := nodeAddrs[task.NodeID]; ok && !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// swarmNodeAddrs maps node IDs to their addresses. Managers may report
+// 0.0.0.0 as their node address; their manager address is used instead.
+func swarmNodeAddrs(nodes []swarm.Node) map[string]string {
+	addrs := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		addr, err := netip.ParseAddr(node.Status.Addr)
+		if (err != nil || addr.IsUnspecified()) && node.ManagerStatus != nil {
+			if host, _, splitErr := net.SplitHostPort(node.ManagerStatus.Addr); splitErr == nil {
+				addr, err = netip.ParseAddr(host)
+			}
+		}
+		if err == nil && !addr.IsUnspecified() {
+			addrs[node.ID] = addr.Unmap().String()
+		}
+	}
+	return addrs
+}
+
+// splitAddrs sorts addresses into a record's first IPv4 and IPv6 address and
+// the remaining ones.
+func splitAddrs(addrs []string) (ip, ipv6 string, rest []string) {
+	sorted := append([]string(nil), addrs...)
+	sort.Strings(sorted)
+	for _, addr := range sorted {
+		switch {
+		case isIPv6(addr) && ipv6 == "":
+			ipv6 = addr
+		case !isIPv6(addr) && ip == "":
+			ip = addr
+		default:
+			rest = append(rest, addr)
+		}
+	}
+	return ip, ipv6, rest
+}
+
+// parseSwarmMode converts a string to SwarmMode.
+func parseSwarmMode(s string) (SwarmMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "off":
+		return SwarmOff, nil
+	case "vip":
+		return SwarmVIP, nil
+	case "nodes":
+		return SwarmNodes, nil
+	default:
+		return SwarmOff, fmt.Errorf("unknown swarm mode: %s", s)
+	}
+}
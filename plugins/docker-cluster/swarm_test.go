@@ -0,0 +1,120 @@
+package dockercluster
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func newSwarmTestWatcher(mode SwarmMode) *DockerWatcher {
+	return &DockerWatcher{
+		hostIP:     "192.168.1.100",
+		labels:     []string{"coredns.host.name"},
+		records:    NewRecords(),
+		containers: make(map[string]containerState),
+		swarmMode:  mode,
+	}
+}
+
+func testService(id, hostname string) swarm.Service {
+	return swarm.Service{
+		ID: id,
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{
+				Name:   "web",
+				Labels: map[string]string{"coredns.host.name": hostname},
+			},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{Image: "nginx:latest@sha256:abc"},
+			},
+		},
+		Endpoint: swarm.Endpoint{
+			VirtualIPs: []swarm.EndpointVirtualIP{
+				{NetworkID: "ingress", Addr: netip.MustParsePrefix("10.0.0.5/24")},
+			},
+		},
+	}
+}
+
+func TestApplyServiceVIP(t *testing.T) {
+	dw := newSwarmTestWatcher(SwarmVIP)
+
+	if !dw.applyService(testService("svc1", "web.example.com"), nil, nil) {
+		t.Fatal("expected the service to be registered")
+	}
+	entry, ok := dw.records.LookupEntry("web.example.com")
+	if !ok || entry.IP != "10.0.0.5" {
+		t.Fatalf("expected VIP 10.0.0.5, got %+v", entry)
+	}
+	if entry.Container == nil || entry.Container.Name != "web" || entry.Container.Image != "nginx:latest" {
+		t.Errorf("unexpected service metadata %+v", entry.Container)
+	}
+	if _, ok := dw.containers[serviceKeyPrefix+"svc1"]; !ok {
+		t.Error("service not tracked")
+	}
+
+	// Services without DNS labels are skipped
+	unlabeled := testService("svc2", "web.example.com")
+	unlabeled.Spec.Labels = nil
+	if dw.applyService(unlabeled, nil, nil) {
+		t.Error("expected an unlabeled service to be skipped")
+	}
+}
+
+func TestApplyServiceNodes(t *testing.T) {
+	dw := newSwarmTestWatcher(SwarmNodes)
+
+	nodeAddrs := swarmNodeAddrs([]swarm.Node{
+		{ID: "n1", Status: swarm.NodeStatus{Addr: "192.168.1.11"}},
+		{ID: "n2", Status: swarm.NodeStatus{Addr: "0.0.0.0"}, ManagerStatus: &swarm.ManagerStatus{Addr: "192.168.1.12:2377"}},
+		{ID: "n3", Status: swarm.NodeStatus{Addr: "192.168.1.13"}},
+	})
+	tasks := []swarm.Task{
+		{ServiceID: "svc1", NodeID: "n2", Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+		{ServiceID: "svc1", NodeID: "n1", Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+		{ServiceID: "svc1", NodeID: "n1", Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+		{ServiceID: "svc1", NodeID: "n3", Status: swarm.TaskStatus{State: swarm.TaskStatePreparing}},
+		{ServiceID: "svc2", NodeID: "n3", Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+	}
+
+	if !dw.applyService(testService("svc1", "web.example.com"), tasks, nodeAddrs) {
+		t.Fatal("expected the service to be registered")
+	}
+	entry, _ := dw.records.LookupEntry("web.example.com")
+	got := entry.addrs(false)
+	if !equalSlice(got, []string{"192.168.1.11", "192.168.1.12"}) {
+		t.Errorf("expected the nodes running tasks, got %v", got)
+	}
+
+	// No running tasks: not registered
+	if dw.applyService(testService("svc3", "idle.example.com"), tasks, nodeAddrs) {
+		t.Error("expected a service without running tasks to be skipped")
+	}
+}
+
+func TestSplitAddrs(t *testing.T) {
+	ip, ipv6, rest := splitAddrs([]string{"10.0.0.2", "fd00::1", "10.0.0.1", "fd00::2"})
+	if ip != "10.0.0.1" || ipv6 != "fd00::1" || !equalSlice(rest, []string{"10.0.0.2", "fd00::2"}) {
+		t.Errorf("splitAddrs = %q, %q, %v", ip, ipv6, rest)
+	}
+}
+
+func TestParseSwarmMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    SwarmMode
+		wantErr bool
+	}{
+		{"off", SwarmOff, false},
+		{"vip", SwarmVIP, false},
+		{"NODES", SwarmNodes, false},
+		{"ingress", SwarmOff, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSwarmMode(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSwarmMode(%q) = %d, %v", tt.input, got, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package dockercluster
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+	traefikexternals "github.com/coredns/coredns/plugin/traefik-externals"
+)
+
+// traefikEnableLabel opts a container in or out of Traefik's Docker provider.
+const traefikEnableLabel = "traefik.enable"
+
+// traefikRouterPrefixes are the router labels whose rules name hostnames,
+// e.g. traefik.http.routers.app.rule=Host(`app.example.com`).
+var traefikRouterPrefixes = []string{"traefik.http.routers.", "traefik.tcp.routers."}
+
+// TraefikLabels reads hostnames from the Traefik router rules in container
+// labels, like traefik-externals does for Traefik's file provider.
+type TraefikLabels struct {
+	// ExposedByDefault mirrors Traefik's providers.docker.exposedByDefault:
+	// if false, only containers labeled traefik.enable=true are read.
+	ExposedByDefault bool
+
+	parser *traefikexternals.Parser
+}
+
+// NewTraefikLabels returns a TraefikLabels whose rules may read the
+// environment variables in env with {{env "VAR"}}.
+func NewTraefikLabels(exposedByDefault bool, env map[string]string) *TraefikLabels {
+	return &TraefikLabels{
+		ExposedByDefault: exposedByDefault,
+		parser:           traefikexternals.NewParserWithEnv(env),
+	}
+}
+
+// hostnames returns the Host() and HostSNI() hostnames of a container's
+// http and tcp router rules, unless Traefik ignores the container.
+func (t *TraefikLabels) hostnames(labels map[string]string) []string {
+	enabled := t.ExposedByDefault
+	if value, ok := labels[traefikEnableLabel]; ok {
+		if parsed, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			enabled = parsed
+		}
+	}
+	if !enabled {
+		return nil
+	}
+
+	var rules []string
+	for key := range labels {
+		if !strings.HasSuffix(key, ".rule") {
+			continue
+		}
+		for _, prefix := range traefikRouterPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				rules = append(rules, key)
+				break
+			}
+		}
+	}
+	sort.Strings(rules)
+
+	var hostnames []string
+	seen := make(map[string]bool)
+	for _, key := range rules {
+		for _, hostname := range t.parser.ParseContent(labels[key]) {
+			// HostSNI(`*`) matches any name: nothing to register
+			if hostname == "*" || seen[hostname] {
+				continue
+			}
+			if !isValidHostname(hostname) && !isValidWildcard(hostname) {
+				log.Warningf("docker-cluster: ignoring invalid hostname %q from label %s", hostname, key)
+				continue
+			}
+			seen[hostname] = true
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	return hostnames
+}
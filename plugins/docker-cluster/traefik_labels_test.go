@@ -0,0 +1,109 @@
+package dockercluster
+
+import (
+	"testing"
+)
+
+func TestTraefikLabelsHostnames(t *testing.T) {
+	traefik := NewTraefikLabels(true, map[string]string{"DOMAIN": "example.com"})
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{
+			name:   "http router",
+			labels: map[string]string{"traefik.http.routers.app.rule": "Host(`app.example.com`)"},
+			want:   []string{"app.example.com"},
+		},
+		{
+			name: "multiple routers and hosts",
+			labels: map[string]string{
+				"traefik.http.routers.web.rule":     "Host(`www.example.com`, `Example.com`) && PathPrefix(`/`)",
+				"traefik.http.routers.api.rule":     "Host(`api.example.com`) || Host(`www.example.com`)",
+				"traefik.http.routers.api.service":  "api",
+				"traefik.http.services.api.rule":    "Host(`not-a-router.example.com`)",
+				"traefik.http.routers.web.priority": "10",
+			},
+			want: []string{"api.example.com", "www.example.com", "example.com"},
+		},
+		{
+			name: "tcp router",
+			labels: map[string]string{
+				"traefik.tcp.routers.db.rule":    "HostSNI(`db.example.com`)",
+				"traefik.tcp.routers.other.rule": "HostSNI(`*`)",
+			},
+			want: []string{"db.example.com"},
+		},
+		{
+			name:   "env template",
+			labels: map[string]string{"traefik.http.routers.app.rule": "Host(`app.{{env \"DOMAIN\"}}`)"},
+			want:   []string{"app.example.com"},
+		},
+		{
+			name:   "env not allowed",
+			labels: map[string]string{"traefik.http.routers.app.rule": "Host(`app.{{env \"HOME\"}}`)"},
+			want:   nil,
+		},
+		{
+			name: "disabled",
+			labels: map[string]string{
+				"traefik.enable":                "false",
+				"traefik.http.routers.app.rule": "Host(`app.example.com`)",
+			},
+			want: nil,
+		},
+		{
+			name:   "invalid hostname",
+			labels: map[string]string{"traefik.http.routers.app.rule": "Host(`bad_host.example.com`)"},
+			want:   nil,
+		},
+		{
+			name:   "unlabeled",
+			labels: map[string]string{"com.docker.compose.service": "web"},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := traefik.hostnames(tt.labels); !equalSlice(got, tt.want) {
+				t.Errorf("hostnames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraefikLabelsExposedByDefault(t *testing.T) {
+	traefik := NewTraefikLabels(false, nil)
+	rule := map[string]string{"traefik.http.routers.app.rule": "Host(`app.example.com`)"}
+
+	if got := traefik.hostnames(rule); got != nil {
+		t.Errorf("expected containers without traefik.enable to be ignored, got %v", got)
+	}
+
+	rule["traefik.enable"] = "true"
+	if got := traefik.hostnames(rule); !equalSlice(got, []string{"app.example.com"}) {
+		t.Errorf("expected traefik.enable=true to opt in, got %v", got)
+	}
+}
+
+func TestContainerHostnamesTraefik(t *testing.T) {
+	dw := &DockerWatcher{
+		labels:  []string{"coredns.host.name"},
+		traefik: NewTraefikLabels(true, nil),
+	}
+	labels := map[string]string{
+		"coredns.host.name":             "app.example.com,extra.example.com",
+		"traefik.http.routers.app.rule": "Host(`app.example.com`) || Host(`www.example.com`)",
+	}
+	want := []string{"app.example.com", "extra.example.com", "www.example.com"}
+	if got := dw.containerHostnames("app", labels); !equalSlice(got, want) {
+		t.Errorf("containerHostnames() = %v, want %v", got, want)
+	}
+
+	labels["coredns.enable"] = "false"
+	if got := dw.containerHostnames("app", labels); got != nil {
+		t.Errorf("expected coredns.enable=false to opt out, got %v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package dockercluster
+
+import (
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/miekg/dns"
+)
+
+// SOA timers for the synthesized zones. Nothing transfers these zones, so only
+// the minimum (negative caching) TTL matters; it follows the configured ttl.
+const (
+	soaRefresh = 7200
+	soaRetry   = 1800
+	soaExpire  = 86400
+)
+
+// zone returns the most specific zone qname falls in: one of the plugin's
+// zones or, for reverse names, one of its reverse zones. Without configured
+// zones the plugin is authoritative for the root zone. Returns "" if qname is
+// outside every zone.
+func (dc *DockerCluster) zone(qname string) string {
+	qname = strings.ToLower(dns.Fqdn(qname))
+	zones := dc.Zones
+	if len(zones) == 0 {
+		zones = []string{"."}
+	}
+	zone := plugin.Zones(zones).Matches(qname)
+	if reverse := plugin.Zones(dc.ReverseZones).Matches(qname); len(reverse) > len(zone) {
+		zone = reverse
+	}
+	return zone
+}
+
+// nameserver returns the name of the NS synthesized for zone.
+func nameserver(zone string) string {
+	return dnsutil.Join("ns.dns", zone)
+}
+
+// soa synthesizes the SOA record of zone. The serial is the current time,
+// as records change without any zone file to version.
+func (dc *DockerCluster) soa(zone string) dns.RR {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    dc.TTL,
+		},
+		Ns:      nameserver(zone),
+		Mbox:    dnsutil.Join("hostmaster", zone),
+		Serial:  uint32(time.Now().Unix()),
+		Refresh: soaRefresh,
+		Retry:   soaRetry,
+		Expire:  soaExpire,
+		Minttl:  dc.TTL,
+	}
+}
+
+// zoneRecords returns the records synthesized for qname in zone: SOA and NS
+// at the apex and the nameserver's addresses (the host IPs). The root zone
+// gets none, so a catch-all server block doesn't take over root queries.
+func (dc *DockerCluster) zoneRecords(qname string, qtype uint16, zone string) (answer, extra []dns.RR) {
+	if zone == "." {
+		return nil, nil
+	}
+	qname = strings.ToLower(qname)
+	ns := nameserver(zone)
+
+	switch {
+	case qname == zone && qtype == dns.TypeSOA:
+		return []dns.RR{dc.soa(zone)}, nil
+
+	case qname == zone && qtype == dns.TypeNS:
+		answer = []dns.RR{&dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   zone,
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    dc.TTL,
+			},
+			Ns: ns,
+		}}
+		return answer, append(dc.hostAddrs(ns, dns.TypeA), dc.hostAddrs(ns, dns.TypeAAAA)...)
+
+	case qname == ns && (qtype == dns.TypeA || qtype == dns.TypeAAAA):
+		return dc.hostAddrs(ns, qtype), nil
+	}
+	return nil, nil
+}
+
+// hostAddrs returns the host's own address of the qtype family as an A or
+// AAAA record for name. Unset and unspecified (0.0.0.0) addresses are skipped.
+func (dc *DockerCluster) hostAddrs(name string, qtype uint16) []dns.RR {
+	if dc.Watcher == nil {
+		return nil
+	}
+	ip := dc.Watcher.hostIP
+	if qtype == dns.TypeAAAA {
+		ip = dc.Watcher.hostIPv6
+	}
+	if addr, err := netip.ParseAddr(ip); err != nil || addr.IsUnspecified() {
+		return nil
+	}
+	if rr := addressRecord(name, qtype, ip, dc.TTL); rr != nil {
+		return []dns.RR{rr}
+	}
+	return nil
+}
+
+// nameExists reports whether qname exists in zone without records of its own:
+// the apex, the synthesized nameserver, or an empty non-terminal above
+// registered hostnames. Such names get NODATA rather than NXDOMAIN, which
+// would tell resolvers that nothing below them exists either. In the root
+// zone other servers own these names (split DNS), so none exist here.
+func (dc *DockerCluster) nameExists(qname, zone string) bool {
+	if zone == "." {
+		return false
+	}
+	qname = strings.ToLower(qname)
+	if qname == zone || qname == nameserver(zone) {
+		return true
+	}
+	return dc.Records.HasSubdomain(strings.TrimSuffix(qname, "."))
+}
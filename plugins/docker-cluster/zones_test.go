@@ -0,0 +1,168 @@
+package dockercluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func newZoneTestCluster() *DockerCluster {
+	records := NewRecords()
+	records.Add("app.example.com", "10.0.0.1")
+	records.Add("web.preview.example.com", "10.0.0.2")
+
+	return &DockerCluster{
+		Records:       records,
+		Watcher:       &DockerWatcher{hostIP: "192.168.1.10", hostIPv6: "fd00::10"},
+		TTL:           60,
+		UnknownAction: ActionNXDomain,
+		Zones:         []string{"example.com."},
+	}
+}
+
+func queryZone(t *testing.T, dc *DockerCluster, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Msg == nil {
+		t.Fatalf("expected a response for %s %s", name, dns.TypeToString[qtype])
+	}
+	return rec.Msg
+}
+
+// hasSOA reports whether m carries zone's SOA in its authority section.
+func hasSOA(m *dns.Msg, zone string) bool {
+	if len(m.Ns) != 1 {
+		return false
+	}
+	soa, ok := m.Ns[0].(*dns.SOA)
+	return ok && soa.Hdr.Name == zone && soa.Minttl == 60
+}
+
+func TestServeDNSApexSOA(t *testing.T) {
+	dc := newZoneTestCluster()
+
+	m := queryZone(t, dc, "example.com.", dns.TypeSOA)
+	if len(m.Answer) != 1 {
+		t.Fatalf("expected 1 SOA answer, got %v", m.Answer)
+	}
+	soa, ok := m.Answer[0].(*dns.SOA)
+	if !ok || soa.Ns != "ns.dns.example.com." || soa.Mbox != "hostmaster.example.com." {
+		t.Errorf("unexpected SOA %v", m.Answer[0])
+	}
+	if !m.Authoritative {
+		t.Error("expected authoritative answer")
+	}
+}
+
+func TestServeDNSApexNS(t *testing.T) {
+	dc := newZoneTestCluster()
+
+	m := queryZone(t, dc, "example.com.", dns.TypeNS)
+	if len(m.Answer) != 1 {
+		t.Fatalf("expected 1 NS answer, got %v", m.Answer)
+	}
+	if ns, ok := m.Answer[0].(*dns.NS); !ok || ns.Ns != "ns.dns.example.com." {
+		t.Errorf("unexpected NS %v", m.Answer[0])
+	}
+	if len(m.Extra) != 2 {
+		t.Errorf("expected A and AAAA glue, got %v", m.Extra)
+	}
+
+	// The nameserver resolves to the host IP
+	m = queryZone(t, dc, "ns.dns.example.com.", dns.TypeA)
+	if len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.168.1.10" {
+		t.Errorf("expected ns.dns.example.com. A 192.168.1.10, got %v", m.Answer)
+	}
+}
+
+func TestServeDNSNoDataWithSOA(t *testing.T) {
+	dc := newZoneTestCluster()
+
+	tests := []struct {
+		name  string
+		qtype uint16
+	}{
+		{"app.example.com.", dns.TypeMX},             // known hostname, other qtype
+		{"app.example.com.", dns.TypeTXT},            // known hostname, other qtype
+		{"example.com.", dns.TypeA},                  // apex without records
+		{"preview.example.com.", dns.TypeA},          // empty non-terminal
+		{"ns.dns.example.com.", dns.TypeMX},          // synthesized nameserver
+		{"_http._tcp.app.example.com.", dns.TypeSRV}, // service not advertised
+	}
+	for _, tt := range tests {
+		m := queryZone(t, dc, tt.name, tt.qtype)
+		if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 {
+			t.Errorf("%s %s: expected NODATA, got %v", tt.name, dns.TypeToString[tt.qtype], m)
+		}
+		if !hasSOA(m, "example.com.") {
+			t.Errorf("%s %s: expected SOA in authority, got %v", tt.name, dns.TypeToString[tt.qtype], m.Ns)
+		}
+	}
+}
+
+func TestServeDNSNXDomainWithSOA(t *testing.T) {
+	dc := newZoneTestCluster()
+
+	m := queryZone(t, dc, "unknown.example.com.", dns.TypeA)
+	if m.Rcode != dns.RcodeNameError {
+		t.Errorf("expected NXDOMAIN, got %s", dns.RcodeToString[m.Rcode])
+	}
+	if !hasSOA(m, "example.com.") {
+		t.Errorf("expected SOA in authority, got %v", m.Ns)
+	}
+}
+
+func TestServeDNSOutOfZone(t *testing.T) {
+	dc := newZoneTestCluster()
+	dc.Records.Add("app.other.com", "10.0.0.3")
+
+	nextCalled := false
+	dc.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		nextCalled = true
+		return dns.RcodeSuccess, nil
+	})
+
+	req := new(dns.Msg)
+	req.SetQuestion("app.other.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !nextCalled {
+		t.Error("expected query outside the zones to go to the next plugin")
+	}
+}
+
+func TestServeDNSRootZone(t *testing.T) {
+	dc := newZoneTestCluster()
+	dc.Zones = nil
+
+	// No apex records are synthesized for the root zone
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeSOA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := dc.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Msg == nil || rec.Msg.Rcode != dns.RcodeNameError {
+		t.Errorf("expected NXDOMAIN for a name only other servers own, got %v", rec.Msg)
+	}
+
+	// Negative answers carry no SOA, as this server is not the root's authority
+	m := queryZone(t, dc, "app.example.com.", dns.TypeMX)
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 0 {
+		t.Errorf("expected NODATA without an SOA, got %v", m)
+	}
+	m = queryZone(t, dc, "unknown.example.com.", dns.TypeA)
+	if m.Rcode != dns.RcodeNameError || len(m.Ns) != 0 {
+		t.Errorf("expected NXDOMAIN without an SOA, got %v", m)
+	}
+}
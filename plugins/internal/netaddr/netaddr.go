@@ -0,0 +1,80 @@
+// Package netaddr parses and compares the host addresses the docker-cluster
+// and traefik-externals plugins answer with, and the reverse zones they answer
+// PTR queries in. It is copied into the CoreDNS
+// module tree next to both plugins, so its import path is
+// github.com/coredns/coredns/plugin/internal/netaddr.
+package netaddr
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+// ParseHostIPs splits host addresses into at most one IPv4 and one IPv6
+// address. Empty entries are skipped.
+func ParseHostIPs(addrs []string) (ipv4, ipv6 string, err error) {
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+			return "", "", fmt.Errorf("%q is not an IP address", addr)
+		case ip.To4() != nil:
+			if ipv4 != "" {
+				return "", "", fmt.Errorf("more than one IPv4 address: %s, %s", ipv4, addr)
+			}
+			ipv4 = addr
+		default:
+			if ipv6 != "" {
+				return "", "", fmt.Errorf("more than one IPv6 address: %s, %s", ipv6, addr)
+			}
+			ipv6 = addr
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// SameAddr reports whether a and b are the same IP address, regardless of
+// textual form (e.g. IPv6 zero compression). Empty addresses never match.
+func SameAddr(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	x, errA := netip.ParseAddr(a)
+	y, errB := netip.ParseAddr(b)
+	return errA == nil && errB == nil && x.Unmap() == y.Unmap()
+}
+
+// ParseReverseZones normalizes the zones PTR queries are answered in. Zones
+// may be given as names (16.172.in-addr.arpa) or CIDRs (172.16.0.0/16); with
+// no arguments every IPv4 and IPv6 address is covered.
+func ParseReverseZones(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"in-addr.arpa.", "ip6.arpa."}, nil
+	}
+	var zones []string
+	for _, arg := range args {
+		normalized := plugin.Host(arg).NormalizeExact()
+		if len(normalized) == 0 {
+			return nil, fmt.Errorf("%q is not a zone or CIDR", arg)
+		}
+		for _, z := range normalized {
+			if !dns.IsSubDomain("in-addr.arpa.", z) && !dns.IsSubDomain("ip6.arpa.", z) {
+				return nil, fmt.Errorf("%q is not a reverse zone", arg)
+			}
+			zones = append(zones, z)
+		}
+	}
+	return zones, nil
+}
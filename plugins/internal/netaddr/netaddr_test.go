@@ -0,0 +1,73 @@
+package netaddr
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseHostIPs(t *testing.T) {
+	tests := []struct {
+		addrs      []string
+		ipv4, ipv6 string
+		wantErr    bool
+	}{
+		{addrs: nil},
+		{addrs: []string{"192.168.1.100"}, ipv4: "192.168.1.100"},
+		{addrs: []string{" 192.168.1.100 ", "", "fd00::1"}, ipv4: "192.168.1.100", ipv6: "fd00::1"},
+		{addrs: []string{"not-an-ip"}, wantErr: true},
+		{addrs: []string{"192.168.1.100", "192.168.1.101"}, wantErr: true},
+		{addrs: []string{"fd00::1", "fd00::2"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		ipv4, ipv6, err := ParseHostIPs(tt.addrs)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: unexpected error %v", tt.addrs, err)
+			continue
+		}
+		if ipv4 != tt.ipv4 || ipv6 != tt.ipv6 {
+			t.Errorf("%q: expected %q, %q, got %q, %q", tt.addrs, tt.ipv4, tt.ipv6, ipv4, ipv6)
+		}
+	}
+}
+
+func TestSameAddr(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"192.168.1.100", "192.168.1.100", true},
+		{"fd00:0:0::1", "fd00::1", true},
+		{"::ffff:192.168.1.100", "192.168.1.100", true},
+		{"192.168.1.100", "192.168.1.101", false},
+		{"", "", false},
+		{"not-an-ip", "fd00::1", false},
+	}
+	for _, tt := range tests {
+		if got := SameAddr(tt.a, tt.b); got != tt.want {
+			t.Errorf("SameAddr(%q, %q): expected %t, got %t", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestParseReverseZones(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{args: nil, want: []string{"in-addr.arpa.", "ip6.arpa."}},
+		{args: []string{"16.172.in-addr.arpa"}, want: []string{"16.172.in-addr.arpa."}},
+		{args: []string{"172.16.0.0/16", "fd00::/8"}, want: []string{"16.172.in-addr.arpa.", "d.f.ip6.arpa."}},
+		{args: []string{"example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		zones, err := ParseReverseZones(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: unexpected error %v", tt.args, err)
+			continue
+		}
+		if !slices.Equal(zones, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.args, tt.want, zones)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package queryhits counts the queries the docker-cluster and
+// traefik-externals plugins answer from each record, so hostnames nothing
+// queries any more can be found. It is copied into the CoreDNS module tree
+// next to both plugins, so its import path is
+// github.com/coredns/coredns/plugin/internal/queryhits.
+package queryhits
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Count is the number of queries answered from a record and when the last
+// one was.
+type Count struct {
+	Queries uint64 `json:"queries"`
+	Last    int64  `json:"last"` // Unix nanoseconds, 0 if never queried
+}
+
+// Add merges other into c.
+func (c *Count) Add(other Count) {
+	c.Queries += other.Queries
+	c.Last = max(c.Last, other.Last)
+}
+
+// Unqueried reports whether the record was not queried within window of now;
+// a zero window means never queried.
+func (c Count) Unqueried(window time.Duration, now time.Time) bool {
+	if window == 0 {
+		return c.Queries == 0
+	}
+	return c.Last < now.Add(-window).UnixNano()
+}
+
+// counter is the live Count of a name.
+type counter struct {
+	queries atomic.Uint64
+	last    atomic.Int64
+}
+
+// Tracker counts queries by record name. Counting a name already seen is
+// lock-free, like record lookups. A name is counted until Forget drops it,
+// which the plugins do when its record is removed, so the names tracked
+// follow the records. The zero value is ready to use.
+type Tracker struct {
+	counts sync.Map // name -> *counter
+}
+
+// Record counts a query answered from the record name at now. A nil tracker
+// counts nothing.
+func (t *Tracker) Record(name string, now time.Time) {
+	if t == nil || name == "" {
+		return
+	}
+	c, ok := t.counts.Load(name)
+	if !ok {
+		c, _ = t.counts.LoadOrStore(name, &counter{})
+	}
+	counter := c.(*counter)
+	counter.queries.Add(1)
+	counter.last.Store(now.UnixNano())
+}
+
+// Count returns the count of name.
+func (t *Tracker) Count(name string) Count {
+	c, ok := t.counts.Load(name)
+	if !ok {
+		return Count{}
+	}
+	counter := c.(*counter)
+	return Count{Queries: counter.queries.Load(), Last: counter.last.Load()}
+}
+
+// Counts returns the counts of every name.
+func (t *Tracker) Counts() map[string]Count {
+	counts := make(map[string]Count)
+	t.counts.Range(func(name, c any) bool {
+		counter := c.(*counter)
+		counts[name.(string)] = Count{Queries: counter.queries.Load(), Last: counter.last.Load()}
+		return true
+	})
+	return counts
+}
+
+// Forget drops the counts of names, whose records were removed.
+func (t *Tracker) Forget(names ...string) {
+	for _, name := range names {
+		t.counts.Delete(name)
+	}
+}
+
+// Hit is a record's count, as the admin API lists it.
+type Hit struct {
+	Hostname string
+	Plugin   string // "docker-cluster" or "traefik-externals"
+	Count
+}
+
+// sources are the functions listing each plugin's records with their counts.
+var (
+	sourcesMu sync.Mutex
+	sources   []func() []Hit
+)
+
+// Register adds source, which lists the records a plugin serves with their
+// counts (zero if never queried), to those All lists. The plugins register
+// theirs when initialized.
+func Register(source func() []Hit) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources = append(sources, source)
+}
+
+// All returns the hits of every registered source, sorted by hostname.
+func All() []Hit {
+	sourcesMu.Lock()
+	registered := sources
+	sourcesMu.Unlock()
+
+	hits := []Hit{}
+	for _, source := range registered {
+		hits = append(hits, source()...)
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Hostname < hits[j].Hostname })
+	return hits
+}
+
+// NewUnqueriedGauges registers the hostnames_unqueried gauges of a plugin's
+// metrics subsystem: by window, the records of source not queried within it,
+// and for "never" those never queried since startup. The windows are fixed,
+// so the cardinality does not grow with the records.
+func NewUnqueriedGauges(subsystem, help string, source func() []Hit) map[string]prometheus.GaugeFunc {
+	gauges := make(map[string]prometheus.GaugeFunc)
+	for _, w := range []struct {
+		label  string
+		window time.Duration
+	}{
+		{"1h", time.Hour},
+		{"24h", 24 * time.Hour},
+		{"7d", 7 * 24 * time.Hour},
+		{"never", 0},
+	} {
+		gauges[w.label] = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   plugin.Namespace,
+			Subsystem:   subsystem,
+			Name:        "hostnames_unqueried",
+			Help:        help,
+			ConstLabels: prometheus.Labels{"window": w.label},
+		}, func() float64 {
+			n, now := 0, time.Now()
+			for _, h := range source() {
+				if h.Unqueried(w.window, now) {
+					n++
+				}
+			}
+			return float64(n)
+		})
+	}
+	return gauges
+}
@@ -0,0 +1,63 @@
+package queryhits
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	var tracker Tracker
+	now := time.Now()
+	tracker.Record("app.example.com", now.Add(-time.Minute))
+	tracker.Record("app.example.com", now)
+	tracker.Record("db.example.com", now)
+	tracker.Record("", now)
+
+	if got := tracker.Count("app.example.com"); got != (Count{Queries: 2, Last: now.UnixNano()}) {
+		t.Errorf("unexpected count %+v", got)
+	}
+	if counts := tracker.Counts(); len(counts) != 2 {
+		t.Errorf("expected 2 names, got %+v", counts)
+	}
+
+	tracker.Forget("db.example.com")
+	if got := tracker.Count("db.example.com"); got != (Count{}) {
+		t.Errorf("expected the forgotten name to have no count, got %+v", got)
+	}
+
+	var none *Tracker
+	none.Record("app.example.com", now)
+}
+
+func TestCountUnqueried(t *testing.T) {
+	now := time.Now()
+	recent := Count{Queries: 1, Last: now.Add(-time.Minute).UnixNano()}
+	old := Count{Queries: 1, Last: now.Add(-2 * time.Hour).UnixNano()}
+
+	tests := []struct {
+		count  Count
+		window time.Duration
+		want   bool
+	}{
+		{Count{}, 0, true},
+		{recent, 0, false},
+		{recent, time.Hour, false},
+		{old, time.Hour, true},
+		{Count{}, time.Hour, true},
+	}
+	for _, tt := range tests {
+		if got := tt.count.Unqueried(tt.window, now); got != tt.want {
+			t.Errorf("%+v within %s: expected %t, got %t", tt.count, tt.window, tt.want, got)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	Register(func() []Hit { return []Hit{{Hostname: "web.example.com", Plugin: "b"}} })
+	Register(func() []Hit { return []Hit{{Hostname: "app.example.com", Plugin: "a"}} })
+
+	hits := All()
+	if len(hits) != 2 || hits[0].Hostname != "app.example.com" || hits[1].Plugin != "b" {
+		t.Errorf("expected the hits of every source sorted by hostname, got %+v", hits)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/log"
@@ -15,6 +16,7 @@ import (
 type FileWatcher struct {
 	directory string
 	hostIP    string
+	hostIPv6  string
 	records   *Records
 	parser    *Parser
 
@@ -25,6 +27,9 @@ type FileWatcher struct {
 	mu      sync.RWMutex
 	running bool
 
+	// loaded is set once the directory was loaded successfully
+	loaded atomic.Bool
+
 	// debounce prevents rapid reloads on multiple file changes
 	debounceTimer *time.Timer
 	debounceMu    sync.Mutex
@@ -165,7 +170,8 @@ func (fw *FileWatcher) loadAllConfigs() error {
 		return err
 	}
 
-	allHosts := make(map[string]string)
+	allHosts := make(map[string]Addrs)
+	addrs := Addrs{IPv4: fw.hostIP, IPv6: fw.hostIPv6}
 
 	for _, entry := range entries {
 		if entry.IsDir() {
@@ -204,7 +210,7 @@ func (fw *FileWatcher) loadAllConfigs() error {
 		}
 
 		for _, host := range hosts {
-			allHosts[host] = fw.hostIP
+			allHosts[host] = addrs
 		}
 	}
 
@@ -225,9 +231,15 @@ func (fw *FileWatcher) loadAllConfigs() error {
 		log.Info("traefik-externals: no hostnames found in external configs")
 	}
 
+	fw.loaded.Store(true)
 	return nil
 }
 
+// Loaded reports whether the directory was loaded successfully at least once.
+func (fw *FileWatcher) Loaded() bool {
+	return fw.loaded.Load()
+}
+
 // GetDirectory returns the watched directory path.
 func (fw *FileWatcher) GetDirectory() string {
 	return fw.directory
@@ -0,0 +1,51 @@
+package traefikexternals
+
+import (
+	"sync"
+
+	"github.com/coredns/coredns/plugin/internal/queryhits"
+)
+
+func init() {
+	queryhits.Register(hostnameHits)
+}
+
+// queryHits counts the queries answered for each hostname, for every
+// instance. The hostnames no instance serves any more are forgotten.
+var queryHits queryhits.Tracker
+
+// instances are the running instances, whose hostnames hostnameHits lists.
+var instances sync.Map // *TraefikExternals -> struct{}
+
+// hostnameHits lists the hostnames the running instances serve with their
+// counts. Hostnames never queried have a zero count.
+func hostnameHits() []queryhits.Hit {
+	hostnames := make(map[string]bool)
+	instances.Range(func(te, _ any) bool {
+		for hostname := range te.(*TraefikExternals).Records.GetAll() {
+			hostnames[hostname] = true
+		}
+		return true
+	})
+
+	hits := make([]queryhits.Hit, 0, len(hostnames))
+	for hostname := range hostnames {
+		hits = append(hits, queryhits.Hit{Hostname: hostname, Plugin: "traefik-externals", Count: queryHits.Count(hostname)})
+	}
+	return hits
+}
+
+// forgetHits drops the counts of removed hostnames no running instance
+// serves any more.
+func forgetHits(hostnames []string) {
+	for _, hostname := range hostnames {
+		served := false
+		instances.Range(func(te, _ any) bool {
+			_, served = te.(*TraefikExternals).Records.LookupAddrs(hostname)
+			return !served
+		})
+		if !served {
+			queryHits.Forget(hostname)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package traefikexternals
 
 import (
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/internal/queryhits"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -40,3 +41,8 @@ var (
 		Help:      "Total number of DNS queries handled by traefik-externals.",
 	}, []string{"type", "result"})
 )
+
+// hostnamesUnqueried reports, by window, the hostnames not queried within
+// it (see queryhits.NewUnqueriedGauges).
+var hostnamesUnqueried = queryhits.NewUnqueriedGauges("traefik_externals",
+	"Number of hostnames not queried within the window, or never queried since startup.", hostnameHits)
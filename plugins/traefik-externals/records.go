@@ -1,44 +1,69 @@
 package traefikexternals
 
 import (
+	"net"
+	"net/netip"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+
+	"github.com/coredns/coredns/plugin/internal/netaddr"
 )
 
+// Addrs holds the addresses a hostname resolves to, one per address family.
+type Addrs struct {
+	IPv4 string
+	IPv6 string
+}
+
 // Records provides thread-safe storage for DNS hostname-to-IP mappings.
 // It uses atomic.Value for lock-free reads on the hot path (DNS queries),
 // with copy-on-write semantics for updates.
 type Records struct {
 	// data holds the current immutable snapshot of records.
 	// Read operations access this atomically without locks.
-	data atomic.Value // holds map[string]string
+	data atomic.Value // holds map[string]Addrs
 
 	// mu protects write operations to ensure atomic copy-on-write updates.
 	mu sync.Mutex
+
+	// onRemove is called with the hostnames removed by a write (see OnRemove).
+	onRemove func(hostnames []string)
 }
 
 // NewRecords creates a new empty Records store.
 func NewRecords() *Records {
 	r := &Records{}
-	r.data.Store(make(map[string]string))
+	r.data.Store(make(map[string]Addrs))
 	return r
 }
 
-// Add adds or updates a DNS record mapping hostname to ip.
+// Add adds or updates a DNS record mapping hostname to a single ip.
+// IPv6 addresses are stored as the AAAA address, anything else as the A address.
 // The hostname is normalized to lowercase.
 func (r *Records) Add(hostname, ip string) {
+	addrs := Addrs{IPv4: ip}
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		addrs = Addrs{IPv6: ip}
+	}
+	r.AddAddrs(hostname, addrs)
+}
+
+// AddAddrs adds or updates a DNS record mapping hostname to addrs.
+// The hostname is normalized to lowercase.
+func (r *Records) AddAddrs(hostname string, addrs Addrs) {
 	hostname = strings.ToLower(hostname)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	current := r.data.Load().(map[string]string)
-	newData := make(map[string]string, len(current)+1)
+	current := r.data.Load().(map[string]Addrs)
+	newData := make(map[string]Addrs, len(current)+1)
 	for k, v := range current {
 		newData[k] = v
 	}
-	newData[hostname] = ip
+	newData[hostname] = addrs
 	r.data.Store(newData)
 }
 
@@ -49,55 +74,112 @@ func (r *Records) Remove(hostname string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	current := r.data.Load().(map[string]string)
+	current := r.data.Load().(map[string]Addrs)
 	if _, exists := current[hostname]; !exists {
 		return
 	}
 
-	newData := make(map[string]string, len(current)-1)
+	newData := make(map[string]Addrs, len(current)-1)
 	for k, v := range current {
 		if k != hostname {
 			newData[k] = v
 		}
 	}
 	r.data.Store(newData)
+	if r.onRemove != nil {
+		r.onRemove([]string{hostname})
+	}
 }
 
-// Lookup retrieves the IP address for a hostname.
+// OnRemove sets fn to be called with the hostnames removed by each Remove or
+// ReplaceAll removing some. fn runs with the write lock held, so it must not
+// write to the store.
+func (r *Records) OnRemove(fn func(hostnames []string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onRemove = fn
+}
+
+// removed passes the hostnames of current missing from data to onRemove.
+// Callers hold r.mu.
+func (r *Records) removed(current, data map[string]Addrs) {
+	if r.onRemove == nil {
+		return
+	}
+	var hostnames []string
+	for hostname := range current {
+		if _, ok := data[hostname]; !ok {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	if len(hostnames) > 0 {
+		r.onRemove(hostnames)
+	}
+}
+
+// Lookup retrieves the IPv4 address for a hostname.
+// An IPv6-only hostname is found with an empty IP; use LookupAddrs for both families.
 // This is a lock-free operation optimized for the DNS query hot path.
 func (r *Records) Lookup(hostname string) (ip string, found bool) {
+	addrs, found := r.LookupAddrs(hostname)
+	return addrs.IPv4, found
+}
+
+// LookupAddrs retrieves the IPv4 and IPv6 addresses for a hostname.
+// This is a lock-free operation optimized for the DNS query hot path.
+func (r *Records) LookupAddrs(hostname string) (addrs Addrs, found bool) {
 	hostname = strings.ToLower(hostname)
-	current := r.data.Load().(map[string]string)
-	ip, found = current[hostname]
+	current := r.data.Load().(map[string]Addrs)
+	addrs, found = current[hostname]
 	return
 }
 
-// GetAll returns a copy of all current DNS records.
+// LookupAddr returns the hostnames that resolve to ip (IPv4 or IPv6), sorted.
+// Returns nil if ip is not a valid address or nothing resolves to it.
+func (r *Records) LookupAddr(ip string) []string {
+	if _, err := netip.ParseAddr(ip); err != nil {
+		return nil
+	}
+
+	var names []string
+	for hostname, addrs := range r.data.Load().(map[string]Addrs) {
+		if netaddr.SameAddr(addrs.IPv4, ip) || netaddr.SameAddr(addrs.IPv6, ip) {
+			names = append(names, hostname)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetAll returns a copy of all current DNS records as hostname -> IPv4 address
+// (empty for IPv6-only records).
 func (r *Records) GetAll() map[string]string {
-	current := r.data.Load().(map[string]string)
+	current := r.data.Load().(map[string]Addrs)
 	result := make(map[string]string, len(current))
 	for k, v := range current {
-		result[k] = v
+		result[k] = v.IPv4
 	}
 	return result
 }
 
 // Count returns the number of DNS records currently stored.
 func (r *Records) Count() int {
-	current := r.data.Load().(map[string]string)
+	current := r.data.Load().(map[string]Addrs)
 	return len(current)
 }
 
 // ReplaceAll atomically replaces all records with the new set.
 // This is used when reloading all external configs.
-func (r *Records) ReplaceAll(newRecords map[string]string) {
+func (r *Records) ReplaceAll(newRecords map[string]Addrs) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	// Normalize all keys to lowercase
-	normalized := make(map[string]string, len(newRecords))
+	normalized := make(map[string]Addrs, len(newRecords))
 	for k, v := range newRecords {
 		normalized[strings.ToLower(k)] = v
 	}
+	current := r.data.Load().(map[string]Addrs)
 	r.data.Store(normalized)
+	r.removed(current, normalized)
 }
@@ -119,9 +119,9 @@ func TestRecords_ReplaceAll(t *testing.T) {
 	r.Add("keep.example.com", "192.168.1.2")
 
 	// Replace all
-	newRecords := map[string]string{
-		"new.example.com":  "192.168.1.10",
-		"keep.example.com": "192.168.1.20", // Updated IP
+	newRecords := map[string]Addrs{
+		"new.example.com":  {IPv4: "192.168.1.10"},
+		"keep.example.com": {IPv4: "192.168.1.20"}, // Updated IP
 	}
 	r.ReplaceAll(newRecords)
 
@@ -151,9 +151,9 @@ func TestRecords_ReplaceAll(t *testing.T) {
 func TestRecords_ReplaceAllNormalizesCase(t *testing.T) {
 	r := NewRecords()
 
-	newRecords := map[string]string{
-		"UPPERCASE.EXAMPLE.COM": "192.168.1.1",
-		"MixedCase.Example.Com": "192.168.1.2",
+	newRecords := map[string]Addrs{
+		"UPPERCASE.EXAMPLE.COM": {IPv4: "192.168.1.1"},
+		"MixedCase.Example.Com": {IPv4: "192.168.1.2"},
 	}
 	r.ReplaceAll(newRecords)
 
@@ -2,16 +2,19 @@ package traefikexternals
 
 import (
 	"context"
-	"net"
+	"maps"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/internal/netaddr"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/miekg/dns"
 )
 
 func init() {
@@ -39,17 +42,25 @@ func setup(c *caddy.Controller) error {
 	}
 
 	// Log configuration at startup
-	log.Infof("traefik-externals: directory=%s host_ip=%s ttl=%d",
-		te.Watcher.directory, te.Watcher.hostIP, te.TTL)
-
-	// Start the file watcher
-	if err := te.Watcher.Start(context.Background()); err != nil {
-		return plugin.Error("traefik-externals", err)
-	}
+	log.Infof("traefik-externals: directory=%s host_ip=%s host_ipv6=%s ttl=%d reverse=%v",
+		te.Watcher.directory, te.Watcher.hostIP, te.Watcher.hostIPv6, te.TTL, te.ReverseZones)
+
+	// Start the file watcher on startup: on a reload the new instance is set
+	// up while the old one still runs
+	c.OnStartup(func() error {
+		te.Records.OnRemove(forgetHits)
+		if err := te.Watcher.Start(context.Background()); err != nil {
+			return plugin.Error("traefik-externals", err)
+		}
+		instances.Store(te, struct{}{})
+		return nil
+	})
 
 	// Register shutdown handler
 	c.OnShutdown(func() error {
+		instances.Delete(te)
 		te.Watcher.Stop()
+		forgetHits(slices.Collect(maps.Keys(te.Records.GetAll())))
 		return nil
 	})
 
@@ -65,8 +76,12 @@ func parseConfig(c *caddy.Controller) (*TraefikExternals, error) {
 	var (
 		directory = "/etc/traefik/external-enabled"
 		hostIP    string
+		hostIPv6  string
 		ttl       uint32 = 60
 		f         fall.F
+		aaaaMode  = AAAAAnswer
+		reverse   []string
+		canonical string
 	)
 
 	for c.Next() {
@@ -82,10 +97,15 @@ func parseConfig(c *caddy.Controller) (*TraefikExternals, error) {
 				directory = c.Val()
 
 			case "host_ip":
-				if !c.NextArg() {
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
 					return nil, c.ArgErr()
 				}
-				hostIP = c.Val()
+				v4, v6, err := netaddr.ParseHostIPs(args)
+				if err != nil {
+					return nil, c.Errf("invalid host_ip: %v", err)
+				}
+				hostIP, hostIPv6 = v4, v6
 
 			case "ttl":
 				if !c.NextArg() {
@@ -100,6 +120,35 @@ func parseConfig(c *caddy.Controller) (*TraefikExternals, error) {
 			case "fallthrough":
 				f.SetZonesFromArgs(c.RemainingArgs())
 
+			case "reverse":
+				zones, err := netaddr.ParseReverseZones(c.RemainingArgs())
+				if err != nil {
+					return nil, c.Errf("invalid reverse: %v", err)
+				}
+				reverse = zones
+
+			case "reverse_canonical":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if _, ok := dns.IsDomainName(c.Val()); !ok || strings.ContainsAny(c.Val(), " *") {
+					return nil, c.Errf("invalid reverse_canonical: %s", c.Val())
+				}
+				canonical = strings.ToLower(c.Val())
+
+			case "aaaa":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch strings.ToLower(c.Val()) {
+				case "answer":
+					aaaaMode = AAAAAnswer
+				case "empty":
+					aaaaMode = AAAAEmpty
+				default:
+					return nil, c.Errf("invalid aaaa: %s (valid: answer, empty)", c.Val())
+				}
+
 			default:
 				return nil, c.Errf("unknown property '%s'", c.Val())
 			}
@@ -110,8 +159,18 @@ func parseConfig(c *caddy.Controller) (*TraefikExternals, error) {
 	if envDir := os.Getenv("TRAEFIK_EXTERNALS_DIRECTORY"); envDir != "" {
 		directory = envDir
 	}
+	// HOSTIP may list one address per family; each overrides only its own family
 	if envHostIP := os.Getenv("HOSTIP"); envHostIP != "" {
-		hostIP = envHostIP
+		v4, v6, err := netaddr.ParseHostIPs(strings.Split(envHostIP, ","))
+		if err != nil {
+			return nil, c.Errf("invalid host_ip: %v", err)
+		}
+		if v4 != "" {
+			hostIP = v4
+		}
+		if v6 != "" {
+			hostIPv6 = v6
+		}
 	}
 	if envTTL := os.Getenv("TRAEFIK_EXTERNALS_TTL"); envTTL != "" {
 		parsed, err := strconv.ParseUint(envTTL, 10, 32)
@@ -120,27 +179,27 @@ func parseConfig(c *caddy.Controller) (*TraefikExternals, error) {
 		}
 	}
 
-	// Validate required fields
-	if hostIP == "" {
+	// Validate required fields; ParseHostIPs already rejected invalid addresses
+	if hostIP == "" && hostIPv6 == "" {
 		return nil, c.Err("host_ip is required (set in config or HOSTIP env var)")
 	}
 
-	// Validate IP format (Phase 1.2: prevent panic on invalid IP)
-	if net.ParseIP(hostIP) == nil {
-		return nil, c.Errf("invalid host_ip: %s", hostIP)
-	}
-
 	// Create shared records store
 	records := NewRecords()
 
 	// Create file watcher
 	watcher := NewFileWatcher(directory, hostIP, records)
+	watcher.hostIPv6 = hostIPv6
 
 	te := &TraefikExternals{
-		Records: records,
-		Watcher: watcher,
-		TTL:     ttl,
-		Fall:    f,
+		Records:  records,
+		Watcher:  watcher,
+		TTL:      ttl,
+		Fall:     f,
+		AAAAMode: aaaaMode,
+
+		ReverseZones:     reverse,
+		ReverseCanonical: canonical,
 	}
 
 	return te, nil
@@ -256,3 +256,85 @@ func TestSetup_ValidDirectory_StartsWatcher(t *testing.T) {
 		t.Errorf("setup() should succeed with valid directory, got: %v", err)
 	}
 }
+
+func TestSetup_DualStackHostIP(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	input := `traefik-externals {
+		directory ` + tmpDir + `
+		host_ip 192.168.1.100 2001:db8::100
+		aaaa empty
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	te, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if te.Watcher.hostIP != "192.168.1.100" {
+		t.Errorf("expected host IPv4 192.168.1.100, got %s", te.Watcher.hostIP)
+	}
+	if te.Watcher.hostIPv6 != "2001:db8::100" {
+		t.Errorf("expected host IPv6 2001:db8::100, got %s", te.Watcher.hostIPv6)
+	}
+	if te.AAAAMode != AAAAEmpty {
+		t.Errorf("expected AAAAEmpty, got %d", te.AAAAMode)
+	}
+}
+
+func TestSetup_HOSTIPEnvDualStack(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Setenv("HOSTIP", "10.0.0.1,fd00::1")
+
+	input := `traefik-externals {
+		directory ` + tmpDir + `
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	te, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if te.Watcher.hostIP != "10.0.0.1" || te.Watcher.hostIPv6 != "fd00::1" {
+		t.Errorf("expected 10.0.0.1/fd00::1, got %s/%s", te.Watcher.hostIP, te.Watcher.hostIPv6)
+	}
+}
+
+func TestSetup_InvalidAAAAMode(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	input := `traefik-externals {
+		directory ` + tmpDir + `
+		host_ip 192.168.1.100
+		aaaa sometimes
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for invalid aaaa mode, got nil")
+	}
+}
+
+func TestSetup_Reverse(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	input := `traefik-externals {
+		directory ` + tmpDir + `
+		host_ip 192.168.1.100
+		reverse 192.168.0.0/16
+		reverse_canonical traefik.example.com
+	}`
+
+	c := caddy.NewTestController("dns", input)
+	te, err := parseConfig(c)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if len(te.ReverseZones) != 1 || te.ReverseZones[0] != "168.192.in-addr.arpa." {
+		t.Errorf("expected reverse zone 168.192.in-addr.arpa., got %v", te.ReverseZones)
+	}
+	if te.ReverseCanonical != "traefik.example.com" {
+		t.Errorf("expected canonical traefik.example.com, got %s", te.ReverseCanonical)
+	}
+}
@@ -6,21 +6,40 @@ import (
 	"context"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/internal/netaddr"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
 )
 
+// AAAAMode defines how AAAA queries for known hostnames are answered.
+type AAAAMode int
+
+const (
+	// AAAAAnswer - return the hostname's IPv6 address (empty NOERROR if it has none)
+	AAAAAnswer AAAAMode = iota
+	// AAAAEmpty - always return an empty NOERROR so dual-stack clients fall back to IPv4
+	AAAAEmpty
+)
+
 // TraefikExternals implements the plugin.Handler interface for Traefik external service DNS resolution.
 type TraefikExternals struct {
-	Records *Records
-	Watcher *FileWatcher
-	TTL     uint32
-	Fall    fall.F
-	Next    plugin.Handler
+	Records  *Records
+	Watcher  *FileWatcher
+	TTL      uint32
+	Fall     fall.F
+	AAAAMode AAAAMode
+	Next     plugin.Handler
+
+	// ReverseZones enables PTR answers for queries inside these zones (nil disables them).
+	ReverseZones []string
+	// ReverseCanonical, if set, is the only name returned for PTR queries of the host IP.
+	ReverseCanonical string
 }
 
 // Name returns the plugin name.
@@ -28,6 +47,12 @@ func (te *TraefikExternals) Name() string {
 	return "traefik-externals"
 }
 
+// Ready implements the ready.Readiness interface: the plugin is ready once
+// the external configs were loaded.
+func (te *TraefikExternals) Ready() bool {
+	return te.Watcher != nil && te.Watcher.Loaded()
+}
+
 // ServeDNS implements the plugin.Handler interface.
 func (te *TraefikExternals) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 	state := request.Request{W: w, Req: r}
@@ -36,21 +61,39 @@ func (te *TraefikExternals) ServeDNS(ctx context.Context, w dns.ResponseWriter,
 	qname := strings.ToLower(state.Name())
 	qname = strings.TrimSuffix(qname, ".")
 
+	// Reverse lookups are answered from the same records
+	if state.QType() == dns.TypePTR && plugin.Zones(te.ReverseZones).Matches(qname+".") != "" {
+		return te.servePTR(ctx, w, r, state)
+	}
+
 	// Check if we know this hostname
-	ip, found := te.Records.Lookup(qname)
+	addrs, found := te.Records.LookupAddrs(qname)
+	if found {
+		queryHits.Record(qname, time.Now())
+	}
 
 	// Handle AAAA queries for known hostnames
-	// Return empty authoritative response so dual-stack clients don't wait
+	// Return an empty authoritative response when IPv6 answers are disabled or
+	// the hostname has no IPv6 address, so dual-stack clients don't wait
 	if state.QType() == dns.TypeAAAA && found {
-		m := new(dns.Msg)
-		m.SetReply(r)
-		m.Authoritative = true
-		if err := w.WriteMsg(m); err != nil {
-			log.Errorf("traefik-externals: failed to write AAAA response: %v", err)
-			return dns.RcodeServerFailure, err
+		if te.AAAAMode == AAAAEmpty || addrs.IPv6 == "" {
+			return te.writeNoData(w, r, "AAAA")
 		}
-		queriesTotal.WithLabelValues("AAAA", "success").Inc()
-		return dns.RcodeSuccess, nil
+		parsedIP := net.ParseIP(addrs.IPv6)
+		if parsedIP == nil || parsedIP.To4() != nil {
+			log.Warningf("traefik-externals: invalid IPv6 address %q for hostname %s, treating as not found", addrs.IPv6, qname)
+			queriesTotal.WithLabelValues("AAAA", "miss").Inc()
+			return dns.RcodeSuccess, nil
+		}
+		return te.writeAnswer(w, r, &dns.AAAA{
+			Hdr: dns.RR_Header{
+				Name:   state.QName(),
+				Rrtype: dns.TypeAAAA,
+				Class:  dns.ClassINET,
+				Ttl:    te.TTL,
+			},
+			AAAA: parsedIP,
+		})
 	}
 
 	// Only handle A record queries
@@ -71,16 +114,21 @@ func (te *TraefikExternals) ServeDNS(ctx context.Context, w dns.ResponseWriter,
 		return dns.RcodeSuccess, nil
 	}
 
+	// IPv6-only hostname: it exists, but has no A record
+	if addrs.IPv4 == "" {
+		return te.writeNoData(w, r, "A")
+	}
+
 	// Validate the IP address before building response
-	parsedIP := net.ParseIP(ip)
+	parsedIP := net.ParseIP(addrs.IPv4)
 	if parsedIP == nil || parsedIP.To4() == nil {
-		log.Warningf("traefik-externals: invalid IPv4 address %q for hostname %s, treating as not found", ip, qname)
+		log.Warningf("traefik-externals: invalid IPv4 address %q for hostname %s, treating as not found", addrs.IPv4, qname)
 		queriesTotal.WithLabelValues("A", "miss").Inc()
 		return dns.RcodeSuccess, nil
 	}
 
 	// Build the response
-	a := &dns.A{
+	return te.writeAnswer(w, r, &dns.A{
 		Hdr: dns.RR_Header{
 			Name:   state.QName(),
 			Rrtype: dns.TypeA,
@@ -88,17 +136,76 @@ func (te *TraefikExternals) ServeDNS(ctx context.Context, w dns.ResponseWriter,
 			Ttl:    te.TTL,
 		},
 		A: parsedIP.To4(),
+	})
+}
+
+// servePTR answers a reverse lookup with every hostname that resolves to the address.
+func (te *TraefikExternals) servePTR(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request) (int, error) {
+	ip := dnsutil.ExtractAddressFromReverse(strings.ToLower(state.Name()))
+	names := te.Records.LookupAddr(ip)
+	if len(names) == 0 {
+		queriesTotal.WithLabelValues("PTR", "miss").Inc()
+		if te.Fall.Through(state.Name()) {
+			return plugin.NextOrFailure(te.Name(), te.Next, ctx, w, r)
+		}
+		log.Debugf("traefik-externals: no hostname for %s, dropping query", state.Name())
+		return dns.RcodeSuccess, nil
+	}
+
+	// Every external service shares the host IP; answer with one name
+	if te.ReverseCanonical != "" && te.Watcher != nil && (netaddr.SameAddr(ip, te.Watcher.hostIP) || netaddr.SameAddr(ip, te.Watcher.hostIPv6)) {
+		names = []string{te.ReverseCanonical}
 	}
 
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Authoritative = true
-	m.Answer = append(m.Answer, a)
+	for _, name := range names {
+		m.Answer = append(m.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   state.QName(),
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    te.TTL,
+			},
+			Ptr: dns.Fqdn(name),
+		})
+	}
 
 	if err := w.WriteMsg(m); err != nil {
-		log.Errorf("traefik-externals: failed to write A response: %v", err)
+		log.Errorf("traefik-externals: failed to write PTR response: %v", err)
+		return dns.RcodeServerFailure, err
+	}
+	queriesTotal.WithLabelValues("PTR", "success").Inc()
+	return dns.RcodeSuccess, nil
+}
+
+// writeAnswer writes an authoritative response containing rr.
+func (te *TraefikExternals) writeAnswer(w dns.ResponseWriter, r *dns.Msg, rr dns.RR) (int, error) {
+	qtype := dns.TypeToString[rr.Header().Rrtype]
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.Answer = append(m.Answer, rr)
+
+	if err := w.WriteMsg(m); err != nil {
+		log.Errorf("traefik-externals: failed to write %s response: %v", qtype, err)
+		return dns.RcodeServerFailure, err
+	}
+	queriesTotal.WithLabelValues(qtype, "success").Inc()
+	return dns.RcodeSuccess, nil
+}
+
+// writeNoData writes an empty authoritative response for a known hostname.
+func (te *TraefikExternals) writeNoData(w dns.ResponseWriter, r *dns.Msg, qtype string) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	if err := w.WriteMsg(m); err != nil {
+		log.Errorf("traefik-externals: failed to write %s response: %v", qtype, err)
 		return dns.RcodeServerFailure, err
 	}
-	queriesTotal.WithLabelValues("A", "success").Inc()
+	queriesTotal.WithLabelValues(qtype, "success").Inc()
 	return dns.RcodeSuccess, nil
 }
@@ -2,9 +2,12 @@ package traefikexternals
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/internal/queryhits"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/plugin/test"
@@ -18,6 +21,28 @@ func TestTraefikExternals_Name(t *testing.T) {
 	}
 }
 
+func TestTraefikExternals_Ready(t *testing.T) {
+	tmpDir := t.TempDir()
+	te := &TraefikExternals{Watcher: NewFileWatcher(filepath.Join(tmpDir, "missing"), "192.168.1.10", NewRecords())}
+	if te.Ready() {
+		t.Error("expected not ready before the directory was loaded")
+	}
+	if err := te.Watcher.loadAllConfigs(); err == nil {
+		t.Fatal("expected loading a missing directory to fail")
+	}
+	if te.Ready() {
+		t.Error("expected not ready after a failed load")
+	}
+
+	te.Watcher.directory = tmpDir
+	if err := te.Watcher.loadAllConfigs(); err != nil {
+		t.Fatalf("loadAllConfigs failed: %v", err)
+	}
+	if !te.Ready() {
+		t.Error("expected ready after the directory was loaded")
+	}
+}
+
 func TestRecords_Integration(t *testing.T) {
 	records := NewRecords()
 
@@ -40,9 +65,9 @@ func TestRecords_Integration(t *testing.T) {
 	}
 
 	// Test ReplaceAll
-	records.ReplaceAll(map[string]string{
-		"new.example.com": "10.0.0.1",
-		"api.example.com": "10.0.0.2",
+	records.ReplaceAll(map[string]Addrs{
+		"new.example.com": {IPv4: "10.0.0.1"},
+		"api.example.com": {IPv4: "10.0.0.2"},
 	})
 
 	if records.Count() != 2 {
@@ -60,6 +85,39 @@ func TestRecords_Integration(t *testing.T) {
 	}
 }
 
+func TestServeDNS_QueryHits(t *testing.T) {
+	records := NewRecords()
+	records.Add("hits-busy.example.com", "192.168.1.100")
+	records.Add("hits-idle.example.com", "192.168.1.100")
+	records.OnRemove(forgetHits)
+	te := &TraefikExternals{Records: records, TTL: 60}
+	instances.Store(te, struct{}{})
+	defer instances.Delete(te)
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		req := new(dns.Msg)
+		req.SetQuestion("HITS-busy.example.com.", qtype)
+		te.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	}
+
+	hits := map[string]queryhits.Hit{}
+	for _, h := range hostnameHits() {
+		hits[h.Hostname] = h
+	}
+	if busy := hits["hits-busy.example.com"]; len(hits) != 2 || busy.Queries != 2 || busy.Last == 0 || busy.Plugin != "traefik-externals" {
+		t.Fatalf("unexpected hits %+v", hits)
+	}
+	if idle := hits["hits-idle.example.com"]; idle.Queries != 0 || !idle.Unqueried(0, time.Now()) {
+		t.Errorf("expected the unqueried hostname with a zero count, got %+v", idle)
+	}
+
+	// The counts of removed hostnames are forgotten
+	records.ReplaceAll(map[string]Addrs{"hits-idle.example.com": {IPv4: "192.168.1.100"}})
+	if count := queryHits.Count("hits-busy.example.com"); count.Queries != 0 {
+		t.Errorf("expected the removed hostname's count to be forgotten, got %+v", count)
+	}
+}
+
 // TestServeDNS_UnknownWithoutFallthrough verifies that when fallthrough is NOT
 // configured, unknown hostnames are dropped (no response) rather than passed
 // to the next plugin.
@@ -165,3 +223,104 @@ func TestServeDNS_KnownHostname(t *testing.T) {
 		t.Errorf("expected 192.168.1.100, got %s", a.A.String())
 	}
 }
+
+func TestServeDNS_AAAAAnswer(t *testing.T) {
+	records := NewRecords()
+	records.AddAddrs("web.example.com", Addrs{IPv4: "192.168.1.100", IPv6: "2001:db8::100"})
+
+	te := &TraefikExternals{
+		Records: records,
+		TTL:     60,
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("web.example.com.", dns.TypeAAAA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := te.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.Msg.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %d", len(rec.Msg.Answer))
+	}
+	aaaa, ok := rec.Msg.Answer[0].(*dns.AAAA)
+	if !ok {
+		t.Fatal("expected AAAA record")
+	}
+	if aaaa.AAAA.String() != "2001:db8::100" {
+		t.Errorf("expected 2001:db8::100, got %s", aaaa.AAAA.String())
+	}
+
+	// Empty mode keeps the old NOERROR/NODATA behaviour
+	te.AAAAMode = AAAAEmpty
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := te.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeSuccess || len(rec.Msg.Answer) != 0 {
+		t.Errorf("expected empty NOERROR in empty mode, got rcode %d with %d answers", rec.Msg.Rcode, len(rec.Msg.Answer))
+	}
+}
+
+func TestServeDNS_AForIPv6OnlyHostname(t *testing.T) {
+	records := NewRecords()
+	records.Add("v6.example.com", "2001:db8::1")
+
+	te := &TraefikExternals{
+		Records: records,
+		TTL:     60,
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("v6.example.com.", dns.TypeA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := te.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Msg == nil {
+		t.Fatal("expected an empty response, got none")
+	}
+	if rec.Msg.Rcode != dns.RcodeSuccess || len(rec.Msg.Answer) != 0 {
+		t.Errorf("expected NODATA, got rcode %d with %d answers", rec.Msg.Rcode, len(rec.Msg.Answer))
+	}
+}
+
+func TestServeDNS_PTR(t *testing.T) {
+	records := NewRecords()
+	records.Add("proxmox.example.com", "192.168.1.100")
+	records.Add("nas.example.com", "192.168.1.100")
+
+	te := &TraefikExternals{
+		Records:      records,
+		Watcher:      &FileWatcher{hostIP: "192.168.1.100"},
+		TTL:          60,
+		ReverseZones: []string{"in-addr.arpa.", "ip6.arpa."},
+	}
+
+	query := func() []string {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion("100.1.168.192.in-addr.arpa.", dns.TypePTR)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := te.ServeDNS(context.Background(), rec, req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var names []string
+		for _, rr := range rec.Msg.Answer {
+			names = append(names, rr.(*dns.PTR).Ptr)
+		}
+		return names
+	}
+
+	names := query()
+	if len(names) != 2 || names[0] != "nas.example.com." || names[1] != "proxmox.example.com." {
+		t.Errorf("expected both hostnames, got %v", names)
+	}
+
+	te.ReverseCanonical = "traefik.example.com"
+	names = query()
+	if len(names) != 1 || names[0] != "traefik.example.com." {
+		t.Errorf("expected canonical name, got %v", names)
+	}
+}